@@ -1,22 +1,67 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"goemap/internal/geom"
 	"goemap/internal/tui"
 )
 
 func main() {
-	var m tea.Model
-	if len(os.Args) > 1 {
-		m = tui.NewWithPath(os.Args[1])
-	} else {
-		m = tui.New()
+	osmFilter := flag.String("osm-filter", "", "keep only OSM elements with matching tags, e.g. highway=* or building,amenity=cafe")
+	tile := flag.String("tile", "", "z/x/y of a vector tile (.mvt/.pbf) whose path does not contain it")
+	format := flag.String("format", "", "format of data read from stdin: "+strings.Join(geom.Formats, ", ")+" (default: sniffed)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file | -]\n", os.Args[0])
+		flag.PrintDefaults()
 	}
-	if err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseAllMotion()).Start(); err != nil {
+	flag.Parse()
+
+	var opts tui.Options
+	if *osmFilter != "" {
+		f, err := geom.ParseOSMFilter(*osmFilter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.OSMFilter = f
+	}
+	if *tile != "" {
+		t, err := geom.ParseTileID(*tile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Tile = &t
+	}
+	path := flag.Arg(0)
+	if path == "" && (*format != "" || stdinPiped()) {
+		path = "-"
+	}
+	progOpts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseAllMotion()}
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Stdin, opts.Format = data, *format
+		// stdin is the data, so keyboard input comes from the terminal
+		progOpts = append(progOpts, tea.WithInputTTY())
+	}
+	m := tui.NewWithOptions(path, opts)
+	if err := tea.NewProgram(m, progOpts...).Start(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// stdinPiped reports whether standard input is a pipe or file rather than
+// the terminal, as in psql ... | geomap.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
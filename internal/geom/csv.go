@@ -1,45 +1,70 @@
 package geom
 
 import (
+	"bufio"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-// LoadCSV reads a CSV with latitude/longitude columns and returns points.
-// Column detection: lat|latitude|y and lon|lng|long|longitude|x (case-insensitive).
-func LoadCSV(path string) (points [][2]float64, bbox BBox, err error) {
+// csvGeomColumns are header names (case-insensitive) of columns holding a
+// whole geometry as WKT/EWKT, hex WKB or GeoJSON.
+var csvGeomColumns = []string{"wkt", "geom", "the_geom", "geometry", "wkb_geometry", "shape"}
+
+// LoadCSV reads a delimited text file and returns one feature per row,
+// carrying the other columns as string properties. Geometry comes from a
+// WKT/GeoJSON column when one is present (see csvGeomColumns), and otherwise,
+// or where that cell is empty, from lat|latitude|y and lon|lng|long|longitude|x
+// columns holding decimal degrees or DMS strings such as 51°30'N. The delimiter (comma, semicolon,
+// tab or pipe) is sniffed from the header line. Rows are streamed; those
+// without a usable geometry are left out and their line numbers recorded in
+// Skipped.
+func LoadCSV(path string) (FeatureCollection, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, BBox{}, err
+		return FeatureCollection{}, err
 	}
 	defer f.Close()
-	r := csv.NewReader(f)
-	r.TrimLeadingSpace = true
-	recs, err := r.ReadAll()
+	return decodeCSV(f, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// decodeCSV reads CSV from r (see LoadCSV), putting every feature in layer.
+func decodeCSV(r io.Reader, layer string) (FeatureCollection, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	first, _ := br.Peek(br.Size())
+	if i := strings.IndexByte(string(first), '\n'); i >= 0 {
+		first = first[:i]
+	}
+	cr := csv.NewReader(br)
+	cr.Comma = sniffDelimiter(string(first))
+	cr.TrimLeadingSpace = true
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return FeatureCollection{}, errors.New("empty csv")
+	}
 	if err != nil {
-		return nil, BBox{}, err
-	}
-	if len(recs) == 0 {
-		return nil, BBox{}, errors.New("empty csv")
-	}
-	header := recs[0]
-	idxLat, idxLon := -1, -1
-	lower := func(s string) string {
-		b := make([]rune, 0, len(s))
-		for _, ch := range s {
-			if ch >= 'A' && ch <= 'Z' {
-				ch += 32
-			}
-			b = append(b, ch)
-		}
-		return string(b)
+		return FeatureCollection{}, err
 	}
+	header = append([]string(nil), header...)
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	idxGeom, idxLat, idxLon := -1, -1, -1
 	for i, h := range header {
-		lh := lower(h)
-		switch lh {
+		name := strings.ToLower(strings.TrimSpace(h))
+		for _, g := range csvGeomColumns {
+			if name == g && idxGeom == -1 {
+				idxGeom = i
+			}
+		}
+		switch name {
 		case "lat", "latitude", "y":
 			if idxLat == -1 {
 				idxLat = i
@@ -50,39 +75,170 @@ func LoadCSV(path string) (points [][2]float64, bbox BBox, err error) {
 			}
 		}
 	}
-	if idxLat == -1 || idxLon == -1 {
-		return nil, BBox{}, errors.New("csv: latitude/longitude columns not found")
+	if idxGeom == -1 && (idxLat == -1 || idxLon == -1) {
+		return FeatureCollection{}, errors.New("csv: no geometry or latitude/longitude columns found")
 	}
-	for _, row := range recs[1:] {
-		if idxLon >= len(row) || idxLat >= len(row) {
-			continue
+	var fc FeatureCollection
+	for i, h := range header {
+		if i != idxGeom {
+			fc.Keys = append(fc.Keys, h)
 		}
-		lon, err1 := strconv.ParseFloat(strings.TrimSpace(row[idxLon]), 64)
-		lat, err2 := strconv.ParseFloat(strings.TrimSpace(row[idxLat]), 64)
-		if err1 != nil || err2 != nil {
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return FeatureCollection{}, err
+			}
+			fc.Skipped = append(fc.Skipped, pe.StartLine)
 			continue
 		}
-		pt := [2]float64{lon, lat}
-		points = append(points, pt)
-		if len(points) == 1 {
-			bbox = BBox{MinX: pt[0], MinY: pt[1], MaxX: pt[0], MaxY: pt[1]}
-		} else {
-			if pt[0] < bbox.MinX {
-				bbox.MinX = pt[0]
+		line, _ := cr.FieldPos(0)
+		var g Geometry
+		// an empty geometry cell falls back to the lat/lon columns, if any
+		useGeom := idxGeom >= 0 && (idxLat == -1 || idxLon == -1 ||
+			idxGeom < len(row) && strings.TrimSpace(row[idxGeom]) != "")
+		if useGeom {
+			var srid int
+			if idxGeom < len(row) {
+				g, srid, err = csvGeometry(row[idxGeom])
 			}
-			if pt[1] < bbox.MinY {
-				bbox.MinY = pt[1]
+			if srid != 0 && fc.SRID == 0 {
+				fc.SetSRID(srid)
 			}
-			if pt[0] > bbox.MaxX {
-				bbox.MaxX = pt[0]
+		} else if idxLat >= 0 && idxLon >= 0 && idxLon < len(row) && idxLat < len(row) {
+			lon, ok1 := parseDegrees(row[idxLon])
+			lat, ok2 := parseDegrees(row[idxLat])
+			if ok1 && ok2 {
+				g = Geometry{Type: "Point", Points: [][2]float64{{lon, lat}}}
 			}
-			if pt[1] > bbox.MaxY {
-				bbox.MaxY = pt[1]
+		}
+		if err != nil || g.Empty() {
+			fc.Skipped = append(fc.Skipped, line)
+			continue
+		}
+		props := make(map[string]any, len(header))
+		for i, h := range header {
+			if i < len(row) && i != idxGeom {
+				props[h] = row[i]
 			}
 		}
+		fc.Add(Feature{Geometry: g, Properties: props, Layer: layer})
 	}
-	if len(points) == 0 {
-		return nil, BBox{}, errors.New("csv: no valid points parsed")
+	if len(fc.Features) == 0 {
+		if idxGeom >= 0 {
+			return FeatureCollection{}, errors.New("csv: no valid geometries parsed")
+		}
+		return FeatureCollection{}, errors.New("csv: no valid points parsed")
+	}
+	return fc, nil
+}
+
+// sniffDelimiter picks the most frequent of , ; tab and | outside quotes in
+// the header line, preferring a comma on ties.
+func sniffDelimiter(header string) rune {
+	counts := map[rune]int{}
+	quoted := false
+	for _, c := range header {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',', ';', '\t', '|':
+			if !quoted {
+				counts[c]++
+			}
+		}
+	}
+	best := ','
+	for _, c := range []rune{';', '\t', '|'} {
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best
+}
+
+// csvGeometry parses a geometry cell: GeoJSON, hex (E)WKB, or WKT with an
+// optional EWKT SRID prefix. It returns the SRID when the value carries one.
+func csvGeometry(s string) (Geometry, int, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return Geometry{}, 0, nil
+	case strings.HasPrefix(s, "{"):
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return Geometry{}, 0, err
+		}
+		// a Feature is accepted as well as a bare geometry
+		if g, ok := raw["geometry"].(map[string]any); ok {
+			raw = g
+		}
+		return geoJSONGeometry(raw), 0, nil
+	case isHexWKB(s):
+		b, err := decodeHexWKB(s)
+		if err != nil {
+			return Geometry{}, 0, err
+		}
+		return ParseWKB(b)
+	}
+	fc, err := ParseWKTData(s)
+	if err != nil {
+		return Geometry{}, 0, err
+	}
+	if len(fc.Features) != 1 {
+		return Geometry{}, 0, fmt.Errorf("csv: expected one geometry, found %d", len(fc.Features))
+	}
+	return fc.Features[0].Geometry, fc.SRID, nil
+}
+
+// parseDegrees parses an angle as decimal degrees or as degrees, minutes and
+// seconds with an optional leading or trailing hemisphere letter, e.g.
+// "51°30'N", "0 7 39 W", "-3:41:30" or "N 40° 26.767'". S and W negate the
+// value.
+func parseDegrees(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, true
+	}
+	sign := 1.0
+	u := strings.ToUpper(s)
+	if u == "" {
+		return 0, false
+	}
+	// hemisphere at either end
+	for _, h := range []byte{u[0], u[len(u)-1]} {
+		switch h {
+		case 'S', 'W':
+			sign = -1
+		}
+	}
+	u = strings.Trim(u, "NSEW ")
+	if strings.HasPrefix(u, "-") {
+		sign, u = -sign, u[1:]
+	}
+	// split on anything that is not part of a number: ° ' " : and spaces
+	parts := strings.FieldsFunc(u, func(c rune) bool {
+		return (c < '0' || c > '9') && c != '.'
+	})
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, false
+	}
+	if strings.IndexFunc(u, unicode.IsLetter) >= 0 {
+		return 0, false
+	}
+	v, scale := 0.0, 1.0
+	for _, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, false
+		}
+		v += n / scale
+		scale *= 60
 	}
-	return points, bbox, nil
+	return sign * v, true
 }
@@ -0,0 +1,46 @@
+package geom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCSV(t *testing.T) {
+	tests := []struct {
+		name, in string
+		points   [][2]float64
+		skipped  []int
+	}{
+		{"lat/lon", "name,lat,lon\na,1,2\nb,x,3\n", [][2]float64{{2, 1}}, []int{3}},
+		{"geometry", "name;wkt\na;POINT (1 2)\nb;\n", [][2]float64{{1, 2}}, []int{3}},
+		{
+			// an empty geometry cell falls back to lat/lon, a bad one does not
+			"geometry and lat/lon",
+			"name,geom,lat,lon\na,POINT (5 6),1,2\nb,,3,4\nc,POINT (,7,8\nd,,,\n",
+			[][2]float64{{5, 6}, {4, 3}},
+			[]int{4, 5},
+		},
+	}
+	for _, tt := range tests {
+		fc, err := decodeCSV(strings.NewReader(tt.in), "test")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var points [][2]float64
+		for _, f := range fc.Features {
+			points = append(points, f.Geometry.Points...)
+		}
+		if !reflect.DeepEqual(points, tt.points) || !reflect.DeepEqual(fc.Skipped, tt.skipped) {
+			t.Errorf("%s: points %v skipped %v, want %v %v", tt.name, points, fc.Skipped, tt.points, tt.skipped)
+		}
+	}
+}
+
+func TestCSVGeometryShortHex(t *testing.T) {
+	// too short to be WKB, so it is reported as bad WKT
+	if _, _, err := csvGeometry("1234"); err == nil || strings.Contains(strings.ToLower(err.Error()), "wkb") {
+		t.Errorf("csvGeometry(1234) error = %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package geom
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DecodePolyline decodes a Google encoded polyline at the given precision
+// (5 for Google, 6 for OSRM/Valhalla "polyline6") into lon/lat points.
+func DecodePolyline(s string, precision int) ([][2]float64, error) {
+	factor := math.Pow10(precision)
+	var out [][2]float64
+	var lat, lon int64
+	for i := 0; i < len(s); {
+		var d [2]int64
+		for k := range d {
+			var v uint64
+			for shift := uint(0); ; shift += 5 {
+				if i >= len(s) || shift > 60 {
+					return nil, errors.New("polyline: truncated input")
+				}
+				c := s[i]
+				i++
+				if c < 63 || c > 126 {
+					return nil, errors.New("polyline: invalid character")
+				}
+				b := uint64(c - 63)
+				v |= (b & 0x1f) << shift
+				if b < 0x20 {
+					break
+				}
+			}
+			d[k] = unzigzag(v)
+		}
+		lat += d[0]
+		lon += d[1]
+		out = append(out, [2]float64{float64(lon) / factor, float64(lat) / factor})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("polyline: empty input")
+	}
+	return out, nil
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// DecodeGeohash returns the cell a geohash covers.
+func DecodeGeohash(s string) (BBox, error) {
+	if s == "" {
+		return BBox{}, errors.New("geohash: empty input")
+	}
+	bb := BBox{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}
+	even := true
+	for _, c := range strings.ToLower(s) {
+		v := strings.IndexRune(geohashAlphabet, c)
+		if v < 0 {
+			return BBox{}, errors.New("geohash: invalid character")
+		}
+		// bits alternate between longitude and latitude, longitude first
+		for bit := 4; bit >= 0; bit-- {
+			on := v>>bit&1 == 1
+			if even {
+				mid := (bb.MinX + bb.MaxX) / 2
+				if on {
+					bb.MinX = mid
+				} else {
+					bb.MaxX = mid
+				}
+			} else {
+				mid := (bb.MinY + bb.MaxY) / 2
+				if on {
+					bb.MinY = mid
+				} else {
+					bb.MaxY = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return bb, nil
+}
+
+// isGeohash reports whether s is a plausible geohash: up to 12 characters of
+// the geohash alphabet, in either case.
+func isGeohash(s string) bool {
+	if len(s) == 0 || len(s) > 12 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune(geohashAlphabet, unicode.ToLower(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// bboxPolygon is the rectangle covering bb as a closed ring.
+func bboxPolygon(bb BBox) Geometry {
+	ring := [][2]float64{{bb.MinX, bb.MinY}, {bb.MaxX, bb.MinY}, {bb.MaxX, bb.MaxY}, {bb.MinX, bb.MaxY}, {bb.MinX, bb.MinY}}
+	return Geometry{Type: "Polygon", Polygons: [][][][2]float64{{ring}}}
+}
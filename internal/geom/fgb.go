@@ -0,0 +1,523 @@
+package geom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const fgbNodeBytes = 40 // minX, minY, maxX, maxY float64 + offset uint64
+
+// fgbColumn is one attribute column from the header.
+type fgbColumn struct {
+	name string
+	typ  byte
+}
+
+// FlatGeobuf is an open .fgb file. Features are decoded on demand by Query,
+// using the packed Hilbert R-tree when the file has one, so only the part of
+// a large file inside the viewport is ever read.
+type FlatGeobuf struct {
+	f        *os.File
+	Layer    string
+	Envelope BBox // from the header, or the index root when absent
+	Count    uint64
+	CRS      string
+	SRID     int
+	CRSWKT   string
+
+	geomType    byte
+	columns     []fgbColumn
+	nodeSize    int
+	levels      [][2]int // node index ranges per tree level, leaves first
+	indexOff    int64
+	featuresOff int64
+}
+
+// OpenFlatGeobuf reads the header and index layout of a FlatGeobuf file.
+func OpenFlatGeobuf(path string) (*FlatGeobuf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := openFGB(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if g.Layer == "" {
+		g.Layer = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return g, nil
+}
+
+func openFGB(f *os.File) (g *FlatGeobuf, err error) {
+	var pre [12]byte
+	if _, err := io.ReadFull(f, pre[:]); err != nil {
+		return nil, fmt.Errorf("fgb: header: %w", err)
+	}
+	// magic is "fgb", major version 3, "fgb", patch version
+	if string(pre[:3]) != "fgb" || pre[3] != 3 || string(pre[4:7]) != "fgb" {
+		return nil, errors.New("fgb: not a FlatGeobuf v3 file")
+	}
+	hlen := binary.LittleEndian.Uint32(pre[8:])
+	if hlen > 64<<20 {
+		return nil, fmt.Errorf("fgb: header too large (%d bytes)", hlen)
+	}
+	hb := make([]byte, hlen)
+	if _, err := io.ReadFull(f, hb); err != nil {
+		return nil, fmt.Errorf("fgb: header: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			g, err = nil, errors.New("fgb: corrupt header")
+		}
+	}()
+	h := fbRoot(hb)
+	g = &FlatGeobuf{f: f, Layer: string(h.str(0)), geomType: h.u8(2, 0), Count: h.u64(8, 0), nodeSize: int(h.u16(9, 16))}
+	if env := h.float64s(1); len(env) >= 4 {
+		g.Envelope = BBox{MinX: env[0], MinY: env[1], MaxX: env[2], MaxY: env[3]}
+	}
+	for i, n := 0, h.vecLen(7); i < n; i++ {
+		c := h.vecTable(7, i)
+		g.columns = append(g.columns, fgbColumn{name: string(c.str(0)), typ: c.u8(1, 0)})
+	}
+	if h.has(10) {
+		crs := h.table(10)
+		org, code := string(crs.str(0)), int(crs.i32(1, 0))
+		if code > 0 && (org == "" || strings.EqualFold(org, "EPSG")) {
+			g.SRID, g.CRS = code, "EPSG:"+strconv.Itoa(code)
+		} else if name := string(crs.str(2)); name != "" {
+			g.CRS = name
+		} else if code > 0 {
+			g.CRS = org + ":" + strconv.Itoa(code)
+		}
+		g.CRSWKT = string(crs.str(4))
+	}
+	g.indexOff = int64(12 + hlen)
+	g.featuresOff = g.indexOff
+	if g.nodeSize > 0 && g.Count > 0 {
+		if g.nodeSize < 2 {
+			return nil, fmt.Errorf("fgb: invalid index node size %d", g.nodeSize)
+		}
+		g.levels = fgbLevels(int(g.Count), g.nodeSize)
+		g.featuresOff += int64(g.levels[0][1]) * fgbNodeBytes
+		if !h.has(1) {
+			if root, err := g.nodes(0, 1); err == nil {
+				g.Envelope = root[0].box
+			}
+		}
+	}
+	return g, nil
+}
+
+// Close closes the underlying file.
+func (g *FlatGeobuf) Close() error { return g.f.Close() }
+
+// fgbLevels computes the node index range of each level of a packed R-tree
+// with numItems leaves, leaves first and the single root last. Nodes are
+// stored root first, so the leaves occupy the end of the index.
+func fgbLevels(numItems, nodeSize int) [][2]int {
+	n := numItems
+	counts := []int{n}
+	total := n
+	for n != 1 {
+		n = (n + nodeSize - 1) / nodeSize
+		counts = append(counts, n)
+		total += n
+	}
+	levels := make([][2]int, len(counts))
+	end := total
+	for i, c := range counts {
+		levels[i] = [2]int{end - c, end}
+		end -= c
+	}
+	return levels
+}
+
+type fgbNode struct {
+	box    BBox
+	offset uint64
+}
+
+// nodes reads n consecutive index nodes starting at node index i.
+func (g *FlatGeobuf) nodes(i, n int) ([]fgbNode, error) {
+	buf := make([]byte, n*fgbNodeBytes)
+	if _, err := g.f.ReadAt(buf, g.indexOff+int64(i)*fgbNodeBytes); err != nil {
+		return nil, fmt.Errorf("fgb: index: %w", err)
+	}
+	out := make([]fgbNode, n)
+	for k := range out {
+		b := buf[k*fgbNodeBytes:]
+		f := func(j int) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b[8*j:])) }
+		out[k] = fgbNode{box: BBox{MinX: f(0), MinY: f(1), MaxX: f(2), MaxY: f(3)}, offset: binary.LittleEndian.Uint64(b[32:])}
+	}
+	return out, nil
+}
+
+func intersects(a, b BBox) bool {
+	return a.MinX <= b.MaxX && a.MaxX >= b.MinX && a.MinY <= b.MaxY && a.MaxY >= b.MinY
+}
+
+// Query decodes the features whose bounding boxes intersect bb, up to limit
+// (0 means no limit). more reports that the limit cut the result short.
+func (g *FlatGeobuf) Query(bb BBox, limit int) (fc FeatureCollection, more bool, err error) {
+	fc.CRS, fc.SRID, fc.CRSWKT = g.CRS, g.SRID, g.CRSWKT
+	for _, c := range g.columns {
+		fc.Keys = append(fc.Keys, c.name)
+	}
+	if g.levels == nil {
+		return g.scan(fc, bb, limit)
+	}
+	offsets, more, err := g.search(bb, limit)
+	if err != nil {
+		return FeatureCollection{}, false, err
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i].offset < offsets[j].offset })
+	for _, o := range offsets {
+		f, _, err := g.readFeature(g.featuresOff + int64(o.offset))
+		if err != nil {
+			return FeatureCollection{}, false, err
+		}
+		f.ID = strconv.Itoa(o.index + 1)
+		fc.Add(f)
+	}
+	return fc, more, nil
+}
+
+type fgbHit struct {
+	offset uint64
+	index  int
+}
+
+// search walks the packed R-tree breadth first and returns the feature
+// offsets of the leaves intersecting bb.
+func (g *FlatGeobuf) search(bb BBox, limit int) ([]fgbHit, bool, error) {
+	type item struct{ node, level int }
+	queue := []item{{0, len(g.levels) - 1}}
+	leaves := g.levels[0][0]
+	var hits []fgbHit
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		end := min(it.node+g.nodeSize, g.levels[it.level][1])
+		nodes, err := g.nodes(it.node, end-it.node)
+		if err != nil {
+			return nil, false, err
+		}
+		for k, n := range nodes {
+			if !intersects(n.box, bb) {
+				continue
+			}
+			if it.level == 0 {
+				if limit > 0 && len(hits) == limit {
+					return hits, true, nil
+				}
+				hits = append(hits, fgbHit{offset: n.offset, index: it.node + k - leaves})
+				continue
+			}
+			queue = append(queue, item{int(n.offset), it.level - 1})
+		}
+	}
+	return hits, false, nil
+}
+
+// scan reads features sequentially, for files written without an index.
+func (g *FlatGeobuf) scan(fc FeatureCollection, bb BBox, limit int) (FeatureCollection, bool, error) {
+	off := g.featuresOff
+	for i := 0; ; i++ {
+		f, n, err := g.readFeature(off)
+		if err == io.EOF {
+			return fc, false, nil
+		}
+		if err != nil {
+			return FeatureCollection{}, false, err
+		}
+		off += n
+		var fb BBox
+		first := true
+		f.Geometry.EachVertex(func(p [2]float64) {
+			fb.extend(p, first)
+			first = false
+		})
+		if first || !intersects(fb, bb) {
+			continue
+		}
+		if limit > 0 && len(fc.Features) == limit {
+			return fc, true, nil
+		}
+		f.ID = strconv.Itoa(i + 1)
+		fc.Add(f)
+	}
+}
+
+// readFeature decodes the size-prefixed feature at off and returns it with
+// the number of bytes it occupies.
+func (g *FlatGeobuf) readFeature(off int64) (f Feature, n int64, err error) {
+	var pre [4]byte
+	if _, err := g.f.ReadAt(pre[:], off); err != nil {
+		return Feature{}, 0, err
+	}
+	size := binary.LittleEndian.Uint32(pre[:])
+	if size > 1<<30 {
+		return Feature{}, 0, fmt.Errorf("fgb: feature at byte %d too large", off)
+	}
+	buf := make([]byte, size)
+	if _, err := g.f.ReadAt(buf, off+4); err != nil {
+		return Feature{}, 0, fmt.Errorf("fgb: feature at byte %d: %w", off, err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("fgb: corrupt feature at byte %d", off)
+		}
+	}()
+	t := fbRoot(buf)
+	f.Layer = g.Layer
+	if t.has(0) {
+		f.Geometry = fgbGeometry(t.table(0), g.geomType)
+	}
+	cols := g.columns
+	if n := t.vecLen(2); n > 0 {
+		cols = nil
+		for i := 0; i < n; i++ {
+			c := t.vecTable(2, i)
+			cols = append(cols, fgbColumn{name: string(c.str(0)), typ: c.u8(1, 0)})
+		}
+	}
+	f.Properties = fgbProperties(t.bytes(1), cols)
+	return f, 4 + int64(size), nil
+}
+
+// fgbTypeNames maps FlatGeobuf geometry type codes to geometry type names.
+var fgbTypeNames = map[byte]string{
+	1: "Point", 2: "LineString", 3: "Polygon", 4: "MultiPoint", 5: "MultiLineString",
+	6: "MultiPolygon", 7: "GeometryCollection", 15: "MultiPolygon", 16: "MultiPolygon", 17: "Polygon",
+}
+
+// fgbGeometry decodes a Geometry table. typ is the header's geometry type,
+// overridden by the table's own type when present (mixed-type files).
+func fgbGeometry(t fbTable, typ byte) Geometry {
+	if tt := t.u8(6, 0); tt != 0 {
+		typ = tt
+	}
+	xy := t.float64s(1)
+	pts := make([][2]float64, len(xy)/2)
+	for i := range pts {
+		pts[i] = [2]float64{xy[2*i], xy[2*i+1]}
+	}
+	// ends holds the exclusive end vertex of each part
+	var parts [][][2]float64
+	if ends := t.uint32s(0); len(ends) > 0 {
+		start := 0
+		for _, e := range ends {
+			if int(e) > len(pts) || int(e) < start {
+				break
+			}
+			parts = append(parts, pts[start:e])
+			start = int(e)
+		}
+	} else if len(pts) > 0 {
+		parts = [][][2]float64{pts}
+	}
+	g := Geometry{Type: fgbTypeNames[typ]}
+	switch typ {
+	case 1, 4:
+		g.Points = pts
+	case 2, 5:
+		g.Lines = parts
+	case 3, 17:
+		if len(parts) > 0 {
+			g.Polygons = [][][][2]float64{parts}
+		}
+	default:
+		// MultiPolygon parts are untyped Polygons; collection parts carry a type
+		var partType byte
+		if typ == 6 || typ == 15 || typ == 16 {
+			partType = 3
+		}
+		for i, n := 0, t.vecLen(7); i < n; i++ {
+			sub := fgbGeometry(t.vecTable(7, i), partType)
+			g.Points = append(g.Points, sub.Points...)
+			g.Lines = append(g.Lines, sub.Lines...)
+			g.Polygons = append(g.Polygons, sub.Polygons...)
+		}
+		if g.Type == "" {
+			g.Type = partsType(g)
+		}
+	}
+	return g
+}
+
+// fgbProperties decodes the properties buffer: a sequence of uint16 column
+// indexes each followed by a value encoded according to the column type.
+func fgbProperties(b []byte, cols []fgbColumn) map[string]any {
+	props := make(map[string]any, len(cols))
+	le := binary.LittleEndian
+	for p := 0; p+2 <= len(b); {
+		ci := int(le.Uint16(b[p:]))
+		p += 2
+		if ci >= len(cols) {
+			break
+		}
+		c := cols[ci]
+		var v any
+		switch c.typ {
+		case 0:
+			v, p = int64(int8(b[p])), p+1
+		case 1:
+			v, p = int64(b[p]), p+1
+		case 2:
+			v, p = b[p] != 0, p+1
+		case 3:
+			v, p = int64(int16(le.Uint16(b[p:]))), p+2
+		case 4:
+			v, p = int64(le.Uint16(b[p:])), p+2
+		case 5:
+			v, p = int64(int32(le.Uint32(b[p:]))), p+4
+		case 6:
+			v, p = int64(le.Uint32(b[p:])), p+4
+		case 7:
+			v, p = int64(le.Uint64(b[p:])), p+8
+		case 8:
+			v, p = le.Uint64(b[p:]), p+8
+		case 9:
+			v, p = float64(math.Float32frombits(le.Uint32(b[p:]))), p+4
+		case 10:
+			v, p = math.Float64frombits(le.Uint64(b[p:])), p+8
+		case 11, 12, 13, 14:
+			n := int(le.Uint32(b[p:]))
+			s := b[p+4 : p+4+n]
+			p += 4 + n
+			if c.typ == 14 {
+				v = fmt.Sprintf("<blob %d bytes>", n)
+			} else {
+				v = string(s)
+			}
+		default:
+			return props
+		}
+		props[c.name] = v
+	}
+	return props
+}
+
+// fbTable is a minimal FlatBuffers table accessor. Out-of-range offsets
+// panic; callers recover and report a corrupt file.
+type fbTable struct {
+	b   []byte
+	pos int
+	vt  int
+}
+
+func fbRoot(b []byte) fbTable { return fbTableAt(b, int(binary.LittleEndian.Uint32(b))) }
+
+func fbTableAt(b []byte, pos int) fbTable {
+	vt := pos - int(int32(binary.LittleEndian.Uint32(b[pos:])))
+	return fbTable{b: b, pos: pos, vt: vt}
+}
+
+// field returns the absolute offset of field i, or 0 when it is absent.
+func (t fbTable) field(i int) int {
+	o := 4 + 2*i
+	if o >= int(binary.LittleEndian.Uint16(t.b[t.vt:])) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(t.b[t.vt+o:]))
+	if off == 0 {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t fbTable) has(i int) bool { return t.field(i) != 0 }
+
+func (t fbTable) u8(i int, def byte) byte {
+	if p := t.field(i); p != 0 {
+		return t.b[p]
+	}
+	return def
+}
+
+func (t fbTable) u16(i int, def uint16) uint16 {
+	if p := t.field(i); p != 0 {
+		return binary.LittleEndian.Uint16(t.b[p:])
+	}
+	return def
+}
+
+func (t fbTable) i32(i int, def int32) int32 {
+	if p := t.field(i); p != 0 {
+		return int32(binary.LittleEndian.Uint32(t.b[p:]))
+	}
+	return def
+}
+
+func (t fbTable) u64(i int, def uint64) uint64 {
+	if p := t.field(i); p != 0 {
+		return binary.LittleEndian.Uint64(t.b[p:])
+	}
+	return def
+}
+
+// indirect follows the uoffset stored at field i.
+func (t fbTable) indirect(i int) int {
+	p := t.field(i)
+	if p == 0 {
+		return 0
+	}
+	return p + int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+func (t fbTable) table(i int) fbTable { return fbTableAt(t.b, t.indirect(i)) }
+
+// vector returns the start and length of the vector at field i.
+func (t fbTable) vector(i int) (int, int) {
+	p := t.indirect(i)
+	if p == 0 {
+		return 0, 0
+	}
+	return p + 4, int(binary.LittleEndian.Uint32(t.b[p:]))
+}
+
+func (t fbTable) vecLen(i int) int {
+	_, n := t.vector(i)
+	return n
+}
+
+func (t fbTable) vecTable(i, k int) fbTable {
+	start, _ := t.vector(i)
+	p := start + 4*k
+	return fbTableAt(t.b, p+int(binary.LittleEndian.Uint32(t.b[p:])))
+}
+
+func (t fbTable) bytes(i int) []byte {
+	start, n := t.vector(i)
+	return t.b[start : start+n]
+}
+
+func (t fbTable) str(i int) []byte { return t.bytes(i) }
+
+func (t fbTable) float64s(i int) []float64 {
+	start, n := t.vector(i)
+	out := make([]float64, n)
+	for k := range out {
+		out[k] = math.Float64frombits(binary.LittleEndian.Uint64(t.b[start+8*k:]))
+	}
+	return out
+}
+
+func (t fbTable) uint32s(i int) []uint32 {
+	start, n := t.vector(i)
+	out := make([]uint32, n)
+	for k := range out {
+		out[k] = binary.LittleEndian.Uint32(t.b[start+4*k:])
+	}
+	return out
+}
@@ -0,0 +1,391 @@
+package geom
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fbObj is a FlatBuffers table for tests, keyed by field index. byte, uint16,
+// int32 and uint64 values are stored inline; string, []byte, []float64,
+// []uint32, fbObj and []fbObj are written after the table and referenced by
+// offset, which is all the reader needs.
+type fbObj map[int]any
+
+type fbBuilder struct{ b []byte }
+
+func (w *fbBuilder) u32(v uint32) {
+	w.b = binary.LittleEndian.AppendUint32(w.b, v)
+}
+
+// patch points the uoffset at slot to target.
+func (w *fbBuilder) patch(slot, target int) {
+	binary.LittleEndian.PutUint32(w.b[slot:], uint32(target-slot))
+}
+
+// table writes o, vtable first, and returns the position of the table.
+func (w *fbBuilder) table(o fbObj) int {
+	nf := 0
+	for i := range o {
+		nf = max(nf, i+1)
+	}
+	vt := len(w.b)
+	w.b = append(w.b, make([]byte, 4+2*nf)...)
+	pos := len(w.b)
+	w.u32(uint32(pos - vt))
+	slots := map[int]int{}
+	for i := 0; i < nf; i++ {
+		v, ok := o[i]
+		if !ok {
+			continue
+		}
+		binary.LittleEndian.PutUint16(w.b[vt+4+2*i:], uint16(len(w.b)-pos))
+		switch v := v.(type) {
+		case byte:
+			w.b = append(w.b, v)
+		case uint16:
+			w.b = binary.LittleEndian.AppendUint16(w.b, v)
+		case int32:
+			w.u32(uint32(v))
+		case uint64:
+			w.b = binary.LittleEndian.AppendUint64(w.b, v)
+		default:
+			slots[i] = len(w.b)
+			w.u32(0)
+		}
+	}
+	binary.LittleEndian.PutUint16(w.b[vt:], uint16(4+2*nf))
+	binary.LittleEndian.PutUint16(w.b[vt+2:], uint16(len(w.b)-pos))
+	for i := 0; i < nf; i++ {
+		slot, ok := slots[i]
+		if !ok {
+			continue
+		}
+		if sub, ok := o[i].(fbObj); ok {
+			w.patch(slot, w.table(sub))
+			continue
+		}
+		w.patch(slot, len(w.b))
+		switch v := o[i].(type) {
+		case string:
+			w.u32(uint32(len(v)))
+			w.b = append(w.b, v...)
+			w.b = append(w.b, 0)
+		case []byte:
+			w.u32(uint32(len(v)))
+			w.b = append(w.b, v...)
+		case []float64:
+			w.u32(uint32(len(v)))
+			for _, f := range v {
+				w.b = binary.LittleEndian.AppendUint64(w.b, math.Float64bits(f))
+			}
+		case []uint32:
+			w.u32(uint32(len(v)))
+			for _, u := range v {
+				w.u32(u)
+			}
+		case []fbObj:
+			w.u32(uint32(len(v)))
+			start := len(w.b)
+			w.b = append(w.b, make([]byte, 4*len(v))...)
+			for k, t := range v {
+				w.patch(start+4*k, w.table(t))
+			}
+		default:
+			panic("fbBuilder: unsupported field type")
+		}
+	}
+	return pos
+}
+
+// fbBytes serialises o as a FlatBuffers root table.
+func fbBytes(o fbObj) []byte {
+	w := &fbBuilder{b: make([]byte, 4)}
+	w.patch(0, w.table(o))
+	return w.b
+}
+
+// writeFGB writes a FlatGeobuf file with the given header and features,
+// with a packed R-tree of nodeSize when nodeSize > 0. Leaf order is feature
+// order, which the reader accepts just as well as Hilbert order.
+func writeFGB(t *testing.T, header fbObj, features []fbObj, nodeSize int) string {
+	t.Helper()
+	header[8] = uint64(len(features))
+	header[9] = uint16(nodeSize)
+	hb := fbBytes(header)
+	out := []byte{'f', 'g', 'b', 3, 'f', 'g', 'b', 0}
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(hb)))
+	out = append(out, hb...)
+
+	var data []byte
+	var leaves []fgbNode
+	for _, f := range features {
+		var box BBox
+		first := true
+		xy := f[0].(fbObj)[1].([]float64)
+		for i := 0; i+1 < len(xy); i += 2 {
+			box.extend([2]float64{xy[i], xy[i+1]}, first)
+			first = false
+		}
+		fb := fbBytes(f)
+		leaves = append(leaves, fgbNode{box: box, offset: uint64(len(data))})
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(fb)))
+		data = append(data, fb...)
+	}
+	if nodeSize > 0 && len(features) > 0 {
+		levels := fgbLevels(len(features), nodeSize)
+		nodes := make([]fgbNode, levels[0][1])
+		copy(nodes[levels[0][0]:], leaves)
+		for l := 1; l < len(levels); l++ {
+			child := levels[l-1]
+			for i := levels[l][0]; i < levels[l][1]; i++ {
+				first := child[0] + (i-levels[l][0])*nodeSize
+				n := fgbNode{box: nodes[first].box, offset: uint64(first)}
+				for c := first + 1; c < min(first+nodeSize, child[1]); c++ {
+					b := nodes[c].box
+					n.box.extend([2]float64{b.MinX, b.MinY}, false)
+					n.box.extend([2]float64{b.MaxX, b.MaxY}, false)
+				}
+				nodes[i] = n
+			}
+		}
+		for _, n := range nodes {
+			for _, f := range []float64{n.box.MinX, n.box.MinY, n.box.MaxX, n.box.MaxY} {
+				out = binary.LittleEndian.AppendUint64(out, math.Float64bits(f))
+			}
+			out = binary.LittleEndian.AppendUint64(out, n.offset)
+		}
+	}
+	out = append(out, data...)
+	path := filepath.Join(t.TempDir(), "test.fgb")
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fgbPoint is a point feature with a name (string, column 0) and a rank
+// (int, column 1).
+func fgbPoint(x, y float64, name string, rank int32) fbObj {
+	props := binary.LittleEndian.AppendUint16(nil, 0)
+	props = binary.LittleEndian.AppendUint32(props, uint32(len(name)))
+	props = append(props, name...)
+	props = binary.LittleEndian.AppendUint16(props, 1)
+	props = binary.LittleEndian.AppendUint32(props, uint32(rank))
+	return fbObj{0: fbObj{1: []float64{x, y}}, 1: props}
+}
+
+func TestFgbLevels(t *testing.T) {
+	tests := []struct {
+		items, nodeSize int
+		want            [][2]int
+	}{
+		{1, 16, [][2]int{{0, 1}}},
+		{10, 4, [][2]int{{4, 14}, {1, 4}, {0, 1}}},
+		{16, 16, [][2]int{{1, 17}, {0, 1}}},
+		{17, 16, [][2]int{{3, 20}, {1, 3}, {0, 1}}},
+	}
+	for _, tt := range tests {
+		if got := fgbLevels(tt.items, tt.nodeSize); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fgbLevels(%d, %d) = %v, want %v", tt.items, tt.nodeSize, got, tt.want)
+		}
+	}
+}
+
+func TestFlatGeobufQuery(t *testing.T) {
+	header := func() fbObj {
+		return fbObj{
+			0:  "pts",
+			2:  byte(1),
+			7:  []fbObj{{0: "name", 1: byte(11)}, {0: "rank", 1: byte(5)}},
+			10: fbObj{0: "EPSG", 1: int32(4326), 4: `GEOGCS["WGS 84"]`},
+		}
+	}
+	var features []fbObj
+	for i := 1; i <= 10; i++ {
+		features = append(features, fgbPoint(float64(i), float64(i), "p"+string(rune('a'+i-1)), int32(i*10)))
+	}
+	all := BBox{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}
+	tests := []struct {
+		name     string
+		nodeSize int
+		bb       BBox
+		limit    int
+		ids      []string
+		more     bool
+	}{
+		{"indexed, all", 4, all, 0, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, false},
+		{"indexed, window", 4, BBox{MinX: 2.5, MinY: 2.5, MaxX: 5.5, MaxY: 5.5}, 0, []string{"3", "4", "5"}, false},
+		{"indexed, limit", 4, all, 2, []string{"1", "2"}, true},
+		{"indexed, empty", 4, BBox{MinX: 20, MinY: 20, MaxX: 30, MaxY: 30}, 0, nil, false},
+		{"one node", 16, BBox{MinX: 9, MinY: 9, MaxX: 10, MaxY: 10}, 0, []string{"9", "10"}, false},
+		{"unindexed, all", 0, all, 0, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, false},
+		{"unindexed, window", 0, BBox{MinX: 2.5, MinY: 2.5, MaxX: 5.5, MaxY: 5.5}, 0, []string{"3", "4", "5"}, false},
+		{"unindexed, limit", 0, all, 2, []string{"1", "2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := OpenFlatGeobuf(writeFGB(t, header(), features, tt.nodeSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+			if g.Layer != "pts" || g.Count != 10 || g.SRID != 4326 || g.CRS != "EPSG:4326" || g.CRSWKT != `GEOGCS["WGS 84"]` {
+				t.Errorf("header = %q %d %d %q %q", g.Layer, g.Count, g.SRID, g.CRS, g.CRSWKT)
+			}
+			if tt.nodeSize > 0 && g.Envelope != (BBox{MinX: 1, MinY: 1, MaxX: 10, MaxY: 10}) {
+				t.Errorf("envelope from index root = %+v", g.Envelope)
+			}
+			fc, more, err := g.Query(tt.bb, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, f := range fc.Features {
+				ids = append(ids, f.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) || more != tt.more {
+				t.Errorf("ids %v more %v, want %v %v", ids, more, tt.ids, tt.more)
+			}
+			if !reflect.DeepEqual(fc.Keys, []string{"name", "rank"}) || fc.SRID != 4326 {
+				t.Errorf("keys %q srid %d", fc.Keys, fc.SRID)
+			}
+			for _, f := range fc.Features {
+				if f.ID == "3" {
+					want := map[string]any{"name": "pc", "rank": int64(30)}
+					if !reflect.DeepEqual(f.Properties, want) || f.Geometry.Points[0] != [2]float64{3, 3} || f.Layer != "pts" {
+						t.Errorf("feature 3 = %+v", f)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFgbGeometry(t *testing.T) {
+	square := []float64{0, 0, 4, 0, 4, 4, 0, 4, 0, 0}
+	hole := []float64{1, 1, 2, 1, 2, 2, 1, 1}
+	tests := []struct {
+		name     string
+		geom     fbObj
+		typ      byte
+		want     string
+		points   int
+		lines    []int // vertices per line
+		polygons []int // rings per polygon
+	}{
+		{"point", fbObj{1: []float64{1, 2}}, 1, "Point", 1, nil, nil},
+		{"multipoint", fbObj{1: []float64{1, 2, 3, 4}}, 4, "MultiPoint", 2, nil, nil},
+		{"linestring", fbObj{1: []float64{0, 0, 1, 1, 2, 0}}, 2, "LineString", 0, []int{3}, nil},
+		{"multilinestring", fbObj{0: []uint32{2, 5}, 1: []float64{0, 0, 1, 1, 2, 2, 3, 3, 4, 4}}, 5, "MultiLineString", 0, []int{2, 3}, nil},
+		{"polygon with hole", fbObj{0: []uint32{5, 9}, 1: append(append([]float64{}, square...), hole...)}, 3, "Polygon", 0, nil, []int{2}},
+		{"multipolygon", fbObj{7: []fbObj{{1: square}, {0: []uint32{5, 9}, 1: append(append([]float64{}, square...), hole...)}}}, 6, "MultiPolygon", 0, nil, []int{1, 2}},
+		{"type in geometry", fbObj{1: []float64{0, 0, 1, 1}, 6: byte(2)}, 0, "LineString", 0, []int{2}, nil},
+		{"collection", fbObj{7: []fbObj{{1: []float64{5, 5}, 6: byte(1)}, {1: []float64{0, 0, 1, 1}, 6: byte(2)}}}, 7, "GeometryCollection", 1, []int{2}, nil},
+	}
+	for _, tt := range tests {
+		g := fgbGeometry(fbRoot(fbBytes(tt.geom)), tt.typ)
+		var lines, polys []int
+		for _, l := range g.Lines {
+			lines = append(lines, len(l))
+		}
+		for _, p := range g.Polygons {
+			polys = append(polys, len(p))
+		}
+		if g.Type != tt.want || len(g.Points) != tt.points || !reflect.DeepEqual(lines, tt.lines) || !reflect.DeepEqual(polys, tt.polygons) {
+			t.Errorf("%s: %s with %d points, lines %v, polygons %v", tt.name, g.Type, len(g.Points), lines, polys)
+		}
+	}
+}
+
+func TestFgbProperties(t *testing.T) {
+	le := binary.LittleEndian
+	cols := []fgbColumn{
+		{"byte", 0}, {"ubyte", 1}, {"bool", 2}, {"short", 3}, {"ushort", 4}, {"int", 5},
+		{"uint", 6}, {"long", 7}, {"ulong", 8}, {"float", 9}, {"double", 10},
+		{"string", 11}, {"json", 12}, {"datetime", 13}, {"binary", 14},
+	}
+	var b []byte
+	field := func(i uint16, v ...byte) {
+		b = le.AppendUint16(b, i)
+		b = append(b, v...)
+	}
+	field(0, 0xff)
+	field(1, 0xff)
+	field(2, 1)
+	field(3, le.AppendUint16(nil, 0xfffe)...)
+	field(4, le.AppendUint16(nil, 0xfffe)...)
+	field(5, le.AppendUint32(nil, 0xfffffffd)...)
+	field(6, le.AppendUint32(nil, 0xfffffffd)...)
+	field(7, le.AppendUint64(nil, 1<<40)...)
+	field(8, le.AppendUint64(nil, 1<<63)...)
+	field(9, le.AppendUint32(nil, math.Float32bits(1.5))...)
+	field(10, le.AppendUint64(nil, math.Float64bits(-2.25))...)
+	field(11, append(le.AppendUint32(nil, 3), "abc"...)...)
+	field(12, append(le.AppendUint32(nil, 2), "{}"...)...)
+	field(13, append(le.AppendUint32(nil, 10), "2024-01-02"...)...)
+	field(14, append(le.AppendUint32(nil, 4), 1, 2, 3, 4)...)
+	want := map[string]any{
+		"byte": int64(-1), "ubyte": int64(255), "bool": true, "short": int64(-2), "ushort": int64(65534),
+		"int": int64(-3), "uint": int64(4294967293), "long": int64(1 << 40), "ulong": uint64(1 << 63),
+		"float": 1.5, "double": -2.25, "string": "abc", "json": "{}", "datetime": "2024-01-02",
+		"binary": "<blob 4 bytes>",
+	}
+	if got := fgbProperties(b, cols); !reflect.DeepEqual(got, want) {
+		t.Errorf("fgbProperties = %v, want %v", got, want)
+	}
+	// an out-of-range column index ends decoding
+	if got := fgbProperties(le.AppendUint16(nil, 99), cols); len(got) != 0 {
+		t.Errorf("unknown column decoded as %v", got)
+	}
+}
+
+func TestFlatGeobufCRS(t *testing.T) {
+	tests := []struct {
+		crs  fbObj
+		srid int
+		name string
+	}{
+		{fbObj{1: int32(27700)}, 27700, "EPSG:27700"},
+		{fbObj{0: "epsg", 1: int32(3857)}, 3857, "EPSG:3857"},
+		{fbObj{0: "ESRI", 1: int32(102100), 2: "WGS 84 / Pseudo-Mercator"}, 0, "WGS 84 / Pseudo-Mercator"},
+		{fbObj{0: "IGNF", 1: int32(1234)}, 0, "IGNF:1234"},
+	}
+	for _, tt := range tests {
+		path := writeFGB(t, fbObj{2: byte(1), 10: tt.crs}, []fbObj{fgbPoint(0, 0, "a", 1)}, 16)
+		g, err := OpenFlatGeobuf(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.SRID != tt.srid || g.CRS != tt.name || g.Layer != "test" {
+			t.Errorf("crs %v: srid %d crs %q layer %q, want %d %q", tt.crs, g.SRID, g.CRS, g.Layer, tt.srid, tt.name)
+		}
+		g.Close()
+	}
+}
+
+func TestOpenFlatGeobufErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, data, want string
+	}{
+		{"short", "fgb", "header"},
+		{"magic", "fgb\x02fgb\x00\x00\x00\x00\x00", "not a FlatGeobuf v3 file"},
+		{"corrupt", "fgb\x03fgb\x00\x08\x00\x00\x00\xff\xff\xff\x7f\x00\x00\x00\x00", "corrupt header"},
+		{"truncated", "fgb\x03fgb\x00\x40\x00\x00\x00\x04\x00", "header"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".fgb")
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := OpenFlatGeobuf(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
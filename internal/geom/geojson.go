@@ -1,61 +1,193 @@
 package geom
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-// LoadGeo reads a GeoJSON file and returns Data (points, lines, polygons)
-func LoadGeo(path string) (Data, error) {
+// LoadGeo reads a GeoJSON or TopoJSON file and returns its features
+func LoadGeo(path string) (FeatureCollection, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return Data{}, err
+		return FeatureCollection{}, err
 	}
 	defer f.Close()
-	data, err := io.ReadAll(f)
-	if err != nil {
-		return Data{}, err
-	}
-	var raw map[string]any
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return Data{}, err
+	return DecodeGeoJSON(context.Background(), f, nil)
+}
+
+// ParseGeoJSON decodes a GeoJSON FeatureCollection, Feature or bare geometry object.
+func ParseGeoJSON(data []byte) (FeatureCollection, error) {
+	return DecodeGeoJSON(context.Background(), bytes.NewReader(data), nil)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DecodeGeoJSON streams a GeoJSON document from r. The members of a
+// FeatureCollection's "features" array are decoded one at a time, so memory
+// stays proportional to the features kept rather than the file size. progress,
+// if non-nil, is called after each feature with the bytes consumed so far and
+// the number of features decoded. Decoding stops with ctx.Err() once ctx is done.
+// A TopoJSON Topology is recognised by its "type" and expanded into features.
+func DecodeGeoJSON(ctx context.Context, r io.Reader, progress func(read int64, features int)) (FeatureCollection, error) {
+	cr := &countingReader{r: r}
+	dec := json.NewDecoder(cr)
+	if tok, err := dec.Token(); err != nil {
+		return FeatureCollection{}, err
+	} else if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return FeatureCollection{}, errors.New("geojson: expected an object")
 	}
-	var d Data
-	addPt := func(pt [2]float64) {
-		if len(d.Points)+len(d.Lines)+len(d.Polygons) == 0 {
-			d.BBox = BBox{MinX: pt[0], MinY: pt[1], MaxX: pt[0], MaxY: pt[1]}
-		} else {
-			if pt[0] < d.BBox.MinX {
-				d.BBox.MinX = pt[0]
+	var fc FeatureCollection
+	raw := map[string]any{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		key, _ := tok.(string)
+		if key != "features" {
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return FeatureCollection{}, err
 			}
-			if pt[1] < d.BBox.MinY {
-				d.BBox.MinY = pt[1]
+			raw[key] = v
+			continue
+		}
+		if tok, err := dec.Token(); err != nil {
+			return FeatureCollection{}, err
+		} else if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return FeatureCollection{}, errors.New("geojson: \"features\" is not an array")
+		}
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				return FeatureCollection{}, err
 			}
-			if pt[0] > d.BBox.MaxX {
-				d.BBox.MaxX = pt[0]
+			var fm map[string]any
+			if err := dec.Decode(&fm); err != nil {
+				return FeatureCollection{}, err
 			}
-			if pt[1] > d.BBox.MaxY {
-				d.BBox.MaxY = pt[1]
+			fc.addGeoJSONFeature(fm, "")
+			if progress != nil {
+				progress(cr.n, len(fc.Features))
 			}
 		}
-		d.Points = append(d.Points, pt)
+		if _, err := dec.Token(); err != nil {
+			return FeatureCollection{}, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return FeatureCollection{}, err
+	}
+	layer, _ := raw["name"].(string)
+	fc.setGeoJSONCRS(raw["crs"])
+	switch t, _ := raw["type"].(string); t {
+	case "FeatureCollection":
+	case "Topology":
+		if err := fc.addTopoJSON(raw); err != nil {
+			return FeatureCollection{}, err
+		}
+	default:
+		fc.addGeoJSON(raw, layer)
 	}
-	addLine := func(ls [][2]float64) {
-		d.Lines = append(d.Lines, ls)
-		for _, p := range ls {
-			addPt(p)
+	for i := range fc.Features {
+		if fc.Features[i].Layer == "" {
+			fc.Features[i].Layer = layer
 		}
 	}
-	addPoly := func(poly [][][2]float64) {
-		d.Polygons = append(d.Polygons, poly)
-		for _, ring := range poly {
-			for _, p := range ring {
-				addPt(p)
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("no geometries found")
+	}
+	return fc, nil
+}
+
+// geojsonCodeRe extracts the EPSG code from a GeoJSON "crs" name.
+var geojsonCodeRe = regexp.MustCompile(`(?i)EPSG(?::|::|:[\d.]*:|/0/)(\d+)$`)
+
+// setGeoJSONCRS records the coordinate system of the 2008 GeoJSON "crs"
+// member, either {"type": "name", "properties": {"name": "urn:..."}} or the
+// older {"type": "EPSG", "properties": {"code": n}}. RFC 7946 dropped the
+// member, and without it coordinates are WGS 84.
+func (fc *FeatureCollection) setGeoJSONCRS(v any) {
+	crs, _ := v.(map[string]any)
+	props, _ := crs["properties"].(map[string]any)
+	if code, ok := props["code"].(float64); ok {
+		fc.SetSRID(int(code))
+		return
+	}
+	name, _ := props["name"].(string)
+	if m := geojsonCodeRe.FindStringSubmatch(name); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		fc.SetSRID(code)
+	} else if strings.HasSuffix(strings.ToUpper(name), "CRS84") {
+		fc.SetSRID(4326)
+	} else {
+		fc.CRS = name
+	}
+}
+
+// addGeoJSON adds the features of a decoded FeatureCollection, Feature or
+// bare geometry object.
+func (fc *FeatureCollection) addGeoJSON(raw map[string]any, layer string) {
+	t, _ := raw["type"].(string)
+	switch t {
+	case "Feature":
+		fc.addGeoJSONFeature(raw, layer)
+	case "FeatureCollection":
+		if fs, ok := raw["features"].([]any); ok {
+			for _, f := range fs {
+				if fm, ok := f.(map[string]any); ok {
+					fc.addGeoJSONFeature(fm, layer)
+				}
 			}
 		}
+	default:
+		if len(raw) > 0 {
+			fc.Add(Feature{Geometry: geoJSONGeometry(raw), Layer: layer})
+		}
 	}
+}
+
+// addGeoJSONFeature adds one decoded Feature object; features without a
+// geometry are ignored.
+func (fc *FeatureCollection) addGeoJSONFeature(fm map[string]any, layer string) {
+	g, _ := fm["geometry"].(map[string]any)
+	if g == nil {
+		return
+	}
+	props, _ := fm["properties"].(map[string]any)
+	fc.Add(Feature{ID: geoJSONID(fm["id"]), Geometry: geoJSONGeometry(g), Properties: props, Layer: layer})
+}
+
+// geoJSONID renders a GeoJSON feature "id" (string or number) as a string.
+func geoJSONID(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return ""
+}
+
+// geoJSONGeometry converts a decoded GeoJSON geometry object into a Geometry.
+// GeometryCollection members are merged into one multi-part geometry.
+func geoJSONGeometry(g map[string]any) Geometry {
 	parsePoint := func(v any) (pt [2]float64, ok bool) {
 		if a, ok := v.([]any); ok && len(a) >= 2 {
 			lon, lok := a[0].(float64)
@@ -78,104 +210,63 @@ func LoadGeo(path string) (Data, error) {
 		}
 		return pts, true
 	}
-	parseLineString := func(v any) (ls [][2]float64, ok bool) { return parseArrayPoints(v) }
 	parseMultiLineString := func(v any) (m [][][2]float64, ok bool) {
 		arr, ok := v.([]any)
 		if !ok {
 			return nil, false
 		}
 		for _, el := range arr {
-			if ls, ok := parseLineString(el); ok {
+			if ls, ok := parseArrayPoints(el); ok {
 				m = append(m, ls)
 			}
 		}
 		return m, true
 	}
-	parsePolygon := func(v any) (poly [][][2]float64, ok bool) {
-		arr, ok := v.([]any)
-		if !ok {
-			return nil, false
-		}
-		for _, ring := range arr {
-			if ls, ok := parseLineString(ring); ok {
-				poly = append(poly, ls)
-			}
-		}
-		return poly, true
-	}
 	parseMultiPolygon := func(v any) (mp [][][][2]float64, ok bool) {
 		arr, ok := v.([]any)
 		if !ok {
 			return nil, false
 		}
 		for _, el := range arr {
-			if poly, ok := parsePolygon(el); ok {
+			if poly, ok := parseMultiLineString(el); ok {
 				mp = append(mp, poly)
 			}
 		}
 		return mp, true
 	}
-	var walkGeom func(g map[string]any)
-	walkGeom = func(g map[string]any) {
-		gt, _ := g["type"].(string)
-		switch gt {
-		case "Point":
-			if pt, ok := parsePoint(g["coordinates"]); ok {
-				addPt(pt)
-			}
-		case "MultiPoint":
-			if pts, ok := parseArrayPoints(g["coordinates"]); ok {
-				for _, p := range pts {
-					addPt(p)
-				}
-			}
-		case "LineString":
-			if ls, ok := parseLineString(g["coordinates"]); ok {
-				addLine(ls)
-			}
-		case "MultiLineString":
-			if mls, ok := parseMultiLineString(g["coordinates"]); ok {
-				for _, ls := range mls {
-					addLine(ls)
-				}
-			}
-		case "Polygon":
-			if poly, ok := parsePolygon(g["coordinates"]); ok {
-				addPoly(poly)
-			}
-		case "MultiPolygon":
-			if mp, ok := parseMultiPolygon(g["coordinates"]); ok {
-				for _, poly := range mp {
-					addPoly(poly)
-				}
-			}
+	gt, _ := g["type"].(string)
+	out := Geometry{Type: gt}
+	switch gt {
+	case "Point":
+		if pt, ok := parsePoint(g["coordinates"]); ok {
+			out.Points = append(out.Points, pt)
 		}
-	}
-	t, _ := raw["type"].(string)
-	switch t {
-	case "Feature":
-		if g, ok := raw["geometry"].(map[string]any); ok {
-			walkGeom(g)
+	case "MultiPoint":
+		out.Points, _ = parseArrayPoints(g["coordinates"])
+	case "LineString":
+		if ls, ok := parseArrayPoints(g["coordinates"]); ok {
+			out.Lines = append(out.Lines, ls)
 		}
-	case "FeatureCollection":
-		if fs, ok := raw["features"].([]any); ok {
-			for _, f := range fs {
-				if fm, ok := f.(map[string]any); ok {
-					if g, ok := fm["geometry"].(map[string]any); ok {
-						walkGeom(g)
-					}
-				}
-			}
+	case "MultiLineString":
+		out.Lines, _ = parseMultiLineString(g["coordinates"])
+	case "Polygon":
+		if poly, ok := parseMultiLineString(g["coordinates"]); ok {
+			out.Polygons = append(out.Polygons, poly)
 		}
-	default:
-		if len(raw) > 0 {
-			walkGeom(raw)
+	case "MultiPolygon":
+		out.Polygons, _ = parseMultiPolygon(g["coordinates"])
+	case "GeometryCollection":
+		members, _ := g["geometries"].([]any)
+		for _, m := range members {
+			if mg, ok := m.(map[string]any); ok {
+				sub := geoJSONGeometry(mg)
+				out.Points = append(out.Points, sub.Points...)
+				out.Lines = append(out.Lines, sub.Lines...)
+				out.Polygons = append(out.Polygons, sub.Polygons...)
+			}
 		}
 	}
-	if len(d.Points) == 0 && len(d.Lines) == 0 && len(d.Polygons) == 0 {
-		return Data{}, errors.New("no geometries found")
-	}
-	return d, nil
+	return out
 }
 
 // LoadGeoJSON extracts point coordinates from a GeoJSON file.
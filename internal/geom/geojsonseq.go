@@ -0,0 +1,72 @@
+package geom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadGeoJSONSeq reads newline-delimited GeoJSON (.geojsonl/.ndjson) and
+// GeoJSON Text Sequences (RFC 8142, records prefixed with the RS character,
+// which may span several lines), one Feature or geometry per record. The file
+// is streamed, and records that are not valid JSON objects or hold no
+// geometry are skipped and their line numbers recorded in Skipped.
+func LoadGeoJSONSeq(path string) (FeatureCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer f.Close()
+	return decodeGeoJSONSeq(f, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// decodeGeoJSONSeq reads records from r (see LoadGeoJSONSeq), putting every
+// feature in layer. Records are split on RS when the first buffered block
+// holds one, and on newlines otherwise.
+func decodeGeoJSONSeq(r io.Reader, layer string) (FeatureCollection, error) {
+	var fc FeatureCollection
+	br := bufio.NewReaderSize(r, 1<<16)
+	delim := byte('\n')
+	if head, _ := br.Peek(br.Size()); bytes.IndexByte(head, 0x1E) >= 0 {
+		delim = 0x1E
+	}
+	for lineNo := 1; ; {
+		rec, err := br.ReadBytes(delim)
+		if err != nil && err != io.EOF {
+			return FeatureCollection{}, err
+		}
+		// report the line the record starts on
+		rec = bytes.TrimSuffix(rec, []byte{delim})
+		body := bytes.TrimLeft(rec, " \t\r\n")
+		start := lineNo + bytes.Count(rec[:len(rec)-len(body)], []byte{'\n'})
+		lineNo += bytes.Count(rec, []byte{'\n'})
+		if delim == '\n' {
+			lineNo++
+		}
+		if body = bytes.TrimSpace(body); len(body) > 0 {
+			var raw map[string]any
+			n := len(fc.Features)
+			if json.Unmarshal(body, &raw) == nil {
+				fc.addGeoJSON(raw, layer)
+			}
+			if len(fc.Features) == n {
+				fc.Skipped = append(fc.Skipped, start)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(fc.Features) == 0 {
+		if len(fc.Skipped) > 0 {
+			return FeatureCollection{}, errors.New("geojson seq: no valid records")
+		}
+		return FeatureCollection{}, errors.New("no geometries found")
+	}
+	return fc, nil
+}
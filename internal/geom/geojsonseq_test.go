@@ -0,0 +1,34 @@
+package geom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeGeoJSONSeq(t *testing.T) {
+	point := `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{}}`
+	pretty := "{\n  \"type\": \"Point\",\n  \"coordinates\": [3, 4]\n}"
+	tests := []struct {
+		name     string
+		in       string
+		features int
+		skipped  []int
+	}{
+		{"ndjson", point + "\n\nnot json\n" + point + "\n", 2, []int{3}},
+		{"ndjson without geometry", point + "\n{\"type\":\"Feature\",\"geometry\":null}\n{}\n", 1, []int{2, 3}},
+		{"rfc 8142", "\x1e" + point + "\n\x1e" + point + "\n", 2, nil},
+		{"rfc 8142 pretty", "\x1e" + pretty + "\n\x1e" + pretty + "\n\x1e{\n bad\n}\n", 2, []int{9}},
+		{"rfc 8142 one line", "\x1e" + point + "\x1e" + point, 2, nil},
+	}
+	for _, tt := range tests {
+		fc, err := decodeGeoJSONSeq(strings.NewReader(tt.in), "test")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(fc.Features) != tt.features || !reflect.DeepEqual(fc.Skipped, tt.skipped) {
+			t.Errorf("%s: %d features, skipped %v; want %d, %v", tt.name, len(fc.Features), fc.Skipped, tt.features, tt.skipped)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package geom
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gmlNode is an element of a feature, kept as a small tree so geometry
+// properties can be told apart from plain attributes after decoding.
+type gmlNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Children []*gmlNode
+	Text     string
+}
+
+func (n *gmlNode) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// isGML reports whether the element is in a GML namespace, bound or not.
+func (n *gmlNode) isGML() bool {
+	return strings.HasPrefix(n.Name.Space, "http://www.opengis.net/gml") || n.Name.Space == "gml"
+}
+
+// LoadGML reads a GML 2/3 feature collection, such as a WFS GetFeature
+// response. See decodeGML.
+func LoadGML(path string) (FeatureCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer f.Close()
+	return decodeGML(f)
+}
+
+// IsGML reports whether path holds GML, judged by its root element: one in
+// a GML or WFS namespace, a FeatureCollection, or one that declares the GML
+// namespace. It tells GML .xml files from other XML.
+func IsGML(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	dec := xml.NewDecoder(io.LimitReader(f, 1<<16))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(t.Name.Space, "http://www.opengis.net/") || t.Name.Local == "FeatureCollection" {
+			return true
+		}
+		for _, a := range t.Attr {
+			if strings.HasPrefix(a.Value, "http://www.opengis.net/gml") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// decodeGML parses the members of a GML feature collection (gml:featureMember,
+// gml:featureMembers or wfs:member). Each feature's layer is its element
+// name; child elements holding a GML geometry make up its geometry and the
+// remaining simple elements become properties. Points, curves, surfaces and
+// their Multi forms are read from pos, posList or GML 2 coordinates.
+func decodeGML(r io.Reader) (FeatureCollection, error) {
+	dec := xml.NewDecoder(r)
+	var fc FeatureCollection
+	srs := ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch t.Name.Local {
+		case "featureMember", "featureMembers", "member":
+		default:
+			continue
+		}
+		// every child element of a member is a feature
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return FeatureCollection{}, err
+			}
+			if _, ok := tok.(xml.EndElement); ok {
+				break
+			}
+			st, ok := tok.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			n, err := readGMLNode(dec, st)
+			if err != nil {
+				return FeatureCollection{}, err
+			}
+			f, fsrs := gmlFeature(n, &fc)
+			if srs == "" {
+				srs = fsrs
+			}
+			fc.Add(f)
+		}
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("gml: no features found")
+	}
+	if code := gmlSRID(srs); code != 0 {
+		fc.SetSRID(code)
+	} else {
+		fc.CRS = srs
+	}
+	return fc, nil
+}
+
+// readGMLNode reads the element started by st and everything inside it.
+func readGMLNode(dec *xml.Decoder, st xml.StartElement) (*gmlNode, error) {
+	n := &gmlNode{Name: st.Name, Attrs: st.Attr}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			c, err := readGMLNode(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, c)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			n.Text = strings.TrimSpace(text.String())
+			return n, nil
+		}
+	}
+}
+
+// gmlFeature converts one feature element, returning the srsName of its
+// first geometry.
+func gmlFeature(n *gmlNode, fc *FeatureCollection) (Feature, string) {
+	f := Feature{ID: n.attr("id"), Layer: n.Name.Local, Properties: map[string]any{}}
+	if f.ID == "" {
+		f.ID = n.attr("fid")
+	}
+	srs := ""
+	for _, c := range n.Children {
+		if c.isGML() && c.Name.Local == "boundedBy" {
+			continue
+		}
+		if len(c.Children) == 0 {
+			fc.addKey(c.Name.Local)
+			f.Properties[c.Name.Local] = c.Text
+			continue
+		}
+		for _, g := range c.Children {
+			if !g.isGML() {
+				continue
+			}
+			if srs == "" {
+				srs = g.attr("srsName")
+			}
+			gmlGeometry(g, &f.Geometry, gmlLatLon(g.attr("srsName")), 2)
+		}
+	}
+	f.Geometry.Type = partsType(f.Geometry)
+	return f, srs
+}
+
+// gmlGeometry appends the parts of geometry element n to out. swap is set
+// for lat/lon axis order and dim is the inherited srsDimension.
+func gmlGeometry(n *gmlNode, out *Geometry, swap bool, dim int) {
+	if s := n.attr("srsName"); s != "" {
+		swap = gmlLatLon(s)
+	}
+	if d, err := strconv.Atoi(n.attr("srsDimension")); err == nil && d > 0 {
+		dim = d
+	}
+	switch n.Name.Local {
+	case "Point":
+		out.Points = append(out.Points, gmlCoords(n, swap, dim)...)
+	case "LineString", "LineStringSegment", "Arc", "ArcString":
+		if c := gmlCoords(n, swap, dim); len(c) > 0 {
+			out.Lines = append(out.Lines, c)
+		}
+	case "LinearRing":
+		if c := gmlCoords(n, swap, dim); len(c) > 0 {
+			out.Polygons = append(out.Polygons, [][][2]float64{c})
+		}
+	case "Polygon", "PolygonPatch":
+		var poly [][][2]float64
+		for _, c := range n.Children {
+			switch c.Name.Local {
+			case "exterior", "outerBoundaryIs", "interior", "innerBoundaryIs":
+			default:
+				continue
+			}
+			var ring Geometry
+			for _, r := range c.Children {
+				gmlGeometry(r, &ring, swap, dim)
+			}
+			for _, p := range ring.Polygons {
+				poly = append(poly, p[0])
+			}
+		}
+		if len(poly) > 0 {
+			out.Polygons = append(out.Polygons, poly)
+		}
+	case "Ring":
+		// a closed ring made of curve members, joined into one
+		var parts Geometry
+		for _, c := range n.Children {
+			for _, g := range c.Children {
+				gmlGeometry(g, &parts, swap, dim)
+			}
+		}
+		var ring [][2]float64
+		for _, l := range parts.Lines {
+			ring = append(ring, l...)
+		}
+		if len(ring) > 0 {
+			out.Polygons = append(out.Polygons, [][][2]float64{ring})
+		}
+	case "Curve":
+		// the segments of a curve are drawn as one line
+		var parts Geometry
+		for _, c := range n.Children {
+			for _, g := range c.Children {
+				gmlGeometry(g, &parts, swap, dim)
+			}
+		}
+		var line [][2]float64
+		for _, l := range parts.Lines {
+			line = append(line, l...)
+		}
+		if len(line) > 0 {
+			out.Lines = append(out.Lines, line)
+		}
+	default:
+		// Multi*, Surface, CompositeCurve, members and patches: descend
+		for _, c := range n.Children {
+			gmlGeometry(c, out, swap, dim)
+		}
+	}
+}
+
+// gmlCoords reads the positions directly inside n: a posList, pos elements
+// (or pointProperty/Point members), or GML 2 coordinates / coord elements.
+func gmlCoords(n *gmlNode, swap bool, dim int) [][2]float64 {
+	var out [][2]float64
+	add := func(x, y float64) {
+		if swap {
+			x, y = y, x
+		}
+		out = append(out, [2]float64{x, y})
+	}
+	for _, c := range n.Children {
+		switch c.Name.Local {
+		case "posList", "pos":
+			d := dim
+			if v, err := strconv.Atoi(c.attr("srsDimension")); err == nil && v > 0 {
+				d = v
+			} else if v, err := strconv.Atoi(c.attr("dimension")); err == nil && v > 0 {
+				d = v
+			}
+			vals := strings.Fields(c.Text)
+			if c.Name.Local == "pos" {
+				d = len(vals)
+			}
+			for i := 0; d >= 2 && i+d <= len(vals); i += d {
+				x, err1 := strconv.ParseFloat(vals[i], 64)
+				y, err2 := strconv.ParseFloat(vals[i+1], 64)
+				if err1 == nil && err2 == nil {
+					add(x, y)
+				}
+			}
+		case "coordinates":
+			cs, ts := c.attr("cs"), c.attr("ts")
+			if cs == "" {
+				cs = ","
+			}
+			text := c.Text
+			if ts != "" && ts != " " {
+				text = strings.ReplaceAll(text, ts, " ")
+			}
+			for _, tuple := range strings.Fields(text) {
+				vals := strings.Split(tuple, cs)
+				if len(vals) < 2 {
+					continue
+				}
+				x, err1 := strconv.ParseFloat(vals[0], 64)
+				y, err2 := strconv.ParseFloat(vals[1], 64)
+				if err1 == nil && err2 == nil {
+					add(x, y)
+				}
+			}
+		case "coord":
+			var x, y string
+			for _, v := range c.Children {
+				switch v.Name.Local {
+				case "X":
+					x = v.Text
+				case "Y":
+					y = v.Text
+				}
+			}
+			xf, err1 := strconv.ParseFloat(x, 64)
+			yf, err2 := strconv.ParseFloat(y, 64)
+			if err1 == nil && err2 == nil {
+				add(xf, yf)
+			}
+		case "pointProperty", "pointMember":
+			for _, p := range c.Children {
+				out = append(out, gmlCoords(p, swap, dim)...)
+			}
+		}
+	}
+	return out
+}
+
+// gmlSRSRe extracts the EPSG code from the srsName forms in use:
+// "EPSG:4326", "urn:ogc:def:crs:EPSG::4326", ".../def/crs/EPSG/0/4326" and
+// "http://www.opengis.net/gml/srs/epsg.xml#4326".
+var gmlSRSRe = regexp.MustCompile(`(?i)epsg(?::|::|:[\d.]*:|/0/|\.xml#)(\d+)$`)
+
+func gmlSRID(srs string) int {
+	m := gmlSRSRe.FindStringSubmatch(strings.TrimSpace(srs))
+	if m == nil {
+		return 0
+	}
+	code, _ := strconv.Atoi(m[1])
+	return code
+}
+
+// gmlLatLon reports whether coordinates in srs are written latitude first.
+// The URN and URL forms of geographic EPSG codes follow the EPSG axis order;
+// the legacy "EPSG:4326" form is longitude first by convention.
+func gmlLatLon(srs string) bool {
+	if !strings.HasPrefix(srs, "urn:") && !strings.HasPrefix(srs, "http://www.opengis.net/def/") {
+		return false
+	}
+	switch gmlSRID(srs) {
+	case 4326, 4258, 4269, 4283, 4230, 4617, 4674, 4167:
+		return true
+	}
+	return false
+}
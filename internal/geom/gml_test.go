@@ -0,0 +1,31 @@
+package geom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsGML(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, data string
+		want       bool
+	}{
+		{"wfs", `<?xml version="1.0"?><wfs:FeatureCollection xmlns:wfs="http://www.opengis.net/wfs/2.0"/>`, true},
+		{"ogr", `<ogr:FeatureCollection xmlns:ogr="http://ogr.maptools.org/" xmlns:gml="http://www.opengis.net/gml"/>`, true},
+		{"gml root", `<!-- c --><gml:Point xmlns:gml="http://www.opengis.net/gml/3.2"/>`, true},
+		{"pom", `<?xml version="1.0"?><project xmlns="http://maven.apache.org/POM/4.0.0"/>`, false},
+		{"plist", `<plist version="1.0"><dict/></plist>`, false},
+		{"not xml", `hello`, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".xml")
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsGML(path); got != tt.want {
+			t.Errorf("IsGML(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package geom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goemap/internal/sqlite"
+)
+
+// gpkgLayer is one feature table registered in gpkg_geometry_columns.
+type gpkgLayer struct {
+	table  string
+	column string
+	srsID  int
+}
+
+// gpkgLayers lists the feature tables of an open GeoPackage in gpkg_contents
+// order, falling back to gpkg_geometry_columns order.
+func gpkgLayers(db *sqlite.DB) ([]gpkgLayer, error) {
+	gc, err := db.Table("gpkg_geometry_columns")
+	if err != nil {
+		return nil, errors.New("gpkg: not a GeoPackage (no gpkg_geometry_columns table)")
+	}
+	tableCol, columnCol := colIndex(gc.Columns, "table_name"), colIndex(gc.Columns, "column_name")
+	if tableCol < 0 || columnCol < 0 {
+		return nil, errors.New("gpkg: gpkg_geometry_columns lacks table_name or column_name")
+	}
+	srsCol := colIndex(gc.Columns, "srs_id")
+	var layers []gpkgLayer
+	err = db.Scan(gc, func(_ int64, row []any) error {
+		table, _ := row[tableCol].(string)
+		column, _ := row[columnCol].(string)
+		srs, _ := cell(row, srsCol).(int64)
+		if table != "" && column != "" {
+			layers = append(layers, gpkgLayer{table: table, column: column, srsID: int(srs)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// order by gpkg_contents, which is the order the producer wrote them
+	if contents, err := db.Table("gpkg_contents"); err == nil {
+		rank := map[string]int{}
+		nameCol := colIndex(contents.Columns, "table_name")
+		err := db.Scan(contents, func(rowid int64, row []any) error {
+			if name, ok := cell(row, nameCol).(string); ok {
+				rank[strings.ToLower(name)] = int(rowid)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(layers, func(i, j int) bool {
+			return rank[strings.ToLower(layers[i].table)] < rank[strings.ToLower(layers[j].table)]
+		})
+	}
+	return layers, nil
+}
+
+// colIndex returns the index of name in cols (case-insensitive), or -1.
+func colIndex(cols []string, name string) int {
+	for i, c := range cols {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// cell returns row[i], or nil when i is out of range (a missing column).
+func cell(row []any, i int) any {
+	if i < 0 || i >= len(row) {
+		return nil
+	}
+	return row[i]
+}
+
+// GeoPackageLayers returns the names of the feature tables in a GeoPackage.
+func GeoPackageLayers(path string) ([]string, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	layers, err := gpkgLayers(db)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(layers))
+	for i, l := range layers {
+		names[i] = l.table
+	}
+	return names, nil
+}
+
+// LoadGeoPackage reads one feature table from a GeoPackage; layer "" picks the
+// first. Every non-geometry column becomes a property, in table order, and the
+// feature ID is the table's rowid (its fid).
+func LoadGeoPackage(path, layer string) (FeatureCollection, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer db.Close()
+	layers, err := gpkgLayers(db)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	if len(layers) == 0 {
+		return FeatureCollection{}, errors.New("gpkg: no feature tables")
+	}
+	lyr := layers[0]
+	if layer != "" {
+		found := false
+		for _, l := range layers {
+			if strings.EqualFold(l.table, layer) {
+				lyr, found = l, true
+				break
+			}
+		}
+		if !found {
+			return FeatureCollection{}, fmt.Errorf("gpkg: no feature table %q", layer)
+		}
+	}
+	t, err := db.Table(lyr.table)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	geomCol := colIndex(t.Columns, lyr.column)
+	if geomCol < 0 {
+		return FeatureCollection{}, fmt.Errorf("gpkg: table %s has no column %s", lyr.table, lyr.column)
+	}
+	var fc FeatureCollection
+	for i, c := range t.Columns {
+		if i != geomCol && i != t.RowIDCol {
+			fc.Keys = append(fc.Keys, c)
+		}
+	}
+	err = db.Scan(t, func(rowid int64, row []any) error {
+		blob, _ := row[geomCol].([]byte)
+		if blob == nil {
+			return nil
+		}
+		g, srid, err := ParseGPKGGeometry(blob)
+		if err != nil {
+			fc.Skipped, fc.SkippedRows = append(fc.Skipped, int(rowid)), true
+			return nil
+		}
+		if srid > 0 && lyr.srsID <= 0 {
+			lyr.srsID = srid
+		}
+		props := make(map[string]any, len(fc.Keys))
+		for i, c := range t.Columns {
+			if i == geomCol || i == t.RowIDCol {
+				continue
+			}
+			v := row[i]
+			if b, ok := v.([]byte); ok {
+				v = fmt.Sprintf("<blob %d bytes>", len(b))
+			}
+			props[c] = v
+		}
+		fc.Add(Feature{ID: strconv.FormatInt(rowid, 10), Geometry: g, Properties: props, Layer: lyr.table})
+		return nil
+	})
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, fmt.Errorf("gpkg: no geometries in %s", lyr.table)
+	}
+	if err := gpkgCRS(db, &fc, lyr.srsID); err != nil {
+		return FeatureCollection{}, err
+	}
+	return fc, nil
+}
+
+// gpkgCRS records the layer's spatial reference system from
+// gpkg_spatial_ref_sys: an EPSG code when the organization is EPSG, otherwise
+// the srs_name, along with the WKT definition.
+func gpkgCRS(db *sqlite.DB, fc *FeatureCollection, srsID int) error {
+	if srsID <= 0 {
+		return nil
+	}
+	t, err := db.Table("gpkg_spatial_ref_sys")
+	if err != nil {
+		fc.SetSRID(srsID)
+		return nil
+	}
+	return db.Scan(t, func(_ int64, row []any) error {
+		if id, _ := cell(row, colIndex(t.Columns, "srs_id")).(int64); int(id) != srsID {
+			return nil
+		}
+		org, _ := cell(row, colIndex(t.Columns, "organization")).(string)
+		code, _ := cell(row, colIndex(t.Columns, "organization_coordsys_id")).(int64)
+		name, _ := cell(row, colIndex(t.Columns, "srs_name")).(string)
+		if def, _ := cell(row, colIndex(t.Columns, "definition")).(string); def != "undefined" {
+			fc.CRSWKT = def
+		}
+		if strings.EqualFold(org, "EPSG") && code > 0 {
+			fc.SetSRID(int(code))
+		} else {
+			fc.CRS = name
+		}
+		return nil
+	})
+}
+
+// ParseGPKGGeometry decodes a GeoPackage geometry blob: the "GP" header with
+// its optional envelope, followed by standard WKB. It returns the geometry and
+// the SRS id from the header.
+func ParseGPKGGeometry(b []byte) (Geometry, int, error) {
+	if len(b) < 8 || b[0] != 'G' || b[1] != 'P' {
+		return Geometry{}, 0, errors.New("gpkg: bad geometry header")
+	}
+	flags := b[3]
+	var order binary.ByteOrder = binary.BigEndian
+	if flags&1 != 0 {
+		order = binary.LittleEndian
+	}
+	srid := int(int32(order.Uint32(b[4:8])))
+	envelope := map[byte]int{0: 0, 1: 32, 2: 48, 3: 48, 4: 64}
+	n, ok := envelope[(flags>>1)&7]
+	if !ok {
+		return Geometry{}, 0, fmt.Errorf("gpkg: invalid envelope code %d", (flags>>1)&7)
+	}
+	if len(b) < 8+n {
+		return Geometry{}, 0, errors.New("gpkg: truncated envelope")
+	}
+	if flags&0x10 != 0 {
+		// empty geometry flag
+		return Geometry{}, srid, nil
+	}
+	g, _, err := ParseWKB(b[8+n:])
+	return g, srid, err
+}
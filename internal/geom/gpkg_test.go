@@ -0,0 +1,181 @@
+package geom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixture.gpkg is written by testdata/mkgpkg.py.
+const gpkgFixture = "testdata/fixture.gpkg"
+
+func TestGeoPackageLayers(t *testing.T) {
+	got, err := GeoPackageLayers(gpkgFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gpkg_contents order, not gpkg_geometry_columns order
+	if want := []string{"roads", "places", "lakes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("layers = %q, want %q", got, want)
+	}
+}
+
+func TestLoadGeoPackage(t *testing.T) {
+	tests := []struct {
+		layer    string
+		features int
+		keys     []string
+		srid     int
+		crs      string
+		wkt      string
+		skipped  []int
+		check    func(t *testing.T, fc FeatureCollection)
+	}{
+		{
+			layer:    "",
+			features: 1,
+			keys:     []string{"ref"},
+			srid:     27700,
+			crs:      "EPSG:27700",
+			wkt:      `PROJCS["OSGB36 / British National Grid"]`,
+			check: func(t *testing.T, fc FeatureCollection) {
+				f := fc.Features[0]
+				if f.Layer != "roads" || f.ID != "1" || f.Properties["ref"] != "A1" {
+					t.Errorf("feature = %+v", f)
+				}
+				if g := f.Geometry; g.Type != "LineString" || len(g.Lines) != 1 || len(g.Lines[0]) != 3 {
+					t.Errorf("geometry = %+v", g)
+				}
+				if want := (BBox{MinX: 530000, MinY: 180000, MaxX: 532000, MaxY: 181500}); fc.BBox != want {
+					t.Errorf("bbox = %+v, want %+v", fc.BBox, want)
+				}
+			},
+		},
+		{
+			// interior pages, a rowid alias, an unreadable geometry, a NULL
+			// geometry and rows written before ALTER TABLE ADD COLUMN
+			layer:    "PLACES",
+			features: 301,
+			keys:     []string{"name", "pop", "note"},
+			srid:     4326,
+			crs:      "EPSG:4326",
+			skipped:  []int{302},
+			check: func(t *testing.T, fc FeatureCollection) {
+				first, last := fc.Features[0], fc.Features[300]
+				if first.ID != "1" || first.Properties["name"] != "place-1" || first.Properties["pop"] != int64(100) {
+					t.Errorf("first feature = %+v", first)
+				}
+				if v, ok := first.Properties["note"]; !ok || v != nil {
+					t.Errorf("note before ADD COLUMN = %v, %v, want nil", v, ok)
+				}
+				if last.ID != "303" || last.Properties["note"] != "added" {
+					t.Errorf("last feature = %+v", last)
+				}
+				if _, ok := first.Properties["fid"]; ok {
+					t.Error("rowid alias fid is a property")
+				}
+				if p := fc.Features[149].Geometry.Points; len(p) != 1 || p[0] != [2]float64{15, -7.5} {
+					t.Errorf("feature 150 point = %v", p)
+				}
+				if !fc.SkippedRows {
+					t.Error("SkippedRows not set")
+				}
+			},
+		},
+		{
+			// a ring larger than a page, on overflow pages
+			layer:    "lakes",
+			features: 1,
+			keys:     []string{"name"},
+			crs:      "Local grid",
+			check: func(t *testing.T, fc FeatureCollection) {
+				g := fc.Features[0].Geometry
+				if g.Type != "Polygon" || len(g.Polygons) != 1 || len(g.Polygons[0][0]) != 501 {
+					t.Fatalf("geometry = %s with %d polygons", g.Type, len(g.Polygons))
+				}
+				if fc.BBox.MaxX != 100 || fc.BBox.MinX > -99.99 {
+					t.Errorf("bbox = %+v", fc.BBox)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layer, func(t *testing.T) {
+			fc, err := LoadGeoPackage(gpkgFixture, tt.layer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fc.Features) != tt.features {
+				t.Fatalf("%d features, want %d", len(fc.Features), tt.features)
+			}
+			if !reflect.DeepEqual(fc.Keys, tt.keys) {
+				t.Errorf("keys = %q, want %q", fc.Keys, tt.keys)
+			}
+			if fc.SRID != tt.srid || fc.CRS != tt.crs || fc.CRSWKT != tt.wkt {
+				t.Errorf("crs = %d %q %q, want %d %q %q", fc.SRID, fc.CRS, fc.CRSWKT, tt.srid, tt.crs, tt.wkt)
+			}
+			if !reflect.DeepEqual(fc.Skipped, tt.skipped) {
+				t.Errorf("skipped = %v, want %v", fc.Skipped, tt.skipped)
+			}
+			tt.check(t, fc)
+		})
+	}
+}
+
+func TestLoadGeoPackageErrors(t *testing.T) {
+	tests := []struct {
+		path, layer, want string
+	}{
+		{gpkgFixture, "rivers", `no feature table "rivers"`},
+		{"../sqlite/testdata/fixture.sqlite", "", "not a GeoPackage"},
+		{"testdata/missing.gpkg", "", "no such file"},
+	}
+	for _, tt := range tests {
+		_, err := LoadGeoPackage(tt.path, tt.layer)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadGeoPackage(%s, %q) error = %v, want %q", tt.path, tt.layer, err, tt.want)
+		}
+	}
+}
+
+func TestParseGPKGGeometry(t *testing.T) {
+	wkb := []byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0, 0, 0, 0, 0, 0, 0, 0x40}
+	tests := []struct {
+		name    string
+		blob    []byte
+		typ     string
+		srid    int
+		wantErr bool
+	}{
+		{"no envelope", append([]byte{'G', 'P', 0, 0x01, 0xe6, 0x10, 0, 0}, wkb...), "Point", 4326, false},
+		{"big-endian srid", append([]byte{'G', 'P', 0, 0x00, 0, 0, 0x6c, 0x34}, wkb...), "Point", 27700, false},
+		{"xy envelope", append(append([]byte{'G', 'P', 0, 0x03, 0xe6, 0x10, 0, 0}, make([]byte, 32)...), wkb...), "Point", 4326, false},
+		{"empty flag", []byte{'G', 'P', 0, 0x11, 0xe6, 0x10, 0, 0}, "", 4326, false},
+		{"bad magic", append([]byte{'X', 'P', 0, 0x01, 0, 0, 0, 0}, wkb...), "", 0, true},
+		{"bad envelope code", []byte{'G', 'P', 0, 0x0b, 0, 0, 0, 0}, "", 0, true},
+		{"truncated envelope", []byte{'G', 'P', 0, 0x03, 0, 0, 0, 0, 1, 2}, "", 0, true},
+	}
+	for _, tt := range tests {
+		g, srid, err := ParseGPKGGeometry(tt.blob)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if err == nil && (g.Type != tt.typ || srid != tt.srid) {
+			t.Errorf("%s: got %s srid %d, want %s %d", tt.name, g.Type, srid, tt.typ, tt.srid)
+		}
+	}
+}
+
+func TestColIndex(t *testing.T) {
+	cols := []string{"fid", "Geom", "name"}
+	for name, want := range map[string]int{"fid": 0, "geom": 1, "NAME": 2, "missing": -1} {
+		if got := colIndex(cols, name); got != want {
+			t.Errorf("colIndex(%q) = %d, want %d", name, got, want)
+		}
+	}
+	row := []any{int64(1), nil}
+	if cell(row, -1) != nil || cell(row, 2) != nil || cell(row, 0) != int64(1) {
+		t.Error("cell does not guard out-of-range indexes")
+	}
+}
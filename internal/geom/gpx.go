@@ -0,0 +1,122 @@
+package geom
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+)
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+	Name string   `xml:"name"`
+	Desc string   `xml:"desc"`
+	Type string   `xml:"type"`
+}
+
+type gpxMeta struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc"`
+	Type string `xml:"type"`
+}
+
+type gpxDoc struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []struct {
+		gpxMeta
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		gpxMeta
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// LoadGPX reads a GPX file: each trk becomes a (multi) line string with one
+// part per trkseg, each rte a line string and each wpt a point. name, desc and
+// type become properties; elevation and time are kept per point in the "ele"
+// and "time" properties (arrays aligned with the vertices for tracks/routes).
+func LoadGPX(path string) (FeatureCollection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	return decodeGPX(data)
+}
+
+// decodeGPX parses a GPX document (see LoadGPX).
+func decodeGPX(data []byte) (FeatureCollection, error) {
+	var doc gpxDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return FeatureCollection{}, err
+	}
+	fc := FeatureCollection{Keys: []string{"name", "desc", "type", "ele", "time"}}
+	meta := func(m gpxMeta) map[string]any {
+		return map[string]any{
+			"name": strings.TrimSpace(m.Name),
+			"desc": strings.TrimSpace(m.Desc),
+			"type": strings.TrimSpace(m.Type),
+		}
+	}
+	// series collects the vertices of pts plus their elevation/time values.
+	series := func(pts []gpxPoint, props map[string]any) [][2]float64 {
+		ls := make([][2]float64, 0, len(pts))
+		eles, _ := props["ele"].([]any)
+		times, _ := props["time"].([]any)
+		for _, p := range pts {
+			ls = append(ls, [2]float64{p.Lon, p.Lat})
+			eles = append(eles, gpxEle(p))
+			times = append(times, gpxTime(p))
+		}
+		props["ele"], props["time"] = eles, times
+		return ls
+	}
+	for _, t := range doc.Tracks {
+		props := meta(t.gpxMeta)
+		var g Geometry
+		for _, seg := range t.Segments {
+			if len(seg.Points) > 0 {
+				g.Lines = append(g.Lines, series(seg.Points, props))
+			}
+		}
+		g.Type = partsType(g)
+		fc.Add(Feature{Geometry: g, Properties: props, Layer: "tracks"})
+	}
+	for _, r := range doc.Routes {
+		props := meta(r.gpxMeta)
+		var g Geometry
+		if len(r.Points) > 0 {
+			g = Geometry{Type: "LineString", Lines: [][][2]float64{series(r.Points, props)}}
+		}
+		fc.Add(Feature{Geometry: g, Properties: props, Layer: "routes"})
+	}
+	for _, w := range doc.Waypoints {
+		props := meta(gpxMeta{Name: w.Name, Desc: w.Desc, Type: w.Type})
+		props["ele"], props["time"] = gpxEle(w), gpxTime(w)
+		g := Geometry{Type: "Point", Points: [][2]float64{{w.Lon, w.Lat}}}
+		fc.Add(Feature{Geometry: g, Properties: props, Layer: "waypoints"})
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("gpx: no tracks, routes or waypoints found")
+	}
+	return fc, nil
+}
+
+func gpxEle(p gpxPoint) any {
+	if p.Ele == nil {
+		return nil
+	}
+	return *p.Ele
+}
+
+func gpxTime(p gpxPoint) any {
+	if t := strings.TrimSpace(p.Time); t != "" {
+		return t
+	}
+	return nil
+}
@@ -5,78 +5,235 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-// LoadKML extracts Point coordinates from a KML file (Placemark > Point > coordinates).
-// KML coordinates are "lon,lat[,alt]"; we ignore altitude.
-func LoadKML(path string) (points [][2]float64, bbox BBox, err error) {
+type kmlCoords struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer kmlCoords   `xml:"outerBoundaryIs>LinearRing"`
+	Inner []kmlCoords `xml:"innerBoundaryIs>LinearRing"`
+}
+
+// kmlGeometry matches any geometry element that can appear in a Placemark or
+// nested inside a MultiGeometry.
+type kmlGeometry struct {
+	Point      []kmlCoords   `xml:"Point"`
+	LineString []kmlCoords   `xml:"LineString"`
+	LinearRing []kmlCoords   `xml:"LinearRing"`
+	Polygon    []kmlPolygon  `xml:"Polygon"`
+	Multi      []kmlGeometry `xml:"MultiGeometry"`
+}
+
+type kmlPlacemark struct {
+	ID          string `xml:"id,attr"`
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	kmlGeometry
+	ExtendedData struct {
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"Data"`
+		SchemaData []struct {
+			SimpleData []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"SimpleData"`
+		} `xml:"SchemaData"`
+	} `xml:"ExtendedData"`
+}
+
+// LoadKML reads Placemarks from a KML file, walking nested Document and
+// Folder elements. Points, LineStrings, LinearRings, Polygons (with holes) and
+// MultiGeometry are supported; KML coordinates are "lon,lat[,alt]" and we
+// ignore altitude.
+func LoadKML(path string) (FeatureCollection, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, BBox{}, err
+		return FeatureCollection{}, err
 	}
 	defer f.Close()
-	data, err := io.ReadAll(f)
-	if err != nil {
-		return nil, BBox{}, err
-	}
+	return decodeKML(f, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
 
-	type kmlPoint struct {
-		Coordinates string `xml:"coordinates"`
-	}
-	type kmlPlacemark struct {
-		Point *kmlPoint `xml:"Point"`
+// decodeKML parses KML from r. Each Placemark becomes a feature whose layer is
+// the slash-joined path of its enclosing Document/Folder names, or fallback
+// when it has none. name, description and ExtendedData become properties.
+func decodeKML(r io.Reader, fallback string) (FeatureCollection, error) {
+	dec := xml.NewDecoder(r)
+	fc := FeatureCollection{Keys: []string{"name", "description"}}
+	// element stack of local names, and the names of enclosing containers
+	var stack []string
+	var containers []string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			switch t.Name.Local {
+			case "Document", "Folder":
+				containers = append(containers, "")
+			case "name":
+				if parent == "Document" || parent == "Folder" {
+					var name string
+					if err := dec.DecodeElement(&name, &t); err != nil {
+						return FeatureCollection{}, err
+					}
+					containers[len(containers)-1] = strings.TrimSpace(name)
+					continue
+				}
+			case "Placemark":
+				var pm kmlPlacemark
+				if err := dec.DecodeElement(&pm, &t); err != nil {
+					return FeatureCollection{}, err
+				}
+				layer := kmlLayer(containers, fallback)
+				props := map[string]any{"name": strings.TrimSpace(pm.Name), "description": strings.TrimSpace(pm.Description)}
+				for _, d := range pm.ExtendedData.Data {
+					fc.addKey(d.Name)
+					props[d.Name] = strings.TrimSpace(d.Value)
+				}
+				for _, sd := range pm.ExtendedData.SchemaData {
+					for _, d := range sd.SimpleData {
+						fc.addKey(d.Name)
+						props[d.Name] = strings.TrimSpace(d.Value)
+					}
+				}
+				fc.Add(Feature{ID: pm.ID, Geometry: pm.kmlGeometry.toGeometry(), Properties: props, Layer: layer})
+				continue
+			}
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			if top := stack[len(stack)-1]; top == "Document" || top == "Folder" {
+				containers = containers[:len(containers)-1]
+			}
+			stack = stack[:len(stack)-1]
+		}
 	}
-	type kmlDoc struct {
-		Placemarks []kmlPlacemark `xml:"Placemark"`
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("kml: no geometries found")
 	}
+	return fc, nil
+}
 
-	var doc kmlDoc
-	if err := xml.Unmarshal(data, &doc); err != nil {
-		return nil, BBox{}, err
+// kmlLayer joins the non-empty container names, or returns fallback.
+func kmlLayer(containers []string, fallback string) string {
+	var parts []string
+	for _, c := range containers {
+		if c != "" {
+			parts = append(parts, c)
+		}
+	}
+	if len(parts) == 0 {
+		return fallback
 	}
-	add := func(lon, lat float64) {
-		pt := [2]float64{lon, lat}
-		points = append(points, pt)
-		if len(points) == 1 {
-			bbox = BBox{MinX: lon, MinY: lat, MaxX: lon, MaxY: lat}
-		} else {
-			if lon < bbox.MinX {
-				bbox.MinX = lon
+	return strings.Join(parts, "/")
+}
+
+// toGeometry flattens g (including nested MultiGeometry) into one Geometry,
+// naming it after the kinds of parts it holds.
+func (g kmlGeometry) toGeometry() Geometry {
+	var out Geometry
+	var add func(g kmlGeometry)
+	add = func(g kmlGeometry) {
+		for _, p := range g.Point {
+			out.Points = append(out.Points, parseKMLCoords(p.Coordinates)...)
+		}
+		for _, ls := range g.LineString {
+			if c := parseKMLCoords(ls.Coordinates); len(c) > 0 {
+				out.Lines = append(out.Lines, c)
 			}
-			if lat < bbox.MinY {
-				bbox.MinY = lat
+		}
+		for _, lr := range g.LinearRing {
+			if c := parseKMLCoords(lr.Coordinates); len(c) > 0 {
+				out.Polygons = append(out.Polygons, [][][2]float64{c})
 			}
-			if lon > bbox.MaxX {
-				bbox.MaxX = lon
+		}
+		for _, pg := range g.Polygon {
+			outer := parseKMLCoords(pg.Outer.Coordinates)
+			if len(outer) == 0 {
+				continue
 			}
-			if lat > bbox.MaxY {
-				bbox.MaxY = lat
+			poly := [][][2]float64{outer}
+			for _, in := range pg.Inner {
+				if c := parseKMLCoords(in.Coordinates); len(c) > 0 {
+					poly = append(poly, c)
+				}
 			}
+			out.Polygons = append(out.Polygons, poly)
 		}
+		for _, m := range g.Multi {
+			add(m)
+		}
+	}
+	add(g)
+	out.Type = partsType(out)
+	return out
+}
+
+// partsType names a geometry after the parts it holds: Point/MultiPoint,
+// LineString/MultiLineString, Polygon/MultiPolygon, or GeometryCollection
+// when kinds are mixed.
+func partsType(g Geometry) string {
+	kinds := 0
+	t := ""
+	if n := len(g.Points); n > 0 {
+		kinds++
+		t = multi("Point", n)
+	}
+	if n := len(g.Lines); n > 0 {
+		kinds++
+		t = multi("LineString", n)
+	}
+	if n := len(g.Polygons); n > 0 {
+		kinds++
+		t = multi("Polygon", n)
 	}
-	for _, pm := range doc.Placemarks {
-		if pm.Point == nil {
+	if kinds > 1 {
+		return "GeometryCollection"
+	}
+	return t
+}
+
+func multi(t string, n int) string {
+	if n > 1 {
+		return "Multi" + t
+	}
+	return t
+}
+
+// parseKMLCoords parses a KML coordinates string: whitespace separated
+// "lon,lat[,alt]" tuples.
+func parseKMLCoords(s string) [][2]float64 {
+	var out [][2]float64
+	for _, tuple := range strings.Fields(s) {
+		vals := strings.Split(tuple, ",")
+		if len(vals) < 2 {
 			continue
 		}
-		// coordinates may contain multiple tuples separated by spaces
-		parts := strings.Fields(pm.Point.Coordinates)
-		for _, tuple := range parts {
-			vals := strings.Split(tuple, ",")
-			if len(vals) < 2 {
-				continue
-			}
-			lon, err1 := strconv.ParseFloat(strings.TrimSpace(vals[0]), 64)
-			lat, err2 := strconv.ParseFloat(strings.TrimSpace(vals[1]), 64)
-			if err1 != nil || err2 != nil {
-				continue
-			}
-			add(lon, lat)
+		lon, err1 := strconv.ParseFloat(strings.TrimSpace(vals[0]), 64)
+		lat, err2 := strconv.ParseFloat(strings.TrimSpace(vals[1]), 64)
+		if err1 != nil || err2 != nil {
+			continue
 		}
+		out = append(out, [2]float64{lon, lat})
 	}
-	if len(points) == 0 {
-		return nil, BBox{}, errors.New("kml: no points found")
-	}
-	return points, bbox, nil
+	return out
 }
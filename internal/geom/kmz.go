@@ -0,0 +1,46 @@
+package geom
+
+import (
+	"archive/zip"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// LoadKMZ opens a KMZ (zipped KML) archive and parses its doc.kml, or the
+// first .kml entry when there is no doc.kml. Embedded resources such as icons
+// and overlays are ignored.
+func LoadKMZ(path string) (FeatureCollection, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer zr.Close()
+	return decodeKMZ(&zr.Reader, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// decodeKMZ parses the KML document of an open archive (see LoadKMZ).
+func decodeKMZ(zr *zip.Reader, fallback string) (FeatureCollection, error) {
+	var doc *zip.File
+	for _, f := range zr.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".kml") {
+			continue
+		}
+		if strings.EqualFold(f.Name, "doc.kml") {
+			doc = f
+			break
+		}
+		if doc == nil {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return FeatureCollection{}, errors.New("kmz: no .kml document in archive")
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer rc.Close()
+	return decodeKML(rc, fallback)
+}
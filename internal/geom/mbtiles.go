@@ -0,0 +1,255 @@
+package geom
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"goemap/internal/sqlite"
+)
+
+// MBTiles is an open .mbtiles tileset. Tile addresses are indexed when the
+// file is opened; tile data is read and decoded on demand.
+type MBTiles struct {
+	db       *sqlite.DB
+	Metadata [][2]string // name/value rows of the metadata table, in order
+	Format   string      // "pbf" for vector tiles, or an image format
+	Bounds   BBox
+	MinZoom  int
+	MaxZoom  int
+	Counts   map[int]int // tiles per zoom level
+
+	data    sqlite.Table // table holding tile_data: tiles, or images
+	dataCol int
+	index   map[TileID]int64 // rowid of each tile's data row
+}
+
+// OpenMBTiles opens a tileset and indexes its tiles. Both the flat "tiles"
+// table and the deduplicated map/images layout are supported.
+func OpenMBTiles(path string) (*MBTiles, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &MBTiles{db: db, Counts: map[int]int{}, index: map[TileID]int64{}, MinZoom: -1}
+	if err := t.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close closes the underlying file.
+func (t *MBTiles) Close() error { return t.db.Close() }
+
+func (t *MBTiles) load() error {
+	if md, err := t.db.Table("metadata"); err == nil {
+		nameCol, valueCol := colIndex(md.Columns, "name"), colIndex(md.Columns, "value")
+		err = t.db.Scan(md, func(_ int64, row []any) error {
+			name, _ := cell(row, nameCol).(string)
+			value := fmt.Sprint(cell(row, valueCol))
+			t.Metadata = append(t.Metadata, [2]string{name, value})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	t.Format = t.meta("format")
+	// tiles is usually a table, but a view over map and images in
+	// deduplicated tilesets
+	if tiles, err := t.db.Table("tiles"); err == nil {
+		t.data = tiles
+		t.dataCol = colIndex(tiles.Columns, "tile_data")
+		if t.dataCol < 0 {
+			return errors.New("mbtiles: tiles has no tile_data column")
+		}
+		err = t.db.ScanColumns(tiles, t.dataCol, func(rowid int64, row []any) error {
+			t.addTile(row, tiles.Columns, rowid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else if err := t.loadDedup(); err != nil {
+		return err
+	}
+	if len(t.index) == 0 {
+		return errors.New("mbtiles: no tiles")
+	}
+	t.Bounds = BBox{MinX: -180, MinY: -85.0511, MaxX: 180, MaxY: 85.0511}
+	if b := strings.Split(t.meta("bounds"), ","); len(b) == 4 {
+		var v [4]float64
+		ok := true
+		for i, s := range b {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			v[i], ok = f, ok && err == nil
+		}
+		if ok && v[2] > v[0] && v[3] > v[1] {
+			t.Bounds = BBox{MinX: v[0], MinY: v[1], MaxX: v[2], MaxY: v[3]}
+		}
+	}
+	if t.Format == "" {
+		t.Format = "pbf"
+	}
+	return nil
+}
+
+// loadDedup indexes the map/images layout: map rows give each address a
+// tile_id, and images rows hold the data for each tile_id.
+func (t *MBTiles) loadDedup() error {
+	m, err := t.db.Table("map")
+	if err != nil {
+		return errors.New("mbtiles: no tiles table")
+	}
+	images, err := t.db.Table("images")
+	if err != nil {
+		return errors.New("mbtiles: no images table")
+	}
+	t.data = images
+	t.dataCol = colIndex(images.Columns, "tile_data")
+	idCol := colIndex(images.Columns, "tile_id")
+	mapID := colIndex(m.Columns, "tile_id")
+	if t.dataCol < 0 || idCol < 0 || mapID < 0 {
+		return errors.New("mbtiles: map or images lacks tile_id or tile_data")
+	}
+	rows := map[string]int64{}
+	// tile_id usually follows the blob, so the data has to be read once
+	err = t.db.Scan(images, func(rowid int64, row []any) error {
+		rows[fmt.Sprint(row[idCol])] = rowid
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return t.db.Scan(m, func(_ int64, row []any) error {
+		if rowid, ok := rows[fmt.Sprint(row[mapID])]; ok {
+			t.addTile(row, m.Columns, rowid)
+		}
+		return nil
+	})
+}
+
+// addTile indexes one row of tiles or map. MBTiles rows count from the
+// bottom (TMS), so tile_row is flipped to the XYZ y.
+func (t *MBTiles) addTile(row []any, cols []string, rowid int64) {
+	z, _ := cell(row, colIndex(cols, "zoom_level")).(int64)
+	x, _ := cell(row, colIndex(cols, "tile_column")).(int64)
+	y, _ := cell(row, colIndex(cols, "tile_row")).(int64)
+	if z < 0 || z > 30 {
+		return
+	}
+	id := TileID{Z: int(z), X: int(x), Y: int(1<<z - 1 - y)}
+	t.index[id] = rowid
+	t.Counts[id.Z]++
+	if t.MinZoom < 0 || id.Z < t.MinZoom {
+		t.MinZoom = id.Z
+	}
+	t.MaxZoom = max(t.MaxZoom, id.Z)
+}
+
+func (t *MBTiles) meta(name string) string {
+	for _, kv := range t.Metadata {
+		if kv[0] == name {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// Zooms returns the zoom levels present, ascending.
+func (t *MBTiles) Zooms() []int {
+	zs := make([]int, 0, len(t.Counts))
+	for z := range t.Counts {
+		zs = append(zs, z)
+	}
+	sort.Ints(zs)
+	return zs
+}
+
+// Tile returns the raw data of one tile, or nil when the tileset lacks it.
+func (t *MBTiles) Tile(id TileID) ([]byte, error) {
+	rowid, ok := t.index[id]
+	if !ok {
+		return nil, nil
+	}
+	row, err := t.db.Row(t.data, rowid)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	b, _ := cell(row, t.dataCol).([]byte)
+	return b, nil
+}
+
+// ZoomFor picks the zoom level at which about tilesAcross tiles span the
+// width of bb, clamped to the zoom levels in the tileset.
+func (t *MBTiles) ZoomFor(bb BBox, tilesAcross float64) int {
+	span := bb.MaxX - bb.MinX
+	z := t.MinZoom
+	if span > 0 {
+		z = int(math.Floor(math.Log2(360 / span * tilesAcross)))
+	}
+	return min(max(z, t.MinZoom), t.MaxZoom)
+}
+
+// TilesIn lists the tile addresses at zoom z that cover bb.
+func TilesIn(bb BBox, z int) []TileID {
+	n := 1 << z
+	x0, y0 := lonLatTile(bb.MinX, bb.MaxY, z)
+	x1, y1 := lonLatTile(bb.MaxX, bb.MinY, z)
+	var ids []TileID
+	for y := max(y0, 0); y <= min(y1, n-1); y++ {
+		for x := max(x0, 0); x <= min(x1, n-1); x++ {
+			ids = append(ids, TileID{Z: z, X: x, Y: y})
+		}
+	}
+	return ids
+}
+
+// lonLatTile returns the XYZ tile at zoom z containing lon/lat.
+func lonLatTile(lon, lat float64, z int) (int, int) {
+	lat = math.Max(-85.0511, math.Min(85.0511, lat))
+	n := math.Exp2(float64(z))
+	x := (lon + 180) / 360 * n
+	r := lat * math.Pi / 180
+	y := (1 - math.Log(math.Tan(r)+1/math.Cos(r))/math.Pi) / 2 * n
+	return int(math.Floor(x)), int(math.Floor(y))
+}
+
+// Query decodes the vector tiles at zoom z covering bb, stepping z down while
+// more than maxTiles would be needed. It returns the features and the zoom
+// actually used.
+func (t *MBTiles) Query(bb BBox, z, maxTiles int) (FeatureCollection, int, error) {
+	if t.Format != "pbf" && t.Format != "mvt" {
+		return FeatureCollection{}, z, fmt.Errorf("mbtiles: %s raster tiles cannot be drawn", t.Format)
+	}
+	ids := TilesIn(bb, z)
+	for len(ids) > maxTiles && z > t.MinZoom {
+		z--
+		ids = TilesIn(bb, z)
+	}
+	var fc FeatureCollection
+	for _, id := range ids {
+		data, err := t.Tile(id)
+		if err != nil {
+			return FeatureCollection{}, z, err
+		}
+		if data == nil {
+			continue
+		}
+		tile, err := DecodeMVT(data, &id)
+		if err != nil {
+			// empty tiles are common; skip them rather than failing the view
+			continue
+		}
+		for _, f := range tile.Features {
+			f.ID = id.String() + "#" + f.ID
+			fc.Add(f)
+		}
+	}
+	fc.SetSRID(4326)
+	return fc, z, nil
+}
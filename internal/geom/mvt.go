@@ -0,0 +1,303 @@
+package geom
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TileID addresses an XYZ (slippy map) tile.
+type TileID struct {
+	Z, X, Y int
+}
+
+func (t TileID) String() string { return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y) }
+
+// ParseTileID parses "z/x/y".
+func ParseTileID(s string) (TileID, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 3 {
+		return TileID{}, fmt.Errorf("tile: expected z/x/y, got %q", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return TileID{}, fmt.Errorf("tile: expected z/x/y, got %q", s)
+		}
+		v[i] = n
+	}
+	t := TileID{Z: v[0], X: v[1], Y: v[2]}
+	if t.Z > 30 || t.X >= 1<<t.Z || t.Y >= 1<<t.Z {
+		return TileID{}, fmt.Errorf("tile: %s is out of range", t)
+	}
+	return t, nil
+}
+
+// tilePathRe matches a z/x/y tile address at the end of a path, written with
+// directories as tile servers lay them out or joined by '-' or '_'.
+var tilePathRe = regexp.MustCompile(`(\d{1,2})[/\\_-](\d+)[/\\_-](\d+)(?:\.[A-Za-z.]+)?$`)
+
+// TileFromPath extracts a tile address from paths such as "tiles/14/8185/5448.mvt"
+// or "14-8185-5448.pbf".
+func TileFromPath(path string) (TileID, bool) {
+	m := tilePathRe.FindStringSubmatch(filepath.ToSlash(path))
+	if m == nil {
+		return TileID{}, false
+	}
+	t, err := ParseTileID(m[1] + "/" + m[2] + "/" + m[3])
+	return t, err == nil
+}
+
+// LoadMVT reads a Mapbox Vector Tile, gzip-compressed or not. When tile is
+// nil the address is taken from the path, and failing that coordinates are
+// left in tile-local units (with y pointing up).
+func LoadMVT(path string, tile *TileID) (FeatureCollection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	if tile == nil {
+		if t, ok := TileFromPath(path); ok {
+			tile = &t
+		}
+	}
+	return DecodeMVT(data, tile)
+}
+
+// DecodeMVT decodes a vector tile. Every MVT layer's features keep the layer
+// name, so each can be toggled on its own, and their tags become properties.
+// Coordinates are converted to lon/lat from tile when given.
+func DecodeMVT(data []byte, tile *TileID) (FeatureCollection, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return FeatureCollection{}, fmt.Errorf("mvt: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return FeatureCollection{}, fmt.Errorf("mvt: %w", err)
+		}
+	}
+	var fc FeatureCollection
+	p := &pbReader{b: data}
+	for p.next() {
+		if p.field != 3 {
+			p.skip()
+			continue
+		}
+		if err := fc.addMVTLayer(p.bytes(), tile); err != nil {
+			return FeatureCollection{}, err
+		}
+	}
+	if p.err != nil {
+		return FeatureCollection{}, fmt.Errorf("mvt: %w", p.err)
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("mvt: no features found")
+	}
+	if tile != nil {
+		fc.SetSRID(4326)
+	}
+	return fc, nil
+}
+
+type mvtFeature struct {
+	id       uint64
+	hasID    bool
+	tags     []uint64
+	typ      uint64
+	geometry []uint64
+}
+
+func (fc *FeatureCollection) addMVTLayer(data []byte, tile *TileID) error {
+	var name string
+	var keys []string
+	var values []any
+	var feats [][]byte
+	extent := 4096.0
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			name = string(p.bytes())
+		case 2:
+			feats = append(feats, p.bytes())
+		case 3:
+			keys = append(keys, string(p.bytes()))
+		case 4:
+			values = append(values, mvtValue(p.bytes()))
+		case 5:
+			extent = float64(p.varint())
+		default:
+			p.skip()
+		}
+	}
+	if p.err != nil {
+		return fmt.Errorf("mvt: layer %q: %w", name, p.err)
+	}
+	if extent <= 0 {
+		extent = 4096
+	}
+	// tile-local (x, y) to output coordinates
+	project := func(x, y int64) [2]float64 {
+		if tile == nil {
+			return [2]float64{float64(x), -float64(y)}
+		}
+		return tileLonLat(*tile, float64(x)/extent, float64(y)/extent)
+	}
+	for _, b := range feats {
+		var f mvtFeature
+		fp := &pbReader{b: b}
+		for fp.next() {
+			switch fp.field {
+			case 1:
+				f.id, f.hasID = fp.varint(), true
+			case 2:
+				f.tags = fp.packed()
+			case 3:
+				f.typ = fp.varint()
+			case 4:
+				f.geometry = fp.packed()
+			default:
+				fp.skip()
+			}
+		}
+		if fp.err != nil {
+			return fmt.Errorf("mvt: layer %q: %w", name, fp.err)
+		}
+		props := map[string]any{}
+		for i := 0; i+1 < len(f.tags); i += 2 {
+			k, v := f.tags[i], f.tags[i+1]
+			if k < uint64(len(keys)) && v < uint64(len(values)) {
+				props[keys[k]] = values[v]
+			}
+		}
+		feat := Feature{Geometry: mvtGeometry(f.typ, f.geometry, project), Properties: props, Layer: name}
+		if f.hasID {
+			feat.ID = strconv.FormatUint(f.id, 10)
+		}
+		fc.Add(feat)
+	}
+	return nil
+}
+
+// mvtValue decodes a layer Value message.
+func mvtValue(b []byte) any {
+	p := &pbReader{b: b}
+	var v any
+	for p.next() {
+		switch p.field {
+		case 1:
+			v = string(p.bytes())
+		case 2:
+			v = float64(math.Float32frombits(p.fixed32()))
+		case 3:
+			v = math.Float64frombits(p.fixed64())
+		case 4:
+			v = int64(p.varint())
+		case 5:
+			v = p.varint()
+		case 6:
+			v = p.sint()
+		case 7:
+			v = p.varint() != 0
+		default:
+			p.skip()
+		}
+	}
+	return v
+}
+
+// mvtGeometry runs the MoveTo/LineTo/ClosePath command stream of a feature.
+// Polygon rings with positive area in tile space (clockwise on screen) start
+// a new polygon; the following negative rings are its holes.
+func mvtGeometry(typ uint64, cmds []uint64, project func(x, y int64) [2]float64) Geometry {
+	var parts [][][2]float64
+	var raw [][][2]int64
+	var x, y int64
+	var ring [][2]int64
+	flush := func() {
+		if len(ring) > 0 {
+			raw = append(raw, ring)
+		}
+		ring = nil
+	}
+	for i := 0; i < len(cmds); {
+		id, count := cmds[i]&7, int(cmds[i]>>3)
+		i++
+		switch id {
+		case 1, 2: // MoveTo, LineTo
+			for k := 0; k < count && i+1 < len(cmds); k++ {
+				x += unzigzag(cmds[i])
+				y += unzigzag(cmds[i+1])
+				i += 2
+				if id == 1 && typ != 1 {
+					flush()
+				}
+				ring = append(ring, [2]int64{x, y})
+			}
+		case 7: // ClosePath
+			if len(ring) > 0 {
+				ring = append(ring, ring[0])
+			}
+		default:
+			i = len(cmds)
+		}
+	}
+	flush()
+	for _, r := range raw {
+		pts := make([][2]float64, len(r))
+		for k, q := range r {
+			pts[k] = project(q[0], q[1])
+		}
+		parts = append(parts, pts)
+	}
+	var g Geometry
+	switch typ {
+	case 1:
+		for _, p := range parts {
+			g.Points = append(g.Points, p...)
+		}
+	case 2:
+		g.Lines = parts
+	case 3:
+		for k, r := range raw {
+			if mvtRingArea(r) > 0 || len(g.Polygons) == 0 {
+				g.Polygons = append(g.Polygons, [][][2]float64{parts[k]})
+			} else {
+				last := len(g.Polygons) - 1
+				g.Polygons[last] = append(g.Polygons[last], parts[k])
+			}
+		}
+	}
+	g.Type = partsType(g)
+	return g
+}
+
+// mvtRingArea is the signed shoelace area of a ring in tile coordinates.
+func mvtRingArea(r [][2]int64) float64 {
+	var a float64
+	for i := range r {
+		j := (i + 1) % len(r)
+		a += float64(r[i][0]*r[j][1] - r[j][0]*r[i][1])
+	}
+	return a / 2
+}
+
+// tileLonLat converts a position within tile t, given as fractions of the tile
+// size from its top-left corner, to lon/lat.
+func tileLonLat(t TileID, fx, fy float64) [2]float64 {
+	n := math.Exp2(float64(t.Z))
+	lon := (float64(t.X)+fx)/n*360 - 180
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*(float64(t.Y)+fy)/n))) * 180 / math.Pi
+	return [2]float64{lon, lat}
+}
@@ -0,0 +1,188 @@
+package geom
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mvtCmd encodes a command integer of the geometry stream.
+func mvtCmd(id, count uint64) uint64 { return id | count<<3 }
+
+// mvtRing is a MoveTo/LineTo/ClosePath stream for a closed ring given by
+// absolute tile coordinates, starting from cursor (x, y); it returns the
+// commands and the new cursor.
+func mvtRing(x, y int64, pts ...[2]int64) ([]uint64, int64, int64) {
+	cmds := []uint64{mvtCmd(1, 1), zigzag(pts[0][0] - x), zigzag(pts[0][1] - y)}
+	x, y = pts[0][0], pts[0][1]
+	cmds = append(cmds, mvtCmd(2, uint64(len(pts)-1)))
+	for _, p := range pts[1:] {
+		cmds = append(cmds, zigzag(p[0]-x), zigzag(p[1]-y))
+		x, y = p[0], p[1]
+	}
+	return append(cmds, mvtCmd(7, 1)), x, y
+}
+
+// mvtFixture is a tile with three layers: points with typed tag values, a
+// line, and polygons (one with a hole, then a second outer ring).
+func mvtFixture() []byte {
+	feature := func(id uint64, typ uint64, tags []uint64, geom []uint64) []byte {
+		m := pbMsg(nil).varint(1, id).varint(3, typ).packed(4, geom...)
+		if tags != nil {
+			m = m.packed(2, tags...)
+		}
+		return m
+	}
+	pois := pbMsg(nil).varint(15, 2).str(1, "pois").
+		bytes(2, feature(7, 1, []uint64{0, 0, 1, 1, 2, 2, 3, 3}, []uint64{mvtCmd(1, 1), zigzag(2048), zigzag(1024)})).
+		bytes(2, feature(8, 1, []uint64{0, 4, 9, 9}, []uint64{mvtCmd(1, 2), zigzag(10), zigzag(10), zigzag(5), zigzag(-5)})).
+		str(3, "name").str(3, "rank").str(3, "ratio").str(3, "open").
+		bytes(4, pbMsg(nil).str(1, "cafe")).
+		bytes(4, pbMsg(nil).varint(4, 3)).
+		bytes(4, pbMsg(nil).fixed64(3, math.Float64bits(0.25))).
+		bytes(4, pbMsg(nil).varint(7, 1)).
+		bytes(4, pbMsg(nil).sint(6, -2)).
+		varint(5, 4096)
+	roads := pbMsg(nil).str(1, "roads").
+		bytes(2, feature(1, 2, nil, []uint64{mvtCmd(1, 1), 0, 0, mvtCmd(2, 2), zigzag(100), 0, 0, zigzag(100)}))
+	outer, x, y := mvtRing(0, 0, [2]int64{0, 0}, [2]int64{100, 0}, [2]int64{100, 100}, [2]int64{0, 100})
+	hole, x, y := mvtRing(x, y, [2]int64{20, 20}, [2]int64{20, 80}, [2]int64{80, 80}, [2]int64{80, 20})
+	second, _, _ := mvtRing(x, y, [2]int64{200, 200}, [2]int64{300, 200}, [2]int64{300, 300})
+	water := pbMsg(nil).str(1, "water").
+		bytes(2, feature(2, 3, nil, append(append(outer, hole...), second...))).
+		bytes(2, feature(3, 3, nil, outer))
+	return pbMsg(nil).bytes(3, pois).bytes(3, roads).bytes(3, water)
+}
+
+func TestDecodeMVT(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(mvtFixture())
+	zw.Close()
+	for name, data := range map[string][]byte{"raw": mvtFixture(), "gzip": gz.Bytes()} {
+		fc, err := DecodeMVT(data, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		type summary struct {
+			id, layer, typ string
+			parts          int
+		}
+		var got []summary
+		for _, f := range fc.Features {
+			g := f.Geometry
+			got = append(got, summary{f.ID, f.Layer, g.Type, len(g.Points) + len(g.Lines) + len(g.Polygons)})
+		}
+		want := []summary{
+			{"7", "pois", "Point", 1},
+			{"8", "pois", "MultiPoint", 2},
+			{"1", "roads", "LineString", 1},
+			{"2", "water", "MultiPolygon", 2},
+			{"3", "water", "Polygon", 1},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: features %v, want %v", name, got, want)
+		}
+		if len(fc.Features) != len(want) {
+			continue
+		}
+		props := map[string]any{"name": "cafe", "rank": int64(3), "ratio": 0.25, "open": true}
+		if p := fc.Features[0].Properties; !reflect.DeepEqual(p, props) {
+			t.Errorf("%s: properties %v, want %v", name, p, props)
+		}
+		// an out-of-range value index is dropped
+		if p := fc.Features[1].Properties; !reflect.DeepEqual(p, map[string]any{"name": int64(-2)}) {
+			t.Errorf("%s: properties %v", name, p)
+		}
+		// tile-local coordinates with y flipped to point up
+		if p := fc.Features[0].Geometry.Points[0]; p != [2]float64{2048, -1024} {
+			t.Errorf("%s: point %v", name, p)
+		}
+		if p := fc.Features[1].Geometry.Points; !reflect.DeepEqual(p, [][2]float64{{10, -10}, {15, -5}}) {
+			t.Errorf("%s: multipoint %v", name, p)
+		}
+		polys := fc.Features[3].Geometry.Polygons
+		if len(polys[0]) != 2 || len(polys[0][0]) != 5 || len(polys[1]) != 1 || len(polys[1][0]) != 4 {
+			t.Errorf("%s: polygon rings %v", name, polys)
+		}
+		if fc.SRID != 0 {
+			t.Errorf("%s: untiled SRID %d", name, fc.SRID)
+		}
+	}
+}
+
+func TestDecodeMVTTile(t *testing.T) {
+	tests := []struct {
+		tile     TileID
+		lon, lat float64
+	}{
+		// the first point is at x 0.5, y 0.25 of the tile
+		{TileID{Z: 0, X: 0, Y: 0}, 0, 66.51326044311186},
+		{TileID{Z: 1, X: 1, Y: 1}, 90, -40.97989806962013},
+	}
+	for _, tt := range tests {
+		fc, err := DecodeMVT(mvtFixture(), &tt.tile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := fc.Features[0].Geometry.Points[0]
+		if math.Abs(p[0]-tt.lon) > 1e-9 || math.Abs(p[1]-tt.lat) > 1e-9 {
+			t.Errorf("tile %s: point %v, want %g %g", tt.tile, p, tt.lon, tt.lat)
+		}
+		if fc.SRID != 4326 {
+			t.Errorf("tile %s: SRID %d", tt.tile, fc.SRID)
+		}
+	}
+}
+
+func TestDecodeMVTErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "no features"},
+		{"no layers", pbMsg(nil).str(1, "x"), "no features"},
+		{"truncated layer", pbMsg(nil).bytes(3, []byte{0x0a, 0x05, 'a'}), "malformed"},
+		{"truncated feature", pbMsg(nil).bytes(3, pbMsg(nil).str(1, "l").bytes(2, []byte{0x20})), `layer "l"`},
+		{"bad gzip", []byte{0x1f, 0x8b, 0}, "mvt:"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeMVT(tt.data, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTileIDs(t *testing.T) {
+	tests := []struct {
+		path string
+		tile TileID
+		ok   bool
+	}{
+		{"tiles/14/8185/5448.mvt", TileID{14, 8185, 5448}, true},
+		{`C:\tiles\3\4\5.pbf`, TileID{3, 4, 5}, true},
+		{"14-8185-5448.pbf", TileID{14, 8185, 5448}, true},
+		{"out_2_3_1.mvt.gz", TileID{2, 3, 1}, true},
+		{"tiles/1/2/0.mvt", TileID{}, false}, // x out of range at z1
+		{"tile.mvt", TileID{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := TileFromPath(tt.path)
+		if ok != tt.ok || got != tt.tile {
+			t.Errorf("TileFromPath(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.tile, tt.ok)
+		}
+	}
+	for _, s := range []string{"1/2", "a/b/c", "31/0/0", "2/4/0", "-1/0/0"} {
+		if _, err := ParseTileID(s); err == nil {
+			t.Errorf("ParseTileID(%q): no error", s)
+		}
+	}
+	if id, err := ParseTileID(" 3/7/0 "); err != nil || id.String() != "3/7/0" {
+		t.Errorf("ParseTileID(3/7/0) = %v, %v", id, err)
+	}
+}
@@ -0,0 +1,778 @@
+package geom
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OSMFilter keeps OSM elements carrying at least one matching tag. Each entry
+// is "key=value", or "key=*" (or just "key") for any value. An empty filter
+// keeps every tagged element.
+type OSMFilter []osmTagMatch
+
+type osmTagMatch struct {
+	key, value string // value "" matches any
+}
+
+// ParseOSMFilter parses a comma-separated filter such as "highway=*,building".
+func ParseOSMFilter(s string) (OSMFilter, error) {
+	var f OSMFilter
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(part, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if k == "" {
+			return nil, fmt.Errorf("osm filter: missing key in %q", part)
+		}
+		if v == "*" {
+			v = ""
+		}
+		f = append(f, osmTagMatch{key: k, value: v})
+	}
+	return f, nil
+}
+
+func (f OSMFilter) String() string {
+	parts := make([]string, len(f))
+	for i, m := range f {
+		v := m.value
+		if v == "" {
+			v = "*"
+		}
+		parts[i] = m.key + "=" + v
+	}
+	return strings.Join(parts, ",")
+}
+
+// match reports whether tags pass the filter. Untagged elements never do.
+func (f OSMFilter) match(tags map[string]string) bool {
+	if len(tags) == 0 {
+		return false
+	}
+	if len(f) == 0 {
+		return true
+	}
+	for _, m := range f {
+		if v, ok := tags[m.key]; ok && (m.value == "" || m.value == v) {
+			return true
+		}
+	}
+	return false
+}
+
+type osmNode struct {
+	id   int64
+	tags map[string]string
+}
+
+type osmWay struct {
+	id   int64
+	refs []int64
+	tags map[string]string
+}
+
+type osmMember struct {
+	typ  string // node, way or relation
+	ref  int64
+	role string
+}
+
+type osmRelation struct {
+	id      int64
+	members []osmMember
+	tags    map[string]string
+}
+
+// osmData collects elements from either encoding, applying filter as they
+// are decoded so that large extracts stay manageable. Every node location and
+// the node list of every way are kept, because ways and relations refer to
+// nodes and ways that do not pass the filter themselves; the tags of those
+// are dropped.
+type osmData struct {
+	filter    OSMFilter
+	coords    map[int64][2]float64
+	nodes     []osmNode // nodes passing filter
+	ways      []osmWay  // tags only on ways passing filter
+	wayIndex  map[int64]int
+	relations []osmRelation // area relations passing filter
+}
+
+func newOSMData(filter OSMFilter) *osmData {
+	return &osmData{filter: filter, coords: map[int64][2]float64{}, wayIndex: map[int64]int{}}
+}
+
+func (d *osmData) addNode(id int64, lon, lat float64, tags map[string]string) {
+	d.coords[id] = [2]float64{lon, lat}
+	if d.filter.match(tags) {
+		d.nodes = append(d.nodes, osmNode{id: id, tags: tags})
+	}
+}
+
+func (d *osmData) addWay(w osmWay) {
+	if !d.filter.match(w.tags) {
+		w.tags = nil
+	}
+	d.wayIndex[w.id] = len(d.ways)
+	d.ways = append(d.ways, w)
+}
+
+// addRelation keeps the multipolygon and boundary relations passing the
+// filter; no other relations become features.
+func (d *osmData) addRelation(r osmRelation) {
+	if t := r.tags["type"]; t != "multipolygon" && t != "boundary" {
+		return
+	}
+	if d.filter.match(r.tags) {
+		d.relations = append(d.relations, r)
+	}
+}
+
+// LoadOSM reads an OpenStreetMap XML (.osm) or PBF (.osm.pbf) extract. Tagged
+// nodes become points, tagged ways become lines or, when closed and
+// describing an area, polygons, and multipolygon relations become polygons
+// with holes. Tags become properties. Only elements passing filter are kept.
+func LoadOSM(path string, filter OSMFilter) (FeatureCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer f.Close()
+	return decodeOSM(f, strings.HasSuffix(strings.ToLower(path), ".pbf"), filter)
+}
+
+// decodeOSM reads OSM XML, or PBF when pbf is set, from r (see LoadOSM).
+func decodeOSM(r io.Reader, pbf bool, filter OSMFilter) (FeatureCollection, error) {
+	d := newOSMData(filter)
+	var err error
+	if pbf {
+		err = d.decodePBF(r)
+	} else {
+		err = d.decodeXML(r)
+	}
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	fc := d.features()
+	if len(fc.Features) == 0 {
+		if len(filter) > 0 {
+			return FeatureCollection{}, fmt.Errorf("osm: nothing matches filter %s", filter)
+		}
+		return FeatureCollection{}, errors.New("osm: no tagged elements found")
+	}
+	return fc, nil
+}
+
+// IsOSMPBF reports whether path starts with an OSM PBF header blob, to tell
+// .osm.pbf extracts from other .pbf files.
+func IsOSMPBF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	typ, _, err := readOSMBlobHeader(f)
+	return err == nil && typ == "OSMHeader"
+}
+
+// features turns the collected elements into features.
+func (d *osmData) features() FeatureCollection {
+	var fc FeatureCollection
+	for _, n := range d.nodes {
+		fc.Add(Feature{ID: "node/" + strconv.FormatInt(n.id, 10), Geometry: Geometry{Type: "Point", Points: [][2]float64{d.coords[n.id]}}, Properties: osmProps(n.tags), Layer: "nodes"})
+	}
+	for _, w := range d.ways {
+		if w.tags == nil {
+			continue
+		}
+		pts := d.resolve(w.refs)
+		if len(pts) < 2 {
+			continue
+		}
+		g := Geometry{Type: "LineString", Lines: [][][2]float64{pts}}
+		if len(w.refs) >= 4 && w.refs[0] == w.refs[len(w.refs)-1] && osmIsArea(w.tags) {
+			g = Geometry{Type: "Polygon", Polygons: [][][][2]float64{{pts}}}
+		}
+		fc.Add(Feature{ID: "way/" + strconv.FormatInt(w.id, 10), Geometry: g, Properties: osmProps(w.tags), Layer: "ways"})
+	}
+	for _, r := range d.relations {
+		g := d.multipolygon(r)
+		fc.Add(Feature{ID: "relation/" + strconv.FormatInt(r.id, 10), Geometry: g, Properties: osmProps(r.tags), Layer: "relations"})
+	}
+	return fc
+}
+
+// resolve looks up node locations, dropping nodes missing from the extract.
+func (d *osmData) resolve(refs []int64) [][2]float64 {
+	out := make([][2]float64, 0, len(refs))
+	for _, id := range refs {
+		if p, ok := d.coords[id]; ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// osmAreaKeys are keys whose closed ways describe areas rather than loops.
+var osmAreaKeys = map[string]bool{
+	"building": true, "landuse": true, "natural": true, "leisure": true, "amenity": true,
+	"water": true, "place": true, "shop": true, "tourism": true, "man_made": true,
+	"aeroway": true, "historic": true, "military": true, "parking": true,
+}
+
+func osmIsArea(tags map[string]string) bool {
+	switch tags["area"] {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	for k := range tags {
+		if osmAreaKeys[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func osmProps(tags map[string]string) map[string]any {
+	props := make(map[string]any, len(tags))
+	for k, v := range tags {
+		props[k] = v
+	}
+	return props
+}
+
+// multipolygon joins the member ways of r into closed rings and assigns each
+// inner ring to the outer ring containing it. Members with no role count as
+// outer; rings that cannot be closed are dropped.
+func (d *osmData) multipolygon(r osmRelation) Geometry {
+	var outerWays, innerWays [][]int64
+	for _, m := range r.members {
+		i, ok := d.wayIndex[m.ref]
+		if m.typ != "way" || !ok {
+			continue
+		}
+		if m.role == "inner" {
+			innerWays = append(innerWays, d.ways[i].refs)
+		} else {
+			outerWays = append(outerWays, d.ways[i].refs)
+		}
+	}
+	g := Geometry{Type: "MultiPolygon"}
+	var inners [][][2]float64
+	for _, ring := range joinRings(innerWays) {
+		if pts := d.resolve(ring); len(pts) >= 4 {
+			inners = append(inners, pts)
+		}
+	}
+	for _, ring := range joinRings(outerWays) {
+		pts := d.resolve(ring)
+		if len(pts) < 4 {
+			continue
+		}
+		poly := [][][2]float64{pts}
+		for _, in := range inners {
+			if pointInRing(in[0], pts) {
+				poly = append(poly, in)
+			}
+		}
+		g.Polygons = append(g.Polygons, poly)
+	}
+	if len(g.Polygons) == 1 {
+		g.Type = "Polygon"
+	}
+	return g
+}
+
+// joinRings chains way node lists that share end nodes into closed rings.
+func joinRings(ways [][]int64) [][]int64 {
+	used := make([]bool, len(ways))
+	var rings [][]int64
+	for i, w := range ways {
+		if used[i] || len(w) < 2 {
+			continue
+		}
+		used[i] = true
+		ring := append([]int64(nil), w...)
+		for ring[0] != ring[len(ring)-1] {
+			end := ring[len(ring)-1]
+			found := false
+			for j, o := range ways {
+				if used[j] || len(o) < 2 {
+					continue
+				}
+				switch end {
+				case o[0]:
+					ring = append(ring, o[1:]...)
+				case o[len(o)-1]:
+					for k := len(o) - 2; k >= 0; k-- {
+						ring = append(ring, o[k])
+					}
+				default:
+					continue
+				}
+				used[j], found = true, true
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		if ring[0] == ring[len(ring)-1] {
+			rings = append(rings, ring)
+		}
+	}
+	return rings
+}
+
+type osmXMLTag struct {
+	K string `xml:"k,attr"`
+	V string `xml:"v,attr"`
+}
+
+type osmXMLNode struct {
+	ID   int64       `xml:"id,attr"`
+	Lat  float64     `xml:"lat,attr"`
+	Lon  float64     `xml:"lon,attr"`
+	Tags []osmXMLTag `xml:"tag"`
+}
+
+type osmXMLWay struct {
+	ID  int64 `xml:"id,attr"`
+	Nds []struct {
+		Ref int64 `xml:"ref,attr"`
+	} `xml:"nd"`
+	Tags []osmXMLTag `xml:"tag"`
+}
+
+type osmXMLRelation struct {
+	ID      int64 `xml:"id,attr"`
+	Members []struct {
+		Type string `xml:"type,attr"`
+		Ref  int64  `xml:"ref,attr"`
+		Role string `xml:"role,attr"`
+	} `xml:"member"`
+	Tags []osmXMLTag `xml:"tag"`
+}
+
+func xmlTags(tags []osmXMLTag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.K] = t.V
+	}
+	return m
+}
+
+// decodeXML reads the node, way and relation elements of an .osm file.
+func (d *osmData) decodeXML(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "node":
+			var n osmXMLNode
+			if err := dec.DecodeElement(&n, &se); err != nil {
+				return err
+			}
+			d.addNode(n.ID, n.Lon, n.Lat, xmlTags(n.Tags))
+		case "way":
+			var w osmXMLWay
+			if err := dec.DecodeElement(&w, &se); err != nil {
+				return err
+			}
+			refs := make([]int64, len(w.Nds))
+			for i, nd := range w.Nds {
+				refs[i] = nd.Ref
+			}
+			d.addWay(osmWay{id: w.ID, refs: refs, tags: xmlTags(w.Tags)})
+		case "relation":
+			var rel osmXMLRelation
+			if err := dec.DecodeElement(&rel, &se); err != nil {
+				return err
+			}
+			out := osmRelation{id: rel.ID, tags: xmlTags(rel.Tags)}
+			for _, m := range rel.Members {
+				out.members = append(out.members, osmMember{typ: m.Type, ref: m.Ref, role: m.Role})
+			}
+			d.addRelation(out)
+		}
+	}
+}
+
+// readOSMBlobHeader reads the length-prefixed BlobHeader that precedes each
+// blob of a PBF file and returns the blob type and data size.
+func readOSMBlobHeader(r io.Reader) (string, int, error) {
+	var lb [4]byte
+	if _, err := io.ReadFull(r, lb[:]); err != nil {
+		return "", 0, err
+	}
+	n := binary.BigEndian.Uint32(lb[:])
+	if n > 64<<10 {
+		return "", 0, fmt.Errorf("osm pbf: blob header too large (%d bytes)", n)
+	}
+	hb := make([]byte, n)
+	if _, err := io.ReadFull(r, hb); err != nil {
+		return "", 0, err
+	}
+	var typ string
+	size := 0
+	p := &pbReader{b: hb}
+	for p.next() {
+		switch p.field {
+		case 1:
+			typ = string(p.bytes())
+		case 3:
+			size = int(p.varint())
+		default:
+			p.skip()
+		}
+	}
+	if p.err != nil {
+		return "", 0, p.err
+	}
+	if size > 32<<20 {
+		return "", 0, fmt.Errorf("osm pbf: blob too large (%d bytes)", size)
+	}
+	return typ, size, nil
+}
+
+// decodePBF reads the OSMData blocks of an .osm.pbf file.
+func (d *osmData) decodePBF(r io.Reader) error {
+	for {
+		typ, size, err := readOSMBlobHeader(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		blob := make([]byte, size)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return err
+		}
+		data, err := osmBlobData(blob)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case "OSMHeader":
+			p := &pbReader{b: data}
+			for p.next() {
+				if p.field != 4 {
+					p.skip()
+					continue
+				}
+				switch f := string(p.bytes()); f {
+				case "OsmSchema-V0.6", "DenseNodes", "HistoricalInformation":
+				default:
+					return fmt.Errorf("osm pbf: unsupported required feature %q", f)
+				}
+			}
+			if p.err != nil {
+				return p.err
+			}
+		case "OSMData":
+			if err := d.primitiveBlock(data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// osmBlobData returns the uncompressed contents of a Blob message.
+func osmBlobData(blob []byte) ([]byte, error) {
+	p := &pbReader{b: blob}
+	var raw, zdata []byte
+	rawSize := 0
+	for p.next() {
+		switch p.field {
+		case 1:
+			raw = p.bytes()
+		case 2:
+			rawSize = int(p.varint())
+		case 3:
+			zdata = p.bytes()
+		case 4, 5, 6, 7:
+			return nil, errors.New("osm pbf: only zlib-compressed blobs are supported")
+		default:
+			p.skip()
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if raw != nil {
+		return raw, nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(zdata))
+	if err != nil {
+		return nil, fmt.Errorf("osm pbf: %w", err)
+	}
+	defer zr.Close()
+	out := bytes.NewBuffer(make([]byte, 0, rawSize))
+	if _, err := io.Copy(out, io.LimitReader(zr, 64<<20)); err != nil {
+		return nil, fmt.Errorf("osm pbf: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// osmBlock holds the string table and coordinate encoding of a PrimitiveBlock.
+type osmBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *osmBlock) coord(lat, lon int64) (float64, float64) {
+	return 1e-9 * float64(b.lonOffset+b.granularity*lon), 1e-9 * float64(b.latOffset+b.granularity*lat)
+}
+
+func (b *osmBlock) str(i uint64) string {
+	if i < uint64(len(b.strings)) {
+		return b.strings[i]
+	}
+	return ""
+}
+
+func (b *osmBlock) tags(keys, vals []uint64) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(keys))
+	for i := range keys {
+		if i < len(vals) {
+			m[b.str(keys[i])] = b.str(vals[i])
+		}
+	}
+	return m
+}
+
+// primitiveBlock decodes one PrimitiveBlock. Groups are decoded after the
+// whole block is read because granularity and offsets may follow them.
+func (d *osmData) primitiveBlock(data []byte) error {
+	blk := osmBlock{granularity: 100}
+	var groups [][]byte
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			st := &pbReader{b: p.bytes()}
+			for st.next() {
+				if st.field == 1 {
+					blk.strings = append(blk.strings, string(st.bytes()))
+				} else {
+					st.skip()
+				}
+			}
+			if st.err != nil {
+				return st.err
+			}
+		case 2:
+			groups = append(groups, p.bytes())
+		case 17:
+			blk.granularity = int64(p.varint())
+		case 19:
+			blk.latOffset = int64(p.varint())
+		case 20:
+			blk.lonOffset = int64(p.varint())
+		default:
+			p.skip()
+		}
+	}
+	if p.err != nil {
+		return p.err
+	}
+	for _, g := range groups {
+		if err := d.primitiveGroup(&blk, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *osmData) primitiveGroup(blk *osmBlock, data []byte) error {
+	p := &pbReader{b: data}
+	for p.next() {
+		var err error
+		switch p.field {
+		case 1:
+			err = d.pbfNode(blk, p.bytes())
+		case 2:
+			err = d.pbfDenseNodes(blk, p.bytes())
+		case 3:
+			err = d.pbfWay(blk, p.bytes())
+		case 4:
+			err = d.pbfRelation(blk, p.bytes())
+		default:
+			p.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.err
+}
+
+func (d *osmData) pbfNode(blk *osmBlock, data []byte) error {
+	var id, lat, lon int64
+	var keys, vals []uint64
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			id = p.sint()
+		case 2:
+			keys = p.packed()
+		case 3:
+			vals = p.packed()
+		case 8:
+			lat = p.sint()
+		case 9:
+			lon = p.sint()
+		default:
+			p.skip()
+		}
+	}
+	x, y := blk.coord(lat, lon)
+	d.addNode(id, x, y, blk.tags(keys, vals))
+	return p.err
+}
+
+// pbfDenseNodes decodes delta-coded DenseNodes; keys_vals lists each node's
+// key/value string indexes terminated by 0.
+func (d *osmData) pbfDenseNodes(blk *osmBlock, data []byte) error {
+	var ids, lats, lons []int64
+	var kv []uint64
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			ids = p.packedSint()
+		case 8:
+			lats = p.packedSint()
+		case 9:
+			lons = p.packedSint()
+		case 10:
+			kv = p.packed()
+		default:
+			p.skip()
+		}
+	}
+	if p.err != nil {
+		return p.err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("osm pbf: dense node arrays differ in length")
+	}
+	var id, lat, lon int64
+	k := 0
+	for i := range ids {
+		id, lat, lon = id+ids[i], lat+lats[i], lon+lons[i]
+		var tags map[string]string
+		for k < len(kv) && kv[k] != 0 {
+			if k+1 < len(kv) {
+				if tags == nil {
+					tags = map[string]string{}
+				}
+				tags[blk.str(kv[k])] = blk.str(kv[k+1])
+			}
+			k += 2
+		}
+		k++ // skip the terminating 0
+		x, y := blk.coord(lat, lon)
+		d.addNode(id, x, y, tags)
+	}
+	return nil
+}
+
+func (d *osmData) pbfWay(blk *osmBlock, data []byte) error {
+	var w osmWay
+	var keys, vals []uint64
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			w.id = int64(p.varint())
+		case 2:
+			keys = p.packed()
+		case 3:
+			vals = p.packed()
+		case 8:
+			var ref int64
+			for _, delta := range p.packedSint() {
+				ref += delta
+				w.refs = append(w.refs, ref)
+			}
+		default:
+			p.skip()
+		}
+	}
+	w.tags = blk.tags(keys, vals)
+	d.addWay(w)
+	return p.err
+}
+
+func (d *osmData) pbfRelation(blk *osmBlock, data []byte) error {
+	var rel osmRelation
+	var keys, vals, roles, types []uint64
+	var memids []int64
+	p := &pbReader{b: data}
+	for p.next() {
+		switch p.field {
+		case 1:
+			rel.id = int64(p.varint())
+		case 2:
+			keys = p.packed()
+		case 3:
+			vals = p.packed()
+		case 8:
+			roles = p.packed()
+		case 9:
+			memids = p.packedSint()
+		case 10:
+			types = p.packed()
+		default:
+			p.skip()
+		}
+	}
+	var ref int64
+	for i, delta := range memids {
+		ref += delta
+		m := osmMember{ref: ref}
+		if i < len(types) && types[i] < 3 {
+			m.typ = [...]string{"node", "way", "relation"}[types[i]]
+		}
+		if i < len(roles) {
+			m.role = blk.str(roles[i])
+		}
+		rel.members = append(rel.members, m)
+	}
+	rel.tags = blk.tags(keys, vals)
+	d.addRelation(rel)
+	return p.err
+}
@@ -0,0 +1,145 @@
+package geom
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Protocol Buffers wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+var errProtobuf = errors.New("protobuf: malformed message")
+
+// pbReader iterates over the fields of one protobuf message, which is all the
+// OSM PBF and vector tile decoders need:
+//
+//	for r.next() {
+//		switch r.field {
+//		case 1:
+//			name = string(r.bytes())
+//		default:
+//			r.skip()
+//		}
+//	}
+//	if r.err != nil { ... }
+type pbReader struct {
+	b     []byte
+	field int
+	wire  int
+	err   error
+}
+
+// next advances to the next field key, reporting false at the end of the
+// message or on error.
+func (r *pbReader) next() bool {
+	if r.err != nil || len(r.b) == 0 {
+		return false
+	}
+	key := r.varint()
+	r.field, r.wire = int(key>>3), int(key&7)
+	return r.err == nil
+}
+
+func (r *pbReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *pbReader) sint() int64 { return unzigzag(r.varint()) }
+
+func (r *pbReader) fixed32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *pbReader) fixed64() uint64 {
+	if len(r.b) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+// bytes reads a length-delimited field: a string, sub-message or packed array.
+func (r *pbReader) bytes() []byte {
+	n := r.varint()
+	if r.err != nil || n > uint64(len(r.b)) {
+		r.fail()
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// skip discards the value of the current field.
+func (r *pbReader) skip() {
+	switch r.wire {
+	case pbVarint:
+		r.varint()
+	case pbFixed64:
+		r.fixed64()
+	case pbBytes:
+		r.bytes()
+	case pbFixed32:
+		r.fixed32()
+	default:
+		r.fail()
+	}
+}
+
+func (r *pbReader) fail() {
+	if r.err == nil {
+		r.err = errProtobuf
+	}
+	r.b = nil
+}
+
+// packed reads a packed repeated varint field; a single unpacked value is
+// accepted too, as the protobuf spec requires of parsers.
+func (r *pbReader) packed() []uint64 {
+	if r.wire == pbVarint {
+		return []uint64{r.varint()}
+	}
+	b := r.bytes()
+	out := make([]uint64, 0, len(b))
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			r.fail()
+			return nil
+		}
+		out = append(out, v)
+		b = b[n:]
+	}
+	return out
+}
+
+// packedSint reads a packed repeated sint32/sint64 field.
+func (r *pbReader) packedSint() []int64 {
+	raw := r.packed()
+	out := make([]int64, len(raw))
+	for i, v := range raw {
+		out[i] = unzigzag(v)
+	}
+	return out
+}
+
+func unzigzag(v uint64) int64 { return int64(v>>1) ^ -int64(v&1) }
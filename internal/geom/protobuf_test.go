@@ -0,0 +1,381 @@
+package geom
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pbMsg builds protobuf messages for tests.
+type pbMsg []byte
+
+func (m pbMsg) key(field, wire int) pbMsg {
+	return binary.AppendUvarint(m, uint64(field<<3|wire))
+}
+
+func (m pbMsg) varint(field int, v uint64) pbMsg {
+	return binary.AppendUvarint(m.key(field, pbVarint), v)
+}
+
+func (m pbMsg) sint(field int, v int64) pbMsg {
+	return m.varint(field, zigzag(v))
+}
+
+func (m pbMsg) fixed32(field int, v uint32) pbMsg {
+	return binary.LittleEndian.AppendUint32(m.key(field, pbFixed32), v)
+}
+
+func (m pbMsg) fixed64(field int, v uint64) pbMsg {
+	return binary.LittleEndian.AppendUint64(m.key(field, pbFixed64), v)
+}
+
+func (m pbMsg) bytes(field int, b []byte) pbMsg {
+	m = binary.AppendUvarint(m.key(field, pbBytes), uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m pbMsg) str(field int, s string) pbMsg { return m.bytes(field, []byte(s)) }
+
+func (m pbMsg) packed(field int, vs ...uint64) pbMsg {
+	var b []byte
+	for _, v := range vs {
+		b = binary.AppendUvarint(b, v)
+	}
+	return m.bytes(field, b)
+}
+
+func (m pbMsg) packedSint(field int, vs ...int64) pbMsg {
+	zs := make([]uint64, len(vs))
+	for i, v := range vs {
+		zs[i] = zigzag(v)
+	}
+	return m.packed(field, zs...)
+}
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
+
+func TestPBReader(t *testing.T) {
+	msg := pbMsg(nil).
+		varint(1, 300).
+		sint(2, -5).
+		fixed32(3, math.Float32bits(1.5)).
+		fixed64(4, math.Float64bits(-2.25)).
+		str(5, "hello").
+		packed(6, 1, 128, 1<<40).
+		varint(6, 7).
+		packedSint(7, -1, 0, 1).
+		varint(100, 9)
+	var (
+		v1     uint64
+		v2     int64
+		v3     float32
+		v4     float64
+		v5     string
+		v6     [][]uint64
+		v7     []int64
+		fields []int
+	)
+	r := &pbReader{b: msg}
+	for r.next() {
+		fields = append(fields, r.field)
+		switch r.field {
+		case 1:
+			v1 = r.varint()
+		case 2:
+			v2 = r.sint()
+		case 3:
+			v3 = math.Float32frombits(r.fixed32())
+		case 4:
+			v4 = math.Float64frombits(r.fixed64())
+		case 5:
+			v5 = string(r.bytes())
+		case 6:
+			v6 = append(v6, r.packed())
+		case 7:
+			v7 = r.packedSint()
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if v1 != 300 || v2 != -5 || v3 != 1.5 || v4 != -2.25 || v5 != "hello" {
+		t.Errorf("scalars = %d %d %g %g %q", v1, v2, v3, v4, v5)
+	}
+	if want := [][]uint64{{1, 128, 1 << 40}, {7}}; !reflect.DeepEqual(v6, want) {
+		t.Errorf("packed = %v, want %v (packed then unpacked)", v6, want)
+	}
+	if want := []int64{-1, 0, 1}; !reflect.DeepEqual(v7, want) {
+		t.Errorf("packed sint = %v, want %v", v7, want)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 6, 7, 100}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
+
+func TestPBReaderSkip(t *testing.T) {
+	msg := pbMsg(nil).
+		varint(1, 1).fixed64(2, 2).str(3, "three").fixed32(4, 4).
+		varint(9, 42)
+	r := &pbReader{b: msg}
+	var got uint64
+	for r.next() {
+		if r.field == 9 {
+			got = r.varint()
+		} else {
+			r.skip()
+		}
+	}
+	if r.err != nil || got != 42 {
+		t.Errorf("after skipping every wire type: %d, %v", got, r.err)
+	}
+}
+
+func TestPBReaderMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"truncated key", []byte{0x80}},
+		{"truncated varint", []byte{0x08, 0xff}},
+		{"truncated fixed32", []byte{0x1d, 1, 2}},
+		{"truncated fixed64", []byte{0x21, 1, 2, 3, 4}},
+		{"bytes past end", []byte{0x2a, 10, 'a'}},
+		{"group wire type", []byte{0x0b}},
+		{"bad packed varint", []byte{0x32, 1, 0xff}},
+	}
+	for _, tt := range tests {
+		r := &pbReader{b: tt.msg}
+		n := 0
+		for r.next() {
+			if n++; n > 10 {
+				break
+			}
+			if r.field == 6 {
+				r.packed()
+			} else {
+				r.skip()
+			}
+		}
+		if r.err != errProtobuf {
+			t.Errorf("%s: error %v, want %v", tt.name, r.err, errProtobuf)
+		}
+		if r.next() {
+			t.Errorf("%s: next reports more fields after an error", tt.name)
+		}
+	}
+}
+
+func TestUnzigzag(t *testing.T) {
+	for _, v := range []int64{0, -1, 1, -2, 2, math.MaxInt64, math.MinInt64} {
+		if got := unzigzag(zigzag(v)); got != v {
+			t.Errorf("unzigzag(zigzag(%d)) = %d", v, got)
+		}
+	}
+	if unzigzag(1) != -1 || unzigzag(4) != 2 {
+		t.Error("unzigzag does not match the protobuf encoding")
+	}
+}
+
+// osmPBFBlob frames one blob: a BlobHeader of the given type followed by a
+// Blob holding data, zlib-compressed when compress is set.
+func osmPBFBlob(typ string, data []byte, compress bool) []byte {
+	blob := pbMsg(nil).bytes(1, data)
+	if compress {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(data)
+		zw.Close()
+		blob = pbMsg(nil).varint(2, uint64(len(data))).bytes(3, z.Bytes())
+	}
+	return osmPBFFrame(typ, blob)
+}
+
+// osmPBFFrame prefixes an encoded Blob with its BlobHeader.
+func osmPBFFrame(typ string, blob []byte) []byte {
+	hdr := pbMsg(nil).str(1, typ).varint(3, uint64(len(blob)))
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(hdr)))
+	out = append(out, hdr...)
+	return append(out, blob...)
+}
+
+// osmPBFFixture is a small extract: a square of untagged dense nodes with a
+// tagged node in the middle, a building and a path over them, a
+// multipolygon with a hole, and a plain (non-dense) tagged node.
+func osmPBFFixture(features ...string) []byte {
+	if features == nil {
+		features = []string{"OsmSchema-V0.6", "DenseNodes"}
+	}
+	header := pbMsg(nil)
+	for _, f := range features {
+		header = header.str(4, f)
+	}
+	strs := []string{"", "amenity", "cafe", "building", "yes", "type", "multipolygon", "outer", "inner", "highway", "path", "natural", "water"}
+	var st pbMsg
+	for _, s := range strs {
+		st = st.str(1, s)
+	}
+	// 1e-7 degree units at the default granularity of 100 nanodegrees
+	lons := []int64{130000000, 131000000, 131000000, 130000000, 130500000, 130200000, 130400000, 130400000, 130200000}
+	lats := []int64{520000000, 520000000, 521000000, 521000000, 520500000, 520200000, 520200000, 520400000, 520400000}
+	delta := func(vs []int64) []int64 {
+		out := make([]int64, len(vs))
+		for i := range vs {
+			out[i] = vs[i]
+			if i > 0 {
+				out[i] -= vs[i-1]
+			}
+		}
+		return out
+	}
+	dense := pbMsg(nil).
+		packedSint(1, 1, 1, 1, 1, 1, 1, 1, 1, 1).
+		packedSint(8, delta(lats)...).
+		packedSint(9, delta(lons)...).
+		packed(10, 0, 0, 0, 0, 1, 2, 0, 0, 0, 0, 0)
+	way := func(id uint64, refs []int64, kv ...uint64) []byte {
+		var keys, vals []uint64
+		for i := 0; i+1 < len(kv); i += 2 {
+			keys, vals = append(keys, kv[i]), append(vals, kv[i+1])
+		}
+		m := pbMsg(nil).varint(1, id)
+		if len(kv) > 0 {
+			m = m.packed(2, keys...).packed(3, vals...)
+		}
+		return m.packedSint(8, delta(refs)...)
+	}
+	rel := pbMsg(nil).varint(1, 20).
+		packed(2, 5, 11).packed(3, 6, 12).
+		packed(8, 7, 8).packedSint(9, 12, 1).packed(10, 1, 1)
+	node := pbMsg(nil).sint(1, 30).packed(2, 1).packed(3, 2).sint(8, 515000000).sint(9, -5000000)
+	group1 := pbMsg(nil).bytes(2, dense).bytes(1, node)
+	group2 := pbMsg(nil).
+		bytes(3, way(10, []int64{1, 2, 3, 4, 1}, 3, 4)).
+		bytes(3, way(11, []int64{1, 3}, 9, 10)).
+		bytes(3, way(12, []int64{1, 2, 3, 4, 1})).
+		bytes(3, way(13, []int64{6, 7, 8, 9, 6})).
+		bytes(4, rel)
+	block := pbMsg(nil).bytes(1, st).bytes(2, group1).bytes(2, group2)
+	out := osmPBFBlob("OSMHeader", header, false)
+	return append(out, osmPBFBlob("OSMData", block, true)...)
+}
+
+func TestDecodeOSMPBF(t *testing.T) {
+	tests := []struct {
+		filter string
+		ids    []string
+	}{
+		{"", []string{"node/5", "node/30", "way/10", "way/11", "relation/20"}},
+		{"building", []string{"way/10"}},
+		{"amenity=cafe,natural=*", []string{"node/5", "node/30", "relation/20"}},
+	}
+	for _, tt := range tests {
+		filter, err := ParseOSMFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fc, err := decodeOSM(bytes.NewReader(osmPBFFixture()), true, filter)
+		if err != nil {
+			t.Fatalf("filter %q: %v", tt.filter, err)
+		}
+		got := map[string]Feature{}
+		var ids []string
+		for _, f := range fc.Features {
+			ids = append(ids, f.ID)
+			got[f.ID] = f
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("filter %q: ids %v, want %v", tt.filter, ids, tt.ids)
+			continue
+		}
+		if tt.filter != "" {
+			continue
+		}
+		near := func(p [2]float64, lon, lat float64) bool {
+			return math.Abs(p[0]-lon) < 1e-9 && math.Abs(p[1]-lat) < 1e-9
+		}
+		if f := got["node/5"]; !near(f.Geometry.Points[0], 13.05, 52.05) || f.Properties["amenity"] != "cafe" || f.Layer != "nodes" {
+			t.Errorf("dense node = %+v", f)
+		}
+		if f := got["node/30"]; !near(f.Geometry.Points[0], -0.5, 51.5) {
+			t.Errorf("node = %+v", f)
+		}
+		if g := got["way/10"].Geometry; g.Type != "Polygon" || len(g.Polygons[0][0]) != 5 || !near(g.Polygons[0][0][2], 13.1, 52.1) {
+			t.Errorf("building = %+v", g)
+		}
+		if g := got["way/11"].Geometry; g.Type != "LineString" || len(g.Lines[0]) != 2 {
+			t.Errorf("path = %+v", g)
+		}
+		if g := got["relation/20"].Geometry; g.Type != "Polygon" || len(g.Polygons) != 1 || len(g.Polygons[0]) != 2 {
+			t.Errorf("multipolygon = %+v", g)
+		}
+	}
+}
+
+func TestDecodeOSMPBFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"required feature", osmPBFFixture("OsmSchema-V0.6", "LocationsOnWays"), `unsupported required feature "LocationsOnWays"`},
+		{"lzma blob", osmPBFFrame("OSMData", pbMsg(nil).bytes(4, []byte{0x5d})), "only zlib"},
+		{"dense lengths", osmPBFBlob("OSMData", pbMsg(nil).bytes(2, pbMsg(nil).bytes(2, pbMsg(nil).packedSint(1, 1, 1).packedSint(8, 0).packedSint(9, 0))), false), "differ in length"},
+		{"no elements", osmPBFBlob("OSMHeader", nil, false), "no tagged elements"},
+		{"truncated", osmPBFFixture()[:40], "EOF"},
+	}
+	for _, tt := range tests {
+		_, err := decodeOSM(bytes.NewReader(tt.data), true, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestIsOSMPBF(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"extract.osm.pbf", osmPBFFixture(), true},
+		{"data-first.pbf", osmPBFBlob("OSMData", nil, false), false},
+		{"tile.pbf", pbMsg(nil).str(3, "layer"), false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsOSMPBF(path); got != tt.want {
+			t.Errorf("IsOSMPBF(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestOSMFilterWhileDecoding checks that elements failing the filter are not
+// kept beyond what other elements need.
+func TestOSMFilterWhileDecoding(t *testing.T) {
+	filter, _ := ParseOSMFilter("natural=*")
+	d := newOSMData(filter)
+	if err := d.decodePBF(bytes.NewReader(osmPBFFixture())); err != nil {
+		t.Fatal(err)
+	}
+	// the multipolygon's ways keep their node lists, but no tags
+	if len(d.nodes) != 0 || len(d.relations) != 1 || len(d.ways) != 4 || len(d.coords) != 10 {
+		t.Errorf("kept %d nodes, %d ways, %d relations, %d locations", len(d.nodes), len(d.ways), len(d.relations), len(d.coords))
+	}
+	for _, w := range d.ways {
+		if w.tags != nil || len(w.refs) == 0 {
+			t.Errorf("way %d: tags %v, %d refs", w.id, w.tags, len(w.refs))
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package geom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Shape types from the ESRI Shapefile Technical Description. The Z and M
+// variants share the XY layout of their 2D counterparts followed by extra
+// arrays, which we skip.
+const (
+	shpNull        = 0
+	shpPoint       = 1
+	shpPolyLine    = 3
+	shpPolygon     = 5
+	shpMultiPoint  = 8
+	shpPointZ      = 11
+	shpPolyLineZ   = 13
+	shpPolygonZ    = 15
+	shpMultiPointZ = 18
+	shpPointM      = 21
+	shpPolyLineM   = 23
+	shpPolygonM    = 25
+	shpMultiPointM = 28
+)
+
+// LoadShapefile reads a .shp file together with its sibling .dbf (attributes)
+// and .prj (coordinate system) when present. Records are read sequentially, so
+// the .shx index is not required.
+func LoadShapefile(path string) (FeatureCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	defer f.Close()
+
+	var hdr [100]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return FeatureCollection{}, fmt.Errorf("shp: header: %w", err)
+	}
+	if binary.BigEndian.Uint32(hdr[0:4]) != 9994 {
+		return FeatureCollection{}, errors.New("shp: not a shapefile")
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	var fields []dbfField
+	var dbf *dbfReader
+	if df, err := openSibling(base, ".dbf"); err == nil {
+		defer df.Close()
+		if dbf, err = newDBFReader(df); err != nil {
+			return FeatureCollection{}, err
+		}
+		fields = dbf.fields
+	}
+
+	var fc FeatureCollection
+	for _, fd := range fields {
+		fc.Keys = append(fc.Keys, fd.name)
+	}
+	fc.CRS, fc.CRSWKT = readPrj(base)
+	layer := filepath.Base(base)
+
+	var rh [8]byte
+	for {
+		if _, err := io.ReadFull(f, rh[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return FeatureCollection{}, err
+		}
+		num := binary.BigEndian.Uint32(rh[0:4])
+		content := make([]byte, int(binary.BigEndian.Uint32(rh[4:8]))*2)
+		if _, err := io.ReadFull(f, content); err != nil {
+			return FeatureCollection{}, fmt.Errorf("shp: record %d: %w", num, err)
+		}
+		g, err := decodeShape(content)
+		if err != nil {
+			return FeatureCollection{}, fmt.Errorf("shp: record %d: %w", num, err)
+		}
+		var props map[string]any
+		if dbf != nil {
+			props, err = dbf.next()
+			if err != nil && err != io.EOF {
+				return FeatureCollection{}, err
+			}
+		}
+		fc.Add(Feature{ID: strconv.Itoa(int(num)), Geometry: g, Properties: props, Layer: layer})
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("shp: no shapes found")
+	}
+	return fc, nil
+}
+
+// openSibling opens base+ext, trying the upper-case extension as well since
+// shapefile sets often come from case-insensitive file systems.
+func openSibling(base, ext string) (*os.File, error) {
+	f, err := os.Open(base + ext)
+	if err != nil {
+		return os.Open(base + strings.ToUpper(ext))
+	}
+	return f, nil
+}
+
+// decodeShape decodes one record's content (shape type plus geometry).
+func decodeShape(b []byte) (Geometry, error) {
+	if len(b) < 4 {
+		return Geometry{}, errors.New("short record")
+	}
+	le := binary.LittleEndian
+	pt := func(off int) [2]float64 {
+		return [2]float64{math.Float64frombits(le.Uint64(b[off:])), math.Float64frombits(le.Uint64(b[off+8:]))}
+	}
+	switch st := le.Uint32(b[0:4]); st {
+	case shpNull:
+		return Geometry{}, nil
+	case shpPoint, shpPointZ, shpPointM:
+		if len(b) < 20 {
+			return Geometry{}, errors.New("short point")
+		}
+		return Geometry{Type: "Point", Points: [][2]float64{pt(4)}}, nil
+	case shpMultiPoint, shpMultiPointZ, shpMultiPointM:
+		// type, bbox[4], numPoints, points
+		if len(b) < 40 {
+			return Geometry{}, errors.New("short multipoint")
+		}
+		n := int(le.Uint32(b[36:40]))
+		if len(b) < 40+n*16 {
+			return Geometry{}, errors.New("short multipoint")
+		}
+		g := Geometry{Type: "MultiPoint"}
+		for i := 0; i < n; i++ {
+			g.Points = append(g.Points, pt(40+i*16))
+		}
+		return g, nil
+	case shpPolyLine, shpPolyLineZ, shpPolyLineM, shpPolygon, shpPolygonZ, shpPolygonM:
+		// type, bbox[4], numParts, numPoints, parts[numParts], points[numPoints]
+		if len(b) < 44 {
+			return Geometry{}, errors.New("short poly record")
+		}
+		nParts := int(le.Uint32(b[36:40]))
+		nPoints := int(le.Uint32(b[40:44]))
+		ptsOff := 44 + nParts*4
+		if nParts < 0 || nPoints < 0 || len(b) < ptsOff+nPoints*16 {
+			return Geometry{}, errors.New("short poly record")
+		}
+		var parts [][][2]float64
+		for i := 0; i < nParts; i++ {
+			start := int(le.Uint32(b[44+i*4:]))
+			end := nPoints
+			if i+1 < nParts {
+				end = int(le.Uint32(b[44+(i+1)*4:]))
+			}
+			if start < 0 || start > end || end > nPoints {
+				return Geometry{}, errors.New("bad part index")
+			}
+			ring := make([][2]float64, 0, end-start)
+			for j := start; j < end; j++ {
+				ring = append(ring, pt(ptsOff+j*16))
+			}
+			parts = append(parts, ring)
+		}
+		if st == shpPolyLine || st == shpPolyLineZ || st == shpPolyLineM {
+			t := "LineString"
+			if len(parts) > 1 {
+				t = "MultiLineString"
+			}
+			return Geometry{Type: t, Lines: parts}, nil
+		}
+		polys := assembleRings(parts)
+		t := "Polygon"
+		if len(polys) > 1 {
+			t = "MultiPolygon"
+		}
+		return Geometry{Type: t, Polygons: polys}, nil
+	default:
+		return Geometry{}, fmt.Errorf("unsupported shape type %d", st)
+	}
+}
+
+// assembleRings groups shapefile polygon parts into polygons. Outer rings are
+// clockwise and holes counter-clockwise; each hole is attached to the first
+// outer ring that contains it, or to the most recent outer ring otherwise.
+func assembleRings(rings [][][2]float64) [][][][2]float64 {
+	var polys [][][][2]float64
+	var holes [][][2]float64
+	for _, r := range rings {
+		if len(r) < 3 {
+			continue
+		}
+		if ringArea(r) <= 0 {
+			polys = append(polys, [][][2]float64{r})
+		} else {
+			holes = append(holes, r)
+		}
+	}
+	for _, h := range holes {
+		idx := -1
+		for i, p := range polys {
+			if pointInRing(h[0], p[0]) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			if len(polys) == 0 {
+				// no outer ring at all: treat the hole as an outer ring
+				polys = append(polys, [][][2]float64{h})
+				continue
+			}
+			idx = len(polys) - 1
+		}
+		polys[idx] = append(polys[idx], h)
+	}
+	return polys
+}
+
+// ringArea returns the signed shoelace area: positive for counter-clockwise rings.
+func ringArea(r [][2]float64) float64 {
+	var a float64
+	for i := range r {
+		j := (i + 1) % len(r)
+		a += r[i][0]*r[j][1] - r[j][0]*r[i][1]
+	}
+	return a / 2
+}
+
+// pointInRing is an even-odd ray casting test.
+func pointInRing(p [2]float64, r [][2]float64) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+type dbfField struct {
+	name     string
+	typ      byte
+	length   int
+	decimals int
+}
+
+// dbfReader reads dBASE III records one at a time.
+type dbfReader struct {
+	r      io.Reader
+	fields []dbfField
+	recLen int
+	count  int
+	read   int
+}
+
+func newDBFReader(r io.Reader) (*dbfReader, error) {
+	var hdr [32]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("dbf: header: %w", err)
+	}
+	le := binary.LittleEndian
+	d := &dbfReader{
+		r:      r,
+		count:  int(le.Uint32(hdr[4:8])),
+		recLen: int(le.Uint16(hdr[10:12])),
+	}
+	hdrLen := int(le.Uint16(hdr[8:10]))
+	if hdrLen < 33 {
+		return nil, errors.New("dbf: bad header length")
+	}
+	rest := make([]byte, hdrLen-32)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("dbf: field descriptors: %w", err)
+	}
+	for off := 0; off+32 <= len(rest) && rest[off] != 0x0D; off += 32 {
+		fd := rest[off : off+32]
+		name := fd[:11]
+		if i := strings.IndexByte(string(name), 0); i >= 0 {
+			name = name[:i]
+		}
+		d.fields = append(d.fields, dbfField{
+			name:     decodeDBFString(name),
+			typ:      fd[11],
+			length:   int(fd[16]),
+			decimals: int(fd[17]),
+		})
+	}
+	return d, nil
+}
+
+// next returns the next record as a property map. A deleted record yields
+// an empty map, so that records stay matched to shapes by position.
+func (d *dbfReader) next() (map[string]any, error) {
+	if d.read >= d.count {
+		return nil, io.EOF
+	}
+	buf := make([]byte, d.recLen)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, fmt.Errorf("dbf: record %d: %w", d.read+1, err)
+	}
+	d.read++
+	props := make(map[string]any, len(d.fields))
+	if buf[0] == '*' {
+		return props, nil
+	}
+	off := 1
+	for _, fd := range d.fields {
+		if off+fd.length > len(buf) {
+			break
+		}
+		props[fd.name] = dbfValue(fd, buf[off:off+fd.length])
+		off += fd.length
+	}
+	return props, nil
+}
+
+// dbfValue converts a raw field to string, float64, bool or nil.
+func dbfValue(fd dbfField, raw []byte) any {
+	s := strings.TrimSpace(decodeDBFString(raw))
+	switch fd.typ {
+	case 'N', 'F':
+		if s == "" || strings.Trim(s, "*") == "" {
+			return nil
+		}
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+		return s
+	case 'L':
+		switch s {
+		case "T", "t", "Y", "y":
+			return true
+		case "F", "f", "N", "n":
+			return false
+		}
+		return nil
+	case 'D':
+		if len(s) == 8 {
+			return s[0:4] + "-" + s[4:6] + "-" + s[6:8]
+		}
+		return s
+	default:
+		return s
+	}
+}
+
+// decodeDBFString returns b as UTF-8, falling back to Latin-1 for legacy files.
+func decodeDBFString(b []byte) string {
+	b = []byte(strings.TrimRight(string(b), "\x00"))
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+var prjNameRe = regexp.MustCompile(`^\s*(PROJCS|GEOGCS|PROJCRS|GEOGCRS|GEODCRS)\s*\[\s*"([^"]*)"`)
+
+// readPrj returns the coordinate system name and WKT from a sibling .prj
+// file, or "" when there is none.
+func readPrj(base string) (name, wkt string) {
+	f, err := openSibling(base, ".prj")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", ""
+	}
+	wkt = strings.TrimSpace(string(b))
+	if m := prjNameRe.FindStringSubmatch(wkt); m != nil {
+		return m[2], wkt
+	}
+	return "", wkt
+}
@@ -0,0 +1,199 @@
+package geom
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats lists the format names accepted by Decode.
+var Formats = []string{"geojson", "ndjson", "csv", "kml", "kmz", "gpx", "gml", "osm", "osm.pbf", "mvt", "wkt", "wkb", "text"}
+
+// stdinLayer names the layer of features decoded from memory.
+const stdinLayer = "stdin"
+
+// Decode parses data held in memory, such as a file piped to stdin, in the
+// named format, or in the format sniffFormat detects when format is empty.
+// Gzip-compressed input is decompressed first. It returns the format used;
+// for "text" that is the one ParseText recognised. Formats that need random
+// access (Shapefile, GeoPackage, FlatGeobuf, MBTiles) are detected but must
+// be opened from a file.
+func Decode(data []byte, format string, filter OSMFilter, tile *TileID) (FeatureCollection, string, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return FeatureCollection{}, format, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return FeatureCollection{}, format, err
+		}
+	}
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if format == "" {
+		format = sniffFormat(data)
+	}
+	var fc FeatureCollection
+	var err error
+	switch format {
+	case "geojson", "json", "topojson":
+		fc, err = DecodeGeoJSON(context.Background(), bytes.NewReader(data), nil)
+	case "ndjson", "geojsonl", "geojsons", "geojsonseq", "jsonl":
+		fc, err = decodeGeoJSONSeq(bytes.NewReader(data), stdinLayer)
+	case "csv", "tsv":
+		fc, err = decodeCSV(bytes.NewReader(data), stdinLayer)
+	case "kml":
+		fc, err = decodeKML(bytes.NewReader(data), stdinLayer)
+	case "kmz":
+		var zr *zip.Reader
+		zr, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err == nil {
+			fc, err = decodeKMZ(zr, stdinLayer)
+		}
+	case "gpx":
+		fc, err = decodeGPX(data)
+	case "gml", "xml", "wfs":
+		fc, err = decodeGML(bytes.NewReader(data))
+	case "osm":
+		fc, err = decodeOSM(bytes.NewReader(data), false, filter)
+	case "osm.pbf", "pbf":
+		fc, err = decodeOSM(bytes.NewReader(data), true, filter)
+	case "mvt":
+		fc, err = DecodeMVT(data, tile)
+	case "wkt", "ewkt":
+		text := string(data)
+		if !isWKTLine(firstLine(data)) {
+			// rows among psql's header and footer lines
+			text = strings.Join(matchingLines(data, isWKTLine), "\n")
+		}
+		fc, err = ParseWKTData(text)
+		if fc.SRID != 0 {
+			format = "ewkt"
+		}
+	case "wkb", "ewkb":
+		if isText(data) {
+			data = []byte(strings.Join(matchingLines(data, isHex), "\n"))
+		}
+		fc, err = decodeWKB(data, stdinLayer)
+	case "text":
+		fc, format, err = ParseText(string(data))
+	case "shp", "gpkg", "fgb", "mbtiles", "sqlite":
+		return FeatureCollection{}, format, fmt.Errorf("%s input must be opened from a file", format)
+	default:
+		return FeatureCollection{}, format, fmt.Errorf("unknown format %q (one of %s)", format, strings.Join(Formats, ", "))
+	}
+	return fc, format, err
+}
+
+// sniffFormat guesses the format of data from its leading bytes, returning
+// one of the Decode format names.
+func sniffFormat(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return "text"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return "kmz"
+	case bytes.HasPrefix(data, []byte("SQLite format 3\x00")):
+		return "sqlite"
+	case bytes.HasPrefix(data, []byte("fgb\x03")):
+		return "fgb"
+	}
+	if typ, _, err := readOSMBlobHeader(bytes.NewReader(data)); err == nil && typ == "OSMHeader" {
+		return "osm.pbf"
+	}
+	if !isText(data) {
+		// MVT layers are field 3, length-delimited; WKB starts with its byte
+		// order, 0 or 1
+		if data[0] == 0x1a {
+			return "mvt"
+		}
+		return "wkb"
+	}
+	t := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\ufeff")), " \t\r\n\x1e")
+	if len(t) == 0 {
+		return "text"
+	}
+	switch t[0] {
+	case '{', '[':
+		if json.Valid(t) {
+			return "geojson"
+		}
+		if line, _, _ := bytes.Cut(t, []byte("\n")); json.Valid(line) || bytes.Contains(data, []byte{0x1e}) {
+			return "ndjson"
+		}
+		return "geojson"
+	case '<':
+		head := strings.ToLower(string(t[:min(len(t), 4096)]))
+		switch {
+		case strings.Contains(head, "<kml"):
+			return "kml"
+		case strings.Contains(head, "<gpx"):
+			return "gpx"
+		case strings.Contains(head, "<osm"):
+			return "osm"
+		}
+		return "gml"
+	}
+	first := firstLine(t)
+	switch {
+	case isHexWKB(first):
+		return "wkb"
+	case isWKTLine(first):
+		return "wkt"
+	case strings.ContainsAny(first, ",;\t|") && bytes.Contains(bytes.TrimSpace(t), []byte("\n")):
+		// a header and at least one row; single-line coordinate text is left
+		// to ParseText
+		return "csv"
+	}
+	return "text"
+}
+
+// isText reports whether the first bytes of data are printable text.
+func isText(data []byte) bool {
+	for _, c := range data[:min(len(data), 512)] {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != 0x1e {
+			return false
+		}
+	}
+	return true
+}
+
+// firstLine returns the first non-blank line of b, trimmed.
+func firstLine(b []byte) string {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	return strings.TrimSpace(string(line))
+}
+
+// wktKeywords are the leading words of the WKT geometry types.
+var wktKeywords = []string{"POINT", "LINESTRING", "POLYGON", "MULTIPOINT", "MULTILINESTRING", "MULTIPOLYGON", "GEOMETRYCOLLECTION", "SRID="}
+
+// isWKTLine reports whether s, trimmed, starts with a WKT type keyword.
+func isWKTLine(s string) bool {
+	u := strings.ToUpper(strings.TrimSpace(s))
+	for _, k := range wktKeywords {
+		if strings.HasPrefix(u, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingLines returns the trimmed lines of data accepted by keep, which
+// drops the headers, rules and row counts of psql's aligned output.
+func matchingLines(data []byte, keep func(string) bool) []string {
+	var out []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && keep(line) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
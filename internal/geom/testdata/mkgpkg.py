@@ -0,0 +1,99 @@
+#!/usr/bin/env python3
+# Regenerates testdata/fixture.gpkg, used by gpkg_test.go:
+#
+#   python3 testdata/mkgpkg.py
+#
+# Three layers, registered in gpkg_geometry_columns in a different order from
+# gpkg_contents: roads (EPSG:27700), places (many rows over interior pages, an
+# unreadable geometry, rows from before ALTER TABLE ADD COLUMN) and lakes (a
+# custom SRS and a polygon large enough to spill onto overflow pages).
+import math
+import os
+import sqlite3
+import struct
+
+here = os.path.dirname(os.path.abspath(__file__))
+path = os.path.join(here, "fixture.gpkg")
+if os.path.exists(path):
+    os.remove(path)
+
+
+def gp(srs, wkb, xs, ys):
+    # little-endian header with an xy envelope
+    return (b"GP\x00\x03" + struct.pack("<i", srs) +
+            struct.pack("<4d", min(xs), max(xs), min(ys), max(ys)) + wkb)
+
+
+def point(srs, x, y):
+    return gp(srs, struct.pack("<BIdd", 1, 1, x, y), [x], [y])
+
+
+def line(srs, pts):
+    wkb = struct.pack("<BII", 1, 2, len(pts))
+    for x, y in pts:
+        wkb += struct.pack("<dd", x, y)
+    return gp(srs, wkb, [p[0] for p in pts], [p[1] for p in pts])
+
+
+def polygon(srs, ring):
+    wkb = struct.pack("<BIII", 1, 3, 1, len(ring))
+    for x, y in ring:
+        wkb += struct.pack("<dd", x, y)
+    return gp(srs, wkb, [p[0] for p in ring], [p[1] for p in ring])
+
+
+db = sqlite3.connect(path)
+db.execute("PRAGMA page_size = 512")
+db.execute("PRAGMA journal_mode = DELETE")
+db.executescript("""
+CREATE TABLE gpkg_spatial_ref_sys (srs_name TEXT NOT NULL, srs_id INTEGER
+  PRIMARY KEY, organization TEXT NOT NULL, organization_coordsys_id INTEGER
+  NOT NULL, definition TEXT NOT NULL, description TEXT);
+CREATE TABLE gpkg_contents (table_name TEXT NOT NULL PRIMARY KEY, data_type
+  TEXT NOT NULL, identifier TEXT UNIQUE, srs_id INTEGER);
+CREATE TABLE gpkg_geometry_columns (table_name TEXT NOT NULL, column_name TEXT
+  NOT NULL, geometry_type_name TEXT NOT NULL, srs_id INTEGER NOT NULL, z
+  TINYINT NOT NULL, m TINYINT NOT NULL);
+CREATE TABLE places (fid INTEGER PRIMARY KEY AUTOINCREMENT, geom POINT, name
+  TEXT, pop INTEGER);
+CREATE TABLE roads (fid INTEGER PRIMARY KEY AUTOINCREMENT, ref TEXT, geom
+  LINESTRING);
+CREATE TABLE lakes (fid INTEGER PRIMARY KEY AUTOINCREMENT, geom POLYGON, name
+  TEXT);
+""")
+db.executemany("INSERT INTO gpkg_spatial_ref_sys VALUES (?, ?, ?, ?, ?, ?)", [
+    ("WGS 84", 4326, "EPSG", 4326, "undefined", None),
+    ("OSGB36 / British National Grid", 27700, "EPSG", 27700,
+     'PROJCS["OSGB36 / British National Grid"]', None),
+    ("Local grid", 99999, "NONE", 99999, "undefined", None),
+])
+db.executemany("INSERT INTO gpkg_contents VALUES (?, 'features', ?, ?)", [
+    ("roads", "roads", 27700),
+    ("places", "places", 4326),
+    ("lakes", "lakes", 99999),
+])
+db.executemany("INSERT INTO gpkg_geometry_columns VALUES (?, 'geom', ?, ?, 0, 0)", [
+    ("places", "POINT", 4326),
+    ("roads", "LINESTRING", 27700),
+    ("lakes", "POLYGON", 99999),
+])
+
+db.executemany("INSERT INTO places (fid, geom, name, pop) VALUES (?, ?, ?, ?)",
+               [(i, point(4326, i / 10, -i / 20), "place-%d" % i, i * 100)
+                for i in range(1, 301)])
+db.execute("INSERT INTO places (fid, geom, name) VALUES (301, NULL, 'no geometry')")
+db.execute("INSERT INTO places (fid, geom, name) VALUES (302, X'4750000bdeadbeef', 'bad geometry')")
+db.execute("ALTER TABLE places ADD COLUMN note TEXT")
+db.execute("INSERT INTO places (fid, geom, name, pop, note) VALUES (303, ?, 'late', 7, 'added')",
+           (point(4326, 1, 2),))
+
+db.execute("INSERT INTO roads (ref, geom) VALUES ('A1', ?)",
+           (line(27700, [(530000, 180000), (531000, 181000), (532000, 181500)]),))
+
+ring = [(math.cos(2 * math.pi * k / 500) * 100, math.sin(2 * math.pi * k / 500) * 100)
+        for k in range(500)]
+ring.append(ring[0])
+db.execute("INSERT INTO lakes (geom, name) VALUES (?, 'round')", (polygon(99999, ring),))
+
+db.commit()
+db.close()
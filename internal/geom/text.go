@@ -0,0 +1,194 @@
+package geom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseText sniffs the format of pasted geometry text and parses it. It
+// recognises GeoJSON objects, geohashes, hex-encoded WKB/EWKB, bbox strings
+// "minx,miny,maxx,maxy", "lat, lon" pairs (one per line, decimal or DMS),
+// Google encoded polylines and (E)WKT, and returns the name of the format it
+// detected.
+func ParseText(s string) (fc FeatureCollection, format string, err error) {
+	t := strings.TrimSpace(s)
+	switch {
+	case t == "":
+		return FeatureCollection{}, "", errors.New("empty input")
+	case strings.HasPrefix(t, "{") && json.Valid([]byte(t)):
+		fc, err = ParseGeoJSON([]byte(t))
+		return fc, "GeoJSON", err
+	case isGeohashList(t):
+		fc, err = parseGeohashes(t)
+		return fc, "geohash", err
+	}
+	if fc, format, ok := parseCoordText(t); ok {
+		return fc, format, nil
+	}
+	if isHexWKB(t) {
+		fc, err = ParseHexWKB(t)
+		if fc.SRID != 0 {
+			return fc, "hex EWKB", err
+		}
+		return fc, "hex WKB", err
+	}
+	if fc, format, ok := parsePolylineText(t); ok {
+		return fc, format, nil
+	}
+	fc, err = ParseWKTData(s)
+	if fc.SRID != 0 {
+		return fc, "EWKT", err
+	}
+	return fc, "WKT", err
+}
+
+// isGeohashList reports whether t is one or more whitespace or comma
+// separated geohashes. Each must hold a letter, so that plain integers are
+// left to the coordinate formats.
+func isGeohashList(t string) bool {
+	fields := strings.FieldsFunc(t, isListSep)
+	for _, f := range fields {
+		if !isGeohash(f) || !strings.ContainsAny(strings.ToLower(f), geohashAlphabet[10:]) {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+func isListSep(c rune) bool { return c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+// parseGeohashes renders each geohash as its cell.
+func parseGeohashes(t string) (FeatureCollection, error) {
+	fc := FeatureCollection{Keys: []string{"geohash", "lat", "lon"}}
+	for _, h := range strings.FieldsFunc(t, isListSep) {
+		bb, err := DecodeGeohash(h)
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		fc.Add(Feature{Geometry: bboxPolygon(bb), Properties: map[string]any{
+			"geohash": h, "lat": (bb.MinY + bb.MaxY) / 2, "lon": (bb.MinX + bb.MaxX) / 2,
+		}})
+	}
+	fc.SetSRID(4326)
+	return fc, nil
+}
+
+// parseCoordText recognises a bbox "minx,miny,maxx,maxy" on one line, or
+// "lat, lon" pairs one per line. A pair whose first value is out of latitude
+// range but whose second is not is read as "lon, lat" instead.
+func parseCoordText(t string) (FeatureCollection, string, bool) {
+	lines := strings.FieldsFunc(t, func(c rune) bool { return c == '\n' || c == '\r' || c == ';' })
+	if len(lines) == 1 {
+		if v, ok := numberFields(lines[0], 4); ok {
+			bb := BBox{MinX: v[0], MinY: v[1], MaxX: v[2], MaxY: v[3]}
+			if bb.MinX >= bb.MaxX || bb.MinY >= bb.MaxY {
+				return FeatureCollection{}, "", false
+			}
+			fc := FeatureCollection{Keys: []string{"minx", "miny", "maxx", "maxy"}}
+			fc.Add(Feature{Geometry: bboxPolygon(bb), Properties: map[string]any{
+				"minx": bb.MinX, "miny": bb.MinY, "maxx": bb.MaxX, "maxy": bb.MaxY,
+			}})
+			return fc, "bbox", true
+		}
+	}
+	fc := FeatureCollection{Keys: []string{"row", "lat", "lon"}}
+	swapped := false
+	for i, line := range lines {
+		v, ok := degreePair(line)
+		if !ok {
+			return FeatureCollection{}, "", false
+		}
+		lat, lon := v[0], v[1]
+		if math.Abs(lat) > 90 && math.Abs(lon) <= 90 {
+			lat, lon, swapped = lon, lat, true
+		}
+		if math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			return FeatureCollection{}, "", false
+		}
+		fc.Add(Feature{
+			Geometry:   Geometry{Type: "Point", Points: [][2]float64{{lon, lat}}},
+			Properties: map[string]any{"row": i + 1, "lat": lat, "lon": lon},
+		})
+	}
+	fc.SetSRID(4326)
+	if swapped {
+		return fc, "lon, lat", true
+	}
+	return fc, "lat, lon", true
+}
+
+// numberFields splits s on commas and/or whitespace into exactly n numbers.
+func numberFields(s string, n int) ([]float64, bool) {
+	fields := strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' })
+	if len(fields) != n {
+		return nil, false
+	}
+	out := make([]float64, n)
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, false
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// degreePair parses two angles separated by a comma, or by whitespace when
+// both are plain numbers. DMS forms are accepted (see parseDegrees).
+func degreePair(s string) ([2]float64, bool) {
+	if v, ok := numberFields(s, 2); ok {
+		return [2]float64{v[0], v[1]}, true
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return [2]float64{}, false
+	}
+	a, ok1 := parseDegrees(parts[0])
+	b, ok2 := parseDegrees(parts[1])
+	return [2]float64{a, b}, ok1 && ok2
+}
+
+// parsePolylineText recognises a Google encoded polyline, also when copied
+// from a JSON string with escaped backslashes. Precision 5 is tried first,
+// then 6 when that puts points out of range.
+func parsePolylineText(t string) (FeatureCollection, string, bool) {
+	if strings.ContainsAny(t, " \t\n\r") {
+		return FeatureCollection{}, "", false
+	}
+	t = strings.ReplaceAll(t, `\\`, `\`)
+	for _, precision := range []int{5, 6} {
+		pts, err := DecodePolyline(t, precision)
+		if err != nil {
+			return FeatureCollection{}, "", false
+		}
+		if !lonLatRange(pts) {
+			continue
+		}
+		g := Geometry{Type: "LineString", Lines: [][][2]float64{pts}}
+		if len(pts) == 1 {
+			g = Geometry{Type: "Point", Points: pts}
+		}
+		fc := FeatureCollection{Keys: []string{"points"}}
+		fc.Add(Feature{Geometry: g, Properties: map[string]any{"points": len(pts)}})
+		fc.SetSRID(4326)
+		if precision == 5 {
+			return fc, "encoded polyline", true
+		}
+		return fc, fmt.Sprintf("encoded polyline (precision %d)", precision), true
+	}
+	return FeatureCollection{}, "", false
+}
+
+func lonLatRange(pts [][2]float64) bool {
+	for _, p := range pts {
+		if math.Abs(p[0]) > 180 || math.Abs(p[1]) > 90 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package geom
+
+import "testing"
+
+func TestParseTextFormat(t *testing.T) {
+	tests := []struct {
+		in       string
+		format   string
+		features int
+	}{
+		{"u4pruyd", "geohash", 1},
+		{"U4PRUYD", "geohash", 1},
+		{"u4pruyd, U4PRUYE", "geohash", 2},
+		{"010100000000000000000000000000000000000000", "hex WKB", 1},
+		{`\x0101000020E6100000000000000000F03F0000000000000040`, "hex EWKB", 1},
+		{"POINT (1 2)", "WKT", 1},
+		{"52.5, 13.4", "lat, lon", 1},
+	}
+	for _, tt := range tests {
+		fc, format, err := ParseText(tt.in)
+		if err != nil || format != tt.format || len(fc.Features) != tt.features {
+			t.Errorf("ParseText(%q) = %d features as %q, %v; want %d as %q", tt.in, len(fc.Features), format, err, tt.features, tt.format)
+		}
+	}
+}
+
+func TestParseTextShortNumbers(t *testing.T) {
+	// bare numbers are even-length hex too, but too short to be WKB
+	for _, in := range []string{"12", "1234", "12345678", "0x1234"} {
+		if _, format, _ := ParseText(in); format == "hex WKB" || format == "hex EWKB" {
+			t.Errorf("ParseText(%q) read as %s", in, format)
+		}
+	}
+}
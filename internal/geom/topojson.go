@@ -0,0 +1,189 @@
+package geom
+
+import (
+	"errors"
+	"sort"
+)
+
+// topology holds the decoded arcs of a TopoJSON Topology, already converted
+// from quantized, delta-encoded integers to absolute coordinates.
+type topology struct {
+	arcs  [][][2]float64
+	scale [2]float64
+	trans [2]float64
+}
+
+// addTopoJSON expands every object of a decoded TopoJSON Topology into
+// features. Each named object becomes a layer; a GeometryCollection object
+// contributes one feature per member, as topojson.feature does.
+func (fc *FeatureCollection) addTopoJSON(raw map[string]any) error {
+	topo := topology{scale: [2]float64{1, 1}}
+	quantized := false
+	if tr, ok := raw["transform"].(map[string]any); ok {
+		s, sok := tr["scale"].([]any)
+		t, tok := tr["translate"].([]any)
+		if sok && tok && len(s) == 2 && len(t) == 2 {
+			topo.scale = [2]float64{num(s[0]), num(s[1])}
+			topo.trans = [2]float64{num(t[0]), num(t[1])}
+			quantized = true
+		}
+	}
+	arcs, _ := raw["arcs"].([]any)
+	for _, a := range arcs {
+		positions, _ := a.([]any)
+		arc := make([][2]float64, 0, len(positions))
+		var x, y float64
+		for _, p := range positions {
+			pos, ok := p.([]any)
+			if !ok || len(pos) < 2 {
+				continue
+			}
+			if quantized {
+				// quantized arcs are delta-encoded
+				x += num(pos[0])
+				y += num(pos[1])
+				arc = append(arc, topo.point(x, y))
+			} else {
+				arc = append(arc, [2]float64{num(pos[0]), num(pos[1])})
+			}
+		}
+		topo.arcs = append(topo.arcs, arc)
+	}
+	objects, ok := raw["objects"].(map[string]any)
+	if !ok {
+		return errors.New("topojson: missing \"objects\"")
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		obj, _ := objects[name].(map[string]any)
+		if t, _ := obj["type"].(string); t == "GeometryCollection" {
+			members, _ := obj["geometries"].([]any)
+			for _, m := range members {
+				if mg, ok := m.(map[string]any); ok {
+					fc.addTopoObject(topo, mg, name)
+				}
+			}
+			continue
+		}
+		fc.addTopoObject(topo, obj, name)
+	}
+	return nil
+}
+
+func (fc *FeatureCollection) addTopoObject(topo topology, obj map[string]any, layer string) {
+	props, _ := obj["properties"].(map[string]any)
+	fc.Add(Feature{ID: geoJSONID(obj["id"]), Geometry: topo.geometry(obj), Properties: props, Layer: layer})
+}
+
+// point converts a quantized position to coordinates.
+func (t topology) point(x, y float64) [2]float64 {
+	return [2]float64{x*t.scale[0] + t.trans[0], y*t.scale[1] + t.trans[1]}
+}
+
+// position decodes a Point/MultiPoint position, which is quantized but not
+// delta-encoded.
+func (t topology) position(v any) ([2]float64, bool) {
+	pos, ok := v.([]any)
+	if !ok || len(pos) < 2 {
+		return [2]float64{}, false
+	}
+	return t.point(num(pos[0]), num(pos[1])), true
+}
+
+// line stitches a list of arc indexes into one line. A negative index ~i
+// refers to arc i reversed; the first point of each following arc repeats
+// the last point of the previous one and is dropped.
+func (t topology) line(v any) [][2]float64 {
+	idx, _ := v.([]any)
+	var out [][2]float64
+	for _, a := range idx {
+		i := int(num(a))
+		reverse := i < 0
+		if reverse {
+			i = ^i
+		}
+		if i < 0 || i >= len(t.arcs) {
+			continue
+		}
+		arc := t.arcs[i]
+		for k := range arc {
+			p := arc[k]
+			if reverse {
+				p = arc[len(arc)-1-k]
+			}
+			if k == 0 && len(out) > 0 {
+				continue
+			}
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (t topology) lines(v any) [][][2]float64 {
+	parts, _ := v.([]any)
+	var out [][][2]float64
+	for _, p := range parts {
+		if l := t.line(p); len(l) > 0 {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// geometry converts a TopoJSON geometry object into a Geometry.
+func (t topology) geometry(obj map[string]any) Geometry {
+	typ, _ := obj["type"].(string)
+	g := Geometry{Type: typ}
+	switch typ {
+	case "Point":
+		if p, ok := t.position(obj["coordinates"]); ok {
+			g.Points = append(g.Points, p)
+		}
+	case "MultiPoint":
+		ps, _ := obj["coordinates"].([]any)
+		for _, v := range ps {
+			if p, ok := t.position(v); ok {
+				g.Points = append(g.Points, p)
+			}
+		}
+	case "LineString":
+		if l := t.line(obj["arcs"]); len(l) > 0 {
+			g.Lines = append(g.Lines, l)
+		}
+	case "MultiLineString":
+		g.Lines = t.lines(obj["arcs"])
+	case "Polygon":
+		if rings := t.lines(obj["arcs"]); len(rings) > 0 {
+			g.Polygons = append(g.Polygons, rings)
+		}
+	case "MultiPolygon":
+		polys, _ := obj["arcs"].([]any)
+		for _, p := range polys {
+			if rings := t.lines(p); len(rings) > 0 {
+				g.Polygons = append(g.Polygons, rings)
+			}
+		}
+	case "GeometryCollection":
+		members, _ := obj["geometries"].([]any)
+		for _, m := range members {
+			if mg, ok := m.(map[string]any); ok {
+				sub := t.geometry(mg)
+				g.Points = append(g.Points, sub.Points...)
+				g.Lines = append(g.Lines, sub.Lines...)
+				g.Polygons = append(g.Polygons, sub.Polygons...)
+			}
+		}
+	}
+	return g
+}
+
+// num returns v as a float64, or 0 if it is not a JSON number.
+func num(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
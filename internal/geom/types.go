@@ -1,5 +1,10 @@
 package geom
 
+import (
+	"sort"
+	"strconv"
+)
+
 type BBox struct {
 	MinX float64
 	MinY float64
@@ -7,10 +12,171 @@ type BBox struct {
 	MaxY float64
 }
 
-// Data is a minimal geometry container for rendering
-type Data struct {
+// extend grows b to include pt; empty reports whether b holds no points yet.
+func (b *BBox) extend(pt [2]float64, empty bool) {
+	if empty {
+		*b = BBox{MinX: pt[0], MinY: pt[1], MaxX: pt[0], MaxY: pt[1]}
+		return
+	}
+	if pt[0] < b.MinX {
+		b.MinX = pt[0]
+	}
+	if pt[1] < b.MinY {
+		b.MinY = pt[1]
+	}
+	if pt[0] > b.MaxX {
+		b.MaxX = pt[0]
+	}
+	if pt[1] > b.MaxY {
+		b.MaxY = pt[1]
+	}
+}
+
+// Geometry holds the coordinates of a single feature. Type is the OGC/GeoJSON
+// type name (Point, MultiLineString, ...); multi-part geometries simply carry
+// several entries in the matching slice.
+type Geometry struct {
+	Type     string
 	Points   [][2]float64
 	Lines    [][][2]float64
 	Polygons [][][][2]float64 // polygons with rings (first outer, following holes)
+}
+
+// Empty reports whether g has no coordinates at all.
+func (g Geometry) Empty() bool {
+	return len(g.Points) == 0 && len(g.Lines) == 0 && len(g.Polygons) == 0
+}
+
+// EachVertex calls fn for every coordinate of g.
+func (g Geometry) EachVertex(fn func(p [2]float64)) {
+	for _, p := range g.Points {
+		fn(p)
+	}
+	for _, ls := range g.Lines {
+		for _, p := range ls {
+			fn(p)
+		}
+	}
+	for _, poly := range g.Polygons {
+		for _, ring := range poly {
+			for _, p := range ring {
+				fn(p)
+			}
+		}
+	}
+}
+
+// Feature is one geometry with its properties, as read from a source file.
+type Feature struct {
+	ID         string
+	Geometry   Geometry
+	Properties map[string]any
+	Layer      string // source layer (file, table, folder...) the feature came from
+}
+
+// FeatureCollection is what every loader returns: the features in file order,
+// the union of their property keys in first-seen order, and the overall bbox.
+// CRS names the source coordinate system when the format declares one, SRID
+// holds its EPSG code when known and CRSWKT its WKT definition when the
+// format carries one (a .prj file, FlatGeobuf or GeoPackage). Skipped lists
+// the 1-based line (or row) numbers of input records that could not be parsed
+// and were left out.
+type FeatureCollection struct {
+	Features []Feature
+	Keys     []string
 	BBox     BBox
+	CRS      string
+	SRID     int
+	CRSWKT   string
+	Skipped  []int
+	// SkippedRows is set when Skipped holds table rowids (GeoPackage)
+	// rather than line numbers.
+	SkippedRows bool
+}
+
+// SetSRID records an EPSG code as the collection's coordinate system.
+func (fc *FeatureCollection) SetSRID(srid int) {
+	fc.SRID = srid
+	fc.CRS = "EPSG:" + strconv.Itoa(srid)
+}
+
+// Transform replaces every vertex by fn(x, y), for reprojection, and
+// recomputes the bbox.
+func (fc *FeatureCollection) Transform(fn func(x, y float64) (float64, float64)) {
+	move := func(p *[2]float64) {
+		p[0], p[1] = fn(p[0], p[1])
+	}
+	empty := true
+	for _, f := range fc.Features {
+		g := f.Geometry
+		for i := range g.Points {
+			move(&g.Points[i])
+		}
+		for _, ls := range g.Lines {
+			for i := range ls {
+				move(&ls[i])
+			}
+		}
+		for _, poly := range g.Polygons {
+			for _, ring := range poly {
+				for i := range ring {
+					move(&ring[i])
+				}
+			}
+		}
+		g.EachVertex(func(p [2]float64) {
+			fc.BBox.extend(p, empty)
+			empty = false
+		})
+	}
+}
+
+// Add appends f, assigning a 1-based ID when it has none, and updates the
+// bbox and key list. Features without coordinates are dropped.
+func (fc *FeatureCollection) Add(f Feature) {
+	if f.Geometry.Empty() {
+		return
+	}
+	if f.ID == "" {
+		f.ID = strconv.Itoa(len(fc.Features) + 1)
+	}
+	empty := len(fc.Features) == 0
+	f.Geometry.EachVertex(func(p [2]float64) {
+		fc.BBox.extend(p, empty)
+		empty = false
+	})
+	for _, k := range propKeys(f.Properties) {
+		fc.addKey(k)
+	}
+	fc.Features = append(fc.Features, f)
+}
+
+func (fc *FeatureCollection) addKey(k string) {
+	for _, have := range fc.Keys {
+		if have == k {
+			return
+		}
+	}
+	fc.Keys = append(fc.Keys, k)
+}
+
+// Counts returns the number of points, line strings and polygons across all features.
+func (fc FeatureCollection) Counts() (pts, ls, polys int) {
+	for _, f := range fc.Features {
+		pts += len(f.Geometry.Points)
+		ls += len(f.Geometry.Lines)
+		polys += len(f.Geometry.Polygons)
+	}
+	return pts, ls, polys
+}
+
+// propKeys returns the keys of props in sorted order so that key discovery is
+// stable across runs; loaders that know the source order set Keys up front.
+func propKeys(props map[string]any) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
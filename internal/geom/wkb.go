@@ -0,0 +1,302 @@
+package geom
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EWKB flag bits used by PostGIS on top of the OGC type code.
+const (
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// wkbReader decodes one WKB geometry from b starting at off.
+type wkbReader struct {
+	b   []byte
+	off int
+}
+
+func (r *wkbReader) need(n int) error {
+	if n < 0 || r.off+n > len(r.b) {
+		return fmt.Errorf("wkb: unexpected end of data at byte %d", r.off)
+	}
+	return nil
+}
+
+func (r *wkbReader) uint32(order binary.ByteOrder) (uint32, error) {
+	if err := r.need(4); err != nil {
+		return 0, err
+	}
+	v := order.Uint32(r.b[r.off:])
+	r.off += 4
+	return v, nil
+}
+
+// coord reads a dims-ordinate coordinate and keeps X and Y.
+func (r *wkbReader) coord(order binary.ByteOrder, dims int) ([2]float64, error) {
+	if err := r.need(8 * dims); err != nil {
+		return [2]float64{}, err
+	}
+	x := math.Float64frombits(order.Uint64(r.b[r.off:]))
+	y := math.Float64frombits(order.Uint64(r.b[r.off+8:]))
+	r.off += 8 * dims
+	return [2]float64{x, y}, nil
+}
+
+func (r *wkbReader) coords(order binary.ByteOrder, dims int) ([][2]float64, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.need(int(n) * 8 * dims); err != nil {
+		return nil, err
+	}
+	out := make([][2]float64, 0, n)
+	for i := 0; i < int(n); i++ {
+		pt, err := r.coord(order, dims)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pt)
+	}
+	return out, nil
+}
+
+func (r *wkbReader) rings(order binary.ByteOrder, dims int) ([][][2]float64, error) {
+	n, err := r.uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	var out [][][2]float64
+	for i := 0; i < int(n); i++ {
+		ring, err := r.coords(order, dims)
+		if err != nil {
+			return nil, err
+		}
+		if len(ring) > 0 {
+			out = append(out, ring)
+		}
+	}
+	return out, nil
+}
+
+// geometry reads a byte-order-tagged geometry, returning the EWKB SRID if set.
+func (r *wkbReader) geometry() (Geometry, int, error) {
+	if err := r.need(1); err != nil {
+		return Geometry{}, 0, err
+	}
+	var order binary.ByteOrder
+	switch r.b[r.off] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return Geometry{}, 0, fmt.Errorf("wkb: invalid byte order %d at byte %d", r.b[r.off], r.off)
+	}
+	r.off++
+	code, err := r.uint32(order)
+	if err != nil {
+		return Geometry{}, 0, err
+	}
+	srid := 0
+	if code&ewkbSRID != 0 {
+		s, err := r.uint32(order)
+		if err != nil {
+			return Geometry{}, 0, err
+		}
+		srid = int(s)
+	}
+	dims := 2
+	if code&ewkbZ != 0 {
+		dims++
+	}
+	if code&ewkbM != 0 {
+		dims++
+	}
+	base := code &^ (ewkbZ | ewkbM | ewkbSRID)
+	// ISO WKB encodes dimensions as thousands: 1xxx Z, 2xxx M, 3xxx ZM
+	switch base / 1000 {
+	case 1, 2:
+		dims++
+	case 3:
+		dims += 2
+	}
+	base %= 1000
+
+	var g Geometry
+	switch base {
+	case 1:
+		g.Type = "Point"
+		pt, err := r.coord(order, dims)
+		if err != nil {
+			return g, srid, err
+		}
+		// POINT EMPTY is encoded as NaN coordinates
+		if !math.IsNaN(pt[0]) && !math.IsNaN(pt[1]) {
+			g.Points = append(g.Points, pt)
+		}
+	case 2:
+		g.Type = "LineString"
+		ls, err := r.coords(order, dims)
+		if err != nil {
+			return g, srid, err
+		}
+		if len(ls) > 0 {
+			g.Lines = append(g.Lines, ls)
+		}
+	case 3, 17: // Polygon, Triangle
+		g.Type = "Polygon"
+		poly, err := r.rings(order, dims)
+		if err != nil {
+			return g, srid, err
+		}
+		if len(poly) > 0 {
+			g.Polygons = append(g.Polygons, poly)
+		}
+	case 4, 5, 6, 7, 15, 16: // Multi*, GeometryCollection, PolyhedralSurface, TIN
+		g.Type = map[uint32]string{4: "MultiPoint", 5: "MultiLineString", 6: "MultiPolygon", 7: "GeometryCollection", 15: "MultiPolygon", 16: "MultiPolygon"}[base]
+		n, err := r.uint32(order)
+		if err != nil {
+			return g, srid, err
+		}
+		for i := 0; i < int(n); i++ {
+			sub, _, err := r.geometry()
+			if err != nil {
+				return g, srid, err
+			}
+			g.Points = append(g.Points, sub.Points...)
+			g.Lines = append(g.Lines, sub.Lines...)
+			g.Polygons = append(g.Polygons, sub.Polygons...)
+		}
+	default:
+		return g, srid, fmt.Errorf("wkb: unsupported geometry type %d", code)
+	}
+	return g, srid, nil
+}
+
+// ParseWKB decodes one OGC/ISO WKB or PostGIS EWKB geometry and returns it
+// with its SRID (0 when the encoding carries none).
+func ParseWKB(b []byte) (Geometry, int, error) {
+	r := &wkbReader{b: b}
+	g, srid, err := r.geometry()
+	if err != nil {
+		return Geometry{}, 0, err
+	}
+	if r.off != len(b) {
+		return Geometry{}, 0, fmt.Errorf("wkb: %d trailing bytes", len(b)-r.off)
+	}
+	return g, srid, nil
+}
+
+// decodeHexWKB decodes hex-encoded (E)WKB, accepting the "\x" prefix psql
+// prints for bytea values and ignoring whitespace.
+func decodeHexWKB(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, `\x`), "0x")
+	if len(s) == 0 {
+		return nil, errors.New("wkb: empty hex string")
+	}
+	return hex.DecodeString(s)
+}
+
+// isHex reports whether s (ignoring whitespace and a "\x"/"0x" prefix) is a
+// non-empty string of hex digits of even length.
+func isHex(s string) bool {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, `\x`), "0x")
+	if len(s) == 0 || len(s)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+// minWKB is the length of the shortest WKB geometry, an empty one: byte order,
+// type and a zero count.
+const minWKB = 9
+
+// isHexWKB reports whether s looks like hex (E)WKB: hex digits (see isHex)
+// for at least minWKB bytes, so that short numbers are not taken for it.
+func isHexWKB(s string) bool {
+	if !isHex(s) {
+		return false
+	}
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, `\x`), "0x")
+	return len(s) >= 2*minWKB
+}
+
+// ParseHexWKB decodes a hex-encoded WKB/EWKB geometry into a one-feature collection.
+func ParseHexWKB(s string) (FeatureCollection, error) {
+	b, err := decodeHexWKB(s)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	return wkbCollection(b, "")
+}
+
+// LoadWKB reads a .wkb file holding one or more concatenated binary (E)WKB
+// geometries, or hex-encoded ones one per line.
+func LoadWKB(path string) (FeatureCollection, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	return decodeWKB(b, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+// decodeWKB reads concatenated binary or line-separated hex (E)WKB (see
+// LoadWKB).
+func decodeWKB(b []byte, layer string) (FeatureCollection, error) {
+	if isHex(string(b)) {
+		// hex WKB is self-delimiting once decoded, so decode line by line and
+		// read the concatenation
+		var raw []byte
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			one, err := decodeHexWKB(line)
+			if err != nil {
+				return FeatureCollection{}, err
+			}
+			raw = append(raw, one...)
+		}
+		b = raw
+	}
+	return wkbCollection(b, layer)
+}
+
+// wkbCollection decodes consecutive WKB geometries from b, one feature each.
+func wkbCollection(b []byte, layer string) (FeatureCollection, error) {
+	var fc FeatureCollection
+	r := &wkbReader{b: b}
+	for r.off < len(b) {
+		g, srid, err := r.geometry()
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		if srid != 0 && fc.SRID == 0 {
+			fc.SetSRID(srid)
+		}
+		fc.Add(Feature{Geometry: g, Layer: layer})
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("wkb: no coordinates parsed")
+	}
+	return fc, nil
+}
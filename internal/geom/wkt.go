@@ -2,192 +2,445 @@ package geom
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
-// ParseWKT parses a subset of WKT and returns point vertices and bbox.
-// Supported: POINT(x y), MULTIPOINT(x y, ...), LINESTRING(x y, ...), POLYGON((x y, ...))
-func ParseWKT(wkt string) (points [][2]float64, bbox BBox, err error) {
-	s := strings.TrimSpace(wkt)
-	if s == "" {
-		return nil, BBox{}, errors.New("empty wkt")
-	}
-	upper := strings.ToUpper
-	advanceBBox := func(lon, lat float64) {
-		pt := [2]float64{lon, lat}
-		points = append(points, pt)
-		if len(points) == 1 {
-			bbox = BBox{MinX: lon, MinY: lat, MaxX: lon, MaxY: lat}
+// WKTError reports a syntax error in WKT input with the position it was found at.
+// Line and Col are 1-based; Col counts characters.
+type WKTError struct {
+	Offset int
+	Line   int
+	Col    int
+	Msg    string
+}
+
+func (e *WKTError) Error() string {
+	return fmt.Sprintf("%s at line %d, col %d", e.Msg, e.Line, e.Col)
+}
+
+type wktTokKind int
+
+const (
+	wktEOF wktTokKind = iota
+	wktWord
+	wktNumber
+	wktLParen
+	wktRParen
+	wktComma
+	wktSemicolon
+	wktEquals
+)
+
+type wktToken struct {
+	kind wktTokKind
+	text string // upper-cased for words
+	raw  string // as written, for error messages
+	pos  int
+}
+
+func (t wktToken) String() string {
+	switch t.kind {
+	case wktEOF:
+		return "end of input"
+	case wktLParen, wktRParen, wktComma, wktSemicolon, wktEquals:
+		return "'" + t.text + "'"
+	}
+	return strconv.Quote(t.raw)
+}
+
+// wktParser is a recursive-descent parser over the OGC Simple Features WKT grammar.
+type wktParser struct {
+	src string
+	pos int
+	tok wktToken
+}
+
+func newWKTParser(s string) (*wktParser, error) {
+	p := &wktParser{src: s}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *wktParser) errorf(pos int, format string, args ...any) error {
+	line, col := 1, 1
+	for _, r := range p.src[:min(pos, len(p.src))] {
+		if r == '\n' {
+			line++
+			col = 1
 		} else {
-			if lon < bbox.MinX {
-				bbox.MinX = lon
-			}
-			if lat < bbox.MinY {
-				bbox.MinY = lat
-			}
-			if lon > bbox.MaxX {
-				bbox.MaxX = lon
-			}
-			if lat > bbox.MaxY {
-				bbox.MaxY = lat
-			}
+			col++
 		}
 	}
-	parseCoords := func(block string) {
-		block = strings.TrimSpace(block)
-		// split by comma into tuples "x y"
-		for _, tup := range strings.Split(block, ",") {
-			parts := strings.Fields(strings.TrimSpace(tup))
-			if len(parts) < 2 {
-				continue
-			}
-			x, err1 := strconv.ParseFloat(parts[0], 64)
-			y, err2 := strconv.ParseFloat(parts[1], 64)
-			if err1 != nil || err2 != nil {
+	return &WKTError{Offset: pos, Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next advances to the following token.
+func (p *wktParser) next() error {
+	s := p.src
+	for p.pos < len(s) && (s[p.pos] == ' ' || s[p.pos] == '\t' || s[p.pos] == '\n' || s[p.pos] == '\r') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(s) {
+		p.tok = wktToken{kind: wktEOF, pos: start}
+		return nil
+	}
+	c := s[p.pos]
+	switch {
+	case c == '(' || c == '[':
+		p.pos++
+		p.tok = wktToken{kind: wktLParen, text: "(", pos: start}
+	case c == ')' || c == ']':
+		p.pos++
+		p.tok = wktToken{kind: wktRParen, text: ")", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = wktToken{kind: wktComma, text: ",", pos: start}
+	case c == ';':
+		p.pos++
+		p.tok = wktToken{kind: wktSemicolon, text: ";", pos: start}
+	case c == '=':
+		p.pos++
+		p.tok = wktToken{kind: wktEquals, text: "=", pos: start}
+	case isWKTLetter(c):
+		for p.pos < len(s) && (isWKTLetter(s[p.pos]) || s[p.pos] == '_') {
+			p.pos++
+		}
+		p.tok = wktToken{kind: wktWord, text: strings.ToUpper(s[start:p.pos]), raw: s[start:p.pos], pos: start}
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		p.pos++
+		for p.pos < len(s) {
+			c := s[p.pos]
+			if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' ||
+				((c == '-' || c == '+') && (s[p.pos-1] == 'e' || s[p.pos-1] == 'E')) {
+				p.pos++
 				continue
 			}
-			advanceBBox(x, y)
+			break
 		}
-	}
-	switch {
-	case strings.HasPrefix(upper(s), "POINT"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return nil, BBox{}, errors.New("wkt point: invalid")
-		}
-		parseCoords(s[i+1 : j])
-	case strings.HasPrefix(upper(s), "MULTIPOINT"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return nil, BBox{}, errors.New("wkt multipoint: invalid")
-		}
-		parseCoords(s[i+1 : j])
-	case strings.HasPrefix(upper(s), "LINESTRING"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return nil, BBox{}, errors.New("wkt linestring: invalid")
-		}
-		parseCoords(s[i+1 : j])
-	case strings.HasPrefix(upper(s), "POLYGON"):
-		i := strings.Index(s, "((")
-		j := strings.LastIndex(s, "))")
-		if i < 0 || j <= i {
-			return nil, BBox{}, errors.New("wkt polygon: invalid")
-		}
-		parseCoords(s[i+2 : j])
+		p.tok = wktToken{kind: wktNumber, text: s[start:p.pos], raw: s[start:p.pos], pos: start}
 	default:
-		return nil, BBox{}, errors.New("unsupported wkt type")
+		return p.errorf(start, "unexpected character %q", c)
 	}
-	if len(points) == 0 {
-		return nil, BBox{}, errors.New("wkt: no coordinates parsed")
+	return nil
+}
+
+func isWKTLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *wktParser) expect(kind wktTokKind, what string) error {
+	if p.tok.kind != kind {
+		return p.errorf(p.tok.pos, "expected %s, found %s", what, p.tok)
 	}
-	return points, bbox, nil
+	return p.next()
+}
+
+// wktBaseTypes maps WKT keywords to geometry type names.
+var wktBaseTypes = map[string]string{
+	"POINT":              "Point",
+	"LINESTRING":         "LineString",
+	"POLYGON":            "Polygon",
+	"MULTIPOINT":         "MultiPoint",
+	"MULTILINESTRING":    "MultiLineString",
+	"MULTIPOLYGON":       "MultiPolygon",
+	"GEOMETRYCOLLECTION": "GeometryCollection",
+	"TRIANGLE":           "Polygon",
+	"TIN":                "MultiPolygon",
+	"POLYHEDRALSURFACE":  "MultiPolygon",
 }
 
-// ParseWKTData returns Data for LINESTRING/POLYGON, or points for POINT/MULTIPOINT
-func ParseWKTData(wkt string) (Data, error) {
-	s := strings.TrimSpace(wkt)
-	if s == "" {
-		return Data{}, errors.New("empty wkt")
+// geometry parses one tagged geometry: TYPE [Z|M|ZM] (EMPTY | body).
+func (p *wktParser) geometry() (Geometry, error) {
+	if p.tok.kind != wktWord {
+		return Geometry{}, p.errorf(p.tok.pos, "expected geometry type, found %s", p.tok)
 	}
-	up := strings.ToUpper(s)
-	var d Data
-	mkbb := func(lon, lat float64) {
-		if len(d.Points)+len(d.Lines)+len(d.Polygons) == 0 {
-			d.BBox = BBox{MinX: lon, MinY: lat, MaxX: lon, MaxY: lat}
-		} else {
-			if lon < d.BBox.MinX {
-				d.BBox.MinX = lon
+	kwPos := p.tok.pos
+	kw := p.tok.text
+	dims := 0 // 0 = unspecified, accept 2..4 ordinates
+	typ, ok := wktBaseTypes[kw]
+	if !ok {
+		// tolerate run-together dimension suffixes such as POINTZ or LINESTRINGZM
+		for _, suf := range []string{"ZM", "Z", "M"} {
+			if t, ok2 := wktBaseTypes[strings.TrimSuffix(kw, suf)]; ok2 && strings.HasSuffix(kw, suf) {
+				typ, ok, dims = t, true, 2+len(suf)
+				kw = strings.TrimSuffix(kw, suf)
+				break
+			}
+		}
+	}
+	if !ok {
+		return Geometry{}, p.errorf(kwPos, "unsupported geometry type %s", kw)
+	}
+	if err := p.next(); err != nil {
+		return Geometry{}, err
+	}
+	if p.tok.kind == wktWord && p.tok.text != "EMPTY" {
+		switch p.tok.text {
+		case "Z", "M":
+			dims = 3
+		case "ZM":
+			dims = 4
+		default:
+			return Geometry{}, p.errorf(p.tok.pos, "expected Z, M, ZM, EMPTY or '(', found %s", p.tok)
+		}
+		if err := p.next(); err != nil {
+			return Geometry{}, err
+		}
+	}
+	g := Geometry{Type: typ}
+	if p.tok.kind == wktWord && p.tok.text == "EMPTY" {
+		return g, p.next()
+	}
+	var err error
+	switch kw {
+	case "POINT":
+		var pt [2]float64
+		if err = p.expect(wktLParen, "'('"); err != nil {
+			return g, err
+		}
+		if pt, err = p.coord(dims); err != nil {
+			return g, err
+		}
+		g.Points = append(g.Points, pt)
+		err = p.expect(wktRParen, "')'")
+	case "LINESTRING":
+		var ls [][2]float64
+		ls, err = p.coordList(dims)
+		g.Lines = append(g.Lines, ls)
+	case "POLYGON", "TRIANGLE":
+		var poly [][][2]float64
+		poly, err = p.polygon(dims)
+		g.Polygons = append(g.Polygons, poly)
+	case "MULTIPOINT":
+		g.Points, err = p.multiPoint(dims)
+	case "MULTILINESTRING":
+		err = p.list(func() error {
+			ls, err := p.coordList(dims)
+			if len(ls) > 0 {
+				g.Lines = append(g.Lines, ls)
 			}
-			if lat < d.BBox.MinY {
-				d.BBox.MinY = lat
+			return err
+		})
+	case "MULTIPOLYGON", "TIN", "POLYHEDRALSURFACE":
+		err = p.list(func() error {
+			poly, err := p.polygon(dims)
+			if len(poly) > 0 {
+				g.Polygons = append(g.Polygons, poly)
 			}
-			if lon > d.BBox.MaxX {
-				d.BBox.MaxX = lon
+			return err
+		})
+	case "GEOMETRYCOLLECTION":
+		err = p.list(func() error {
+			sub, err := p.geometry()
+			g.Points = append(g.Points, sub.Points...)
+			g.Lines = append(g.Lines, sub.Lines...)
+			g.Polygons = append(g.Polygons, sub.Polygons...)
+			return err
+		})
+	}
+	return g, err
+}
+
+// list parses '(' item {',' item} ')', where item may also be EMPTY.
+func (p *wktParser) list(item func() error) error {
+	if err := p.expect(wktLParen, "'('"); err != nil {
+		return err
+	}
+	for {
+		if p.tok.kind == wktWord && p.tok.text == "EMPTY" {
+			if err := p.next(); err != nil {
+				return err
 			}
-			if lat > d.BBox.MaxY {
-				d.BBox.MaxY = lat
+		} else if err := item(); err != nil {
+			return err
+		}
+		if p.tok.kind == wktComma {
+			if err := p.next(); err != nil {
+				return err
 			}
+			continue
 		}
+		return p.expect(wktRParen, "',' or ')'")
 	}
-	parseTuples := func(block string) [][2]float64 {
-		var out [][2]float64
-		for _, tup := range strings.Split(block, ",") {
-			parts := strings.Fields(strings.TrimSpace(tup))
-			if len(parts) < 2 {
-				continue
+}
+
+// coord parses a single coordinate tuple and keeps its first two ordinates.
+func (p *wktParser) coord(dims int) ([2]float64, error) {
+	var vals []float64
+	start := p.tok.pos
+	for p.tok.kind == wktNumber {
+		v, err := strconv.ParseFloat(p.tok.text, 64)
+		if err != nil {
+			return [2]float64{}, p.errorf(p.tok.pos, "invalid number %q", p.tok.text)
+		}
+		vals = append(vals, v)
+		if err := p.next(); err != nil {
+			return [2]float64{}, err
+		}
+	}
+	switch {
+	case len(vals) < 2:
+		return [2]float64{}, p.errorf(p.tok.pos, "expected number, found %s", p.tok)
+	case dims != 0 && len(vals) != dims:
+		return [2]float64{}, p.errorf(start, "coordinate has %d ordinates, expected %d", len(vals), dims)
+	case len(vals) > 4:
+		return [2]float64{}, p.errorf(start, "coordinate has %d ordinates, expected 2 to 4", len(vals))
+	}
+	return [2]float64{vals[0], vals[1]}, nil
+}
+
+// coordList parses '(' coord {',' coord} ')'.
+func (p *wktParser) coordList(dims int) ([][2]float64, error) {
+	var out [][2]float64
+	err := p.list(func() error {
+		pt, err := p.coord(dims)
+		if err == nil {
+			out = append(out, pt)
+		}
+		return err
+	})
+	return out, err
+}
+
+// polygon parses '(' ring {',' ring} ')'.
+func (p *wktParser) polygon(dims int) ([][][2]float64, error) {
+	var out [][][2]float64
+	err := p.list(func() error {
+		ring, err := p.coordList(dims)
+		if len(ring) > 0 {
+			out = append(out, ring)
+		}
+		return err
+	})
+	return out, err
+}
+
+// multiPoint accepts both MULTIPOINT((1 2),(3 4)) and MULTIPOINT(1 2, 3 4).
+func (p *wktParser) multiPoint(dims int) ([][2]float64, error) {
+	var out [][2]float64
+	err := p.list(func() error {
+		if p.tok.kind == wktLParen {
+			if err := p.next(); err != nil {
+				return err
 			}
-			x, e1 := strconv.ParseFloat(parts[0], 64)
-			y, e2 := strconv.ParseFloat(parts[1], 64)
-			if e1 != nil || e2 != nil {
-				continue
+			pt, err := p.coord(dims)
+			if err != nil {
+				return err
 			}
-			out = append(out, [2]float64{x, y})
+			out = append(out, pt)
+			return p.expect(wktRParen, "')'")
+		}
+		pt, err := p.coord(dims)
+		if err == nil {
+			out = append(out, pt)
 		}
-		return out
+		return err
+	})
+	return out, err
+}
+
+// ParseWKTGeometry parses a single WKT geometry of any OGC simple feature type,
+// including GEOMETRYCOLLECTION, Z/M/ZM dimensions and EMPTY. Only X and Y are
+// kept. Syntax errors are returned as *WKTError.
+func ParseWKTGeometry(wkt string) (Geometry, error) {
+	p, err := newWKTParser(wkt)
+	if err != nil {
+		return Geometry{}, err
 	}
-	switch {
-	case strings.HasPrefix(up, "POINT"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return Data{}, errors.New("wkt point: invalid")
-		}
-		pts := parseTuples(s[i+1 : j])
-		d.Points = append(d.Points, pts...)
-		for _, p := range pts {
-			mkbb(p[0], p[1])
-		}
-		return d, nil
-	case strings.HasPrefix(up, "MULTIPOINT"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return Data{}, errors.New("wkt multipoint: invalid")
-		}
-		pts := parseTuples(s[i+1 : j])
-		d.Points = append(d.Points, pts...)
-		for _, p := range pts {
-			mkbb(p[0], p[1])
-		}
-		return d, nil
-	case strings.HasPrefix(up, "LINESTRING"):
-		i := strings.Index(s, "(")
-		j := strings.LastIndex(s, ")")
-		if i < 0 || j <= i {
-			return Data{}, errors.New("wkt linestring: invalid")
-		}
-		ls := parseTuples(s[i+1 : j])
-		d.Lines = append(d.Lines, ls)
-		for _, p := range ls {
-			mkbb(p[0], p[1])
-		}
-		return d, nil
-	case strings.HasPrefix(up, "POLYGON"):
-		i := strings.Index(s, "((")
-		j := strings.LastIndex(s, "))")
-		if i < 0 || j <= i {
-			return Data{}, errors.New("wkt polygon: invalid")
-		}
-		ringsStr := s[i+2 : j]
-		// normalize spaces around ring separators
-		ringsNorm := strings.ReplaceAll(ringsStr, "), (", "),(")
-		ringsNorm = strings.ReplaceAll(ringsNorm, ") , (", "),(")
-		ringParts := strings.Split(ringsNorm, "),(")
-		var poly [][][2]float64
-		for _, rp := range ringParts {
-			pts := parseTuples(rp)
-			poly = append(poly, pts)
-			for _, p := range pts {
-				mkbb(p[0], p[1])
+	if p.tok.kind == wktEOF {
+		return Geometry{}, errors.New("empty wkt")
+	}
+	g, err := p.geometry()
+	if err != nil {
+		return Geometry{}, err
+	}
+	if p.tok.kind != wktEOF {
+		return Geometry{}, p.errorf(p.tok.pos, "unexpected %s after geometry", p.tok)
+	}
+	return g, nil
+}
+
+// ParseWKT parses WKT and returns all vertices and their bbox.
+func ParseWKT(wkt string) (points [][2]float64, bbox BBox, err error) {
+	g, err := ParseWKTGeometry(wkt)
+	if err != nil {
+		return nil, BBox{}, err
+	}
+	g.EachVertex(func(p [2]float64) {
+		bbox.extend(p, len(points) == 0)
+		points = append(points, p)
+	})
+	if len(points) == 0 {
+		return nil, BBox{}, errors.New("wkt: no coordinates parsed")
+	}
+	return points, bbox, nil
+}
+
+// ParseWKTData parses one or more WKT geometries separated by newlines or
+// semicolons, each optionally carrying a PostGIS "SRID=n;" prefix (EWKT).
+// Every geometry becomes a feature with its 1-based "row" in the input and
+// its "type". The first SRID seen is recorded on the collection.
+func ParseWKTData(wkt string) (FeatureCollection, error) {
+	p, err := newWKTParser(wkt)
+	if err != nil {
+		return FeatureCollection{}, err
+	}
+	fc := FeatureCollection{Keys: []string{"row", "type"}}
+	row := 0
+	for {
+		for p.tok.kind == wktSemicolon {
+			if err := p.next(); err != nil {
+				return FeatureCollection{}, err
 			}
 		}
-		d.Polygons = append(d.Polygons, poly)
-		return d, nil
+		if p.tok.kind == wktEOF {
+			break
+		}
+		srid, err := p.sridPrefix()
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		row++
+		g, err := p.geometry()
+		if err != nil {
+			return FeatureCollection{}, err
+		}
+		if srid != 0 && fc.SRID == 0 {
+			fc.SetSRID(srid)
+		}
+		fc.Add(Feature{Geometry: g, Properties: map[string]any{"row": row, "type": g.Type}})
+	}
+	if row == 0 {
+		return FeatureCollection{}, errors.New("empty wkt")
+	}
+	if len(fc.Features) == 0 {
+		return FeatureCollection{}, errors.New("wkt: no coordinates parsed")
+	}
+	return fc, nil
+}
+
+// sridPrefix consumes an optional "SRID=n;" prefix and returns n (0 if absent).
+func (p *wktParser) sridPrefix() (int, error) {
+	if p.tok.kind != wktWord || p.tok.text != "SRID" {
+		return 0, nil
+	}
+	if err := p.next(); err != nil {
+		return 0, err
+	}
+	if err := p.expect(wktEquals, "'='"); err != nil {
+		return 0, err
+	}
+	srid, err := strconv.Atoi(p.tok.text)
+	if p.tok.kind != wktNumber || err != nil {
+		return 0, p.errorf(p.tok.pos, "expected SRID number, found %s", p.tok)
+	}
+	if err := p.next(); err != nil {
+		return 0, err
 	}
-	return Data{}, errors.New("unsupported wkt type")
+	return srid, p.expect(wktSemicolon, "';' after SRID")
 }
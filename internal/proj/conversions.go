@@ -0,0 +1,178 @@
+package proj
+
+import "math"
+
+// TransverseMercator is the transverse Mercator projection (UTM, Gauss-Krüger
+// and most national grids), using the series of Snyder's "Map Projections -
+// A Working Manual", accurate to millimetres within a few degrees of the
+// central meridian.
+type TransverseMercator struct {
+	Lat0, Lon0 float64 // natural origin, radians
+	K0         float64 // scale factor on the central meridian
+	FE, FN     float64 // false easting and northing, metres
+}
+
+func (TransverseMercator) Method() string { return "Transverse Mercator" }
+
+// meridianArc is the distance along the meridian from the equator to phi.
+func meridianArc(e Ellipsoid, phi float64) float64 {
+	e2 := e.e2()
+	e4, e6 := e2*e2, e2*e2*e2
+	return e.A * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+func (p TransverseMercator) forward(e Ellipsoid, lon, lat float64) (float64, float64) {
+	e2 := e.e2()
+	ep2 := e2 / (1 - e2)
+	sin, cos, tan := math.Sin(lat), math.Cos(lat), math.Tan(lat)
+	n := e.A / math.Sqrt(1-e2*sin*sin)
+	t := tan * tan
+	c := ep2 * cos * cos
+	a := (lon - p.Lon0) * cos
+	m := meridianArc(e, lat) - meridianArc(e, p.Lat0)
+	x := p.K0 * n * (a + (1-t+c)*math.Pow(a, 3)/6 + (5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120)
+	y := p.K0 * (m + n*tan*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	return p.FE + x, p.FN + y
+}
+
+func (p TransverseMercator) inverse(e Ellipsoid, x, y float64) (float64, float64) {
+	e2 := e.e2()
+	ep2 := e2 / (1 - e2)
+	m := meridianArc(e, p.Lat0) + (y-p.FN)/p.K0
+	mu := m / (e.A * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	c1 := ep2 * cos * cos
+	t1 := tan * tan
+	n1 := e.A / math.Sqrt(1-e2*sin*sin)
+	r1 := e.A * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := (x - p.FE) / (n1 * p.K0)
+	lat := phi1 - (n1*tan/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lon := p.Lon0 + (d-(1+2*t1+c1)*math.Pow(d, 3)/6+
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120)/cos
+	return lon, lat
+}
+
+// LambertConformalConic is the ellipsoidal Lambert conformal conic. With two
+// distinct standard parallels (2SP) Lat0/Lon0 is the false origin and K0 is
+// 1; with Lat1 == Lat2 == Lat0 it is the one-parallel form (1SP) with scale
+// factor K0.
+type LambertConformalConic struct {
+	Lat0, Lon0 float64
+	Lat1, Lat2 float64
+	K0         float64
+	FE, FN     float64
+}
+
+func (LambertConformalConic) Method() string { return "Lambert Conformal Conic" }
+
+// lccT is Snyder's t: the isometric-latitude term of conformal projections.
+func lccT(e Ellipsoid, phi float64) float64 {
+	ecc := math.Sqrt(e.e2())
+	s := ecc * math.Sin(phi)
+	return math.Tan(math.Pi/4-phi/2) / math.Pow((1-s)/(1+s), ecc/2)
+}
+
+func lccM(e Ellipsoid, phi float64) float64 {
+	s := math.Sin(phi)
+	return math.Cos(phi) / math.Sqrt(1-e.e2()*s*s)
+}
+
+// constants returns the cone constant n, aF (scaled by K0) and rho0.
+func (p LambertConformalConic) constants(e Ellipsoid) (n, af, rho0 float64) {
+	m1, t1 := lccM(e, p.Lat1), lccT(e, p.Lat1)
+	if math.Abs(p.Lat1-p.Lat2) < 1e-10 {
+		n = math.Sin(p.Lat1)
+	} else {
+		n = (math.Log(m1) - math.Log(lccM(e, p.Lat2))) / (math.Log(t1) - math.Log(lccT(e, p.Lat2)))
+	}
+	k0 := p.K0
+	if k0 == 0 {
+		k0 = 1
+	}
+	af = e.A * m1 / (n * math.Pow(t1, n)) * k0
+	return n, af, af * math.Pow(lccT(e, p.Lat0), n)
+}
+
+func (p LambertConformalConic) forward(e Ellipsoid, lon, lat float64) (float64, float64) {
+	n, af, rho0 := p.constants(e)
+	rho := af * math.Pow(lccT(e, lat), n)
+	theta := n * (lon - p.Lon0)
+	return p.FE + rho*math.Sin(theta), p.FN + rho0 - rho*math.Cos(theta)
+}
+
+func (p LambertConformalConic) inverse(e Ellipsoid, x, y float64) (float64, float64) {
+	n, af, rho0 := p.constants(e)
+	dx, dy := x-p.FE, rho0-(y-p.FN)
+	sign := math.Copysign(1, n)
+	rho := sign * math.Hypot(dx, dy)
+	theta := math.Atan2(sign*dx, sign*dy)
+	return theta/n + p.Lon0, conformalLat(e, math.Pow(rho/af, 1/n))
+}
+
+// conformalLat inverts lccT by iteration.
+func conformalLat(e Ellipsoid, t float64) float64 {
+	ecc := math.Sqrt(e.e2())
+	phi := math.Pi/2 - 2*math.Atan(t)
+	for i := 0; i < 15; i++ {
+		s := ecc * math.Sin(phi)
+		next := math.Pi/2 - 2*math.Atan(t*math.Pow((1-s)/(1+s), ecc/2))
+		if math.Abs(next-phi) < 1e-12 {
+			return next
+		}
+		phi = next
+	}
+	return phi
+}
+
+// Mercator is the normal Mercator on the ellipsoid, or on a sphere of the
+// ellipsoid's semi-major axis when Spherical is set (Web Mercator).
+type Mercator struct {
+	Lon0      float64
+	K0        float64
+	FE, FN    float64
+	Spherical bool
+}
+
+func (p Mercator) Method() string {
+	if p.Spherical {
+		return "Popular Visualisation Pseudo Mercator"
+	}
+	return "Mercator"
+}
+
+func (p Mercator) ellipsoid(e Ellipsoid) Ellipsoid {
+	if p.Spherical {
+		e.InvF = 0
+	}
+	return e
+}
+
+func (p Mercator) k0() float64 {
+	if p.K0 == 0 {
+		return 1
+	}
+	return p.K0
+}
+
+func (p Mercator) forward(e Ellipsoid, lon, lat float64) (float64, float64) {
+	e = p.ellipsoid(e)
+	lat = math.Max(-rad(MaxMercatorLat), math.Min(rad(MaxMercatorLat), lat))
+	ak := e.A * p.k0()
+	return p.FE + ak*(lon-p.Lon0), p.FN - ak*math.Log(lccT(e, lat))
+}
+
+func (p Mercator) inverse(e Ellipsoid, x, y float64) (float64, float64) {
+	e = p.ellipsoid(e)
+	ak := e.A * p.k0()
+	return p.Lon0 + (x-p.FE)/ak, conformalLat(e, math.Exp(-(y-p.FN)/ak))
+}
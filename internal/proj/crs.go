@@ -0,0 +1,259 @@
+package proj
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ellipsoid is a reference ellipsoid: semi-major axis in metres and inverse
+// flattening (0 for a sphere).
+type Ellipsoid struct {
+	Name string
+	A    float64
+	InvF float64
+}
+
+var (
+	WGS84         = Ellipsoid{"WGS 84", 6378137, 298.257223563}
+	GRS80         = Ellipsoid{"GRS 1980", 6378137, 298.257222101}
+	Airy1830      = Ellipsoid{"Airy 1830", 6377563.396, 299.3249646}
+	AiryModified  = Ellipsoid{"Airy Modified 1849", 6377340.189, 299.3249646}
+	Clarke1866    = Ellipsoid{"Clarke 1866", 6378206.4, 294.9786982}
+	International = Ellipsoid{"International 1924", 6378388, 297}
+	Bessel1841    = Ellipsoid{"Bessel 1841", 6377397.155, 299.1528128}
+)
+
+// e2 is the first eccentricity squared.
+func (e Ellipsoid) e2() float64 {
+	if e.InvF == 0 {
+		return 0
+	}
+	f := 1 / e.InvF
+	return f * (2 - f)
+}
+
+// Datum is a geodetic datum: its ellipsoid and the seven-parameter Helmert
+// transformation to WGS 84 in the position vector convention of WKT
+// TOWGS84: translations in metres, rotations in arc-seconds, scale in ppm.
+type Datum struct {
+	Name      string
+	Ellipsoid Ellipsoid
+	ToWGS84   [7]float64
+}
+
+var (
+	DatumWGS84  = Datum{Name: "WGS 84", Ellipsoid: WGS84}
+	DatumETRS89 = Datum{Name: "ETRS89", Ellipsoid: GRS80}
+	DatumNAD83  = Datum{Name: "NAD83", Ellipsoid: GRS80}
+	DatumOSGB36 = Datum{"OSGB 1936", Airy1830, [7]float64{446.448, -125.157, 542.06, 0.15, 0.247, 0.842, -20.489}}
+	DatumTM75   = Datum{"TM75", AiryModified, [7]float64{482.5, -130.6, 564.6, -1.042, -0.214, -0.631, 8.15}}
+	DatumNAD27  = Datum{"NAD27", Clarke1866, [7]float64{-8, 160, 176}}
+	DatumED50   = Datum{"ED50", International, [7]float64{-87, -98, -121}}
+	DatumDHDN   = Datum{"DHDN", Bessel1841, [7]float64{598.1, 73.7, 418.2, 0.202, 0.045, -2.455, 6.7}}
+)
+
+// Conversion is a map projection method with its parameters, on a given
+// ellipsoid. Angles are in radians and distances in metres.
+type Conversion interface {
+	Method() string
+	forward(e Ellipsoid, lon, lat float64) (x, y float64)
+	inverse(e Ellipsoid, x, y float64) (lon, lat float64)
+}
+
+// CRS is a coordinate reference system: geographic lon/lat in degrees when
+// Conversion is nil, projected otherwise.
+type CRS struct {
+	Name       string
+	EPSG       int // 0 when not known
+	Datum      Datum
+	Conversion Conversion
+	Unit       float64 // metres per projected unit; 0 means 1
+}
+
+// IsWGS84 reports whether coordinates in c are already WGS 84 lon/lat, to
+// the accuracy of a terminal map. ETRS89 and NAD83 are treated as WGS 84.
+func (c *CRS) IsWGS84() bool {
+	return c.Conversion == nil && c.Datum.ToWGS84 == [7]float64{}
+}
+
+// ToWGS84 converts a position in c to WGS 84 lon/lat degrees.
+func (c *CRS) ToWGS84(x, y float64) (lon, lat float64) {
+	if c.Conversion != nil {
+		u := c.unit()
+		x, y = c.Conversion.inverse(c.Datum.Ellipsoid, x*u, y*u)
+		lon, lat = x*180/math.Pi, y*180/math.Pi
+	} else {
+		lon, lat = x, y
+	}
+	if c.Datum.ToWGS84 != [7]float64{} {
+		lon, lat = helmert(lon, lat, c.Datum.Ellipsoid, WGS84, c.Datum.ToWGS84, 1)
+	}
+	return lon, lat
+}
+
+// FromWGS84 converts WGS 84 lon/lat degrees to a position in c.
+func (c *CRS) FromWGS84(lon, lat float64) (x, y float64) {
+	if c.Datum.ToWGS84 != [7]float64{} {
+		lon, lat = helmert(lon, lat, WGS84, c.Datum.Ellipsoid, c.Datum.ToWGS84, -1)
+	}
+	if c.Conversion == nil {
+		return lon, lat
+	}
+	x, y = c.Conversion.forward(c.Datum.Ellipsoid, lon*math.Pi/180, lat*math.Pi/180)
+	u := c.unit()
+	return x / u, y / u
+}
+
+func (c *CRS) unit() float64 {
+	if c.Unit == 0 {
+		return 1
+	}
+	return c.Unit
+}
+
+// String names c, with its EPSG code when known.
+func (c *CRS) String() string {
+	switch {
+	case c.EPSG != 0 && c.Name != "":
+		return fmt.Sprintf("EPSG:%d (%s)", c.EPSG, c.Name)
+	case c.EPSG != 0:
+		return fmt.Sprintf("EPSG:%d", c.EPSG)
+	}
+	return c.Name
+}
+
+// helmert shifts geodetic lon/lat degrees from ellipsoid src to dst through
+// geocentric coordinates, applying p (sign -1 for the approximate reverse).
+func helmert(lon, lat float64, src, dst Ellipsoid, p [7]float64, sign float64) (float64, float64) {
+	const arcsec = math.Pi / 180 / 3600
+	x, y, z := toECEF(src, lon*math.Pi/180, lat*math.Pi/180)
+	tx, ty, tz := sign*p[0], sign*p[1], sign*p[2]
+	rx, ry, rz := sign*p[3]*arcsec, sign*p[4]*arcsec, sign*p[5]*arcsec
+	s := 1 + sign*p[6]*1e-6
+	x, y, z = tx+s*(x-rz*y+ry*z), ty+s*(rz*x+y-rx*z), tz+s*(-ry*x+rx*y+z)
+	lam, phi := fromECEF(dst, x, y, z)
+	return lam * 180 / math.Pi, phi * 180 / math.Pi
+}
+
+// toECEF converts geodetic coordinates (radians, on the ellipsoid surface) to
+// geocentric X, Y, Z.
+func toECEF(e Ellipsoid, lam, phi float64) (x, y, z float64) {
+	e2 := e.e2()
+	sin := math.Sin(phi)
+	n := e.A / math.Sqrt(1-e2*sin*sin)
+	return n * math.Cos(phi) * math.Cos(lam), n * math.Cos(phi) * math.Sin(lam), n * (1 - e2) * sin
+}
+
+// fromECEF converts geocentric X, Y, Z to geodetic lon/lat in radians.
+func fromECEF(e Ellipsoid, x, y, z float64) (lam, phi float64) {
+	e2 := e.e2()
+	p := math.Hypot(x, y)
+	phi = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 5; i++ {
+		sin := math.Sin(phi)
+		n := e.A / math.Sqrt(1-e2*sin*sin)
+		h := p/math.Cos(phi) - n
+		phi = math.Atan2(z, p*(1-e2*n/(n+h)))
+	}
+	return math.Atan2(y, x), phi
+}
+
+// crsCodeRe extracts an EPSG code from "EPSG:27700", "urn:ogc:def:crs:EPSG::27700",
+// "urn:ogc:def:crs:EPSG:6.6:27700" or ".../def/crs/EPSG/0/27700".
+var crsCodeRe = regexp.MustCompile(`(?i)^(?:.*[:/])?epsg(?::|::|:[\d.]*:|/0/)(\d+)$`)
+
+// Parse reads a CRS given as an EPSG code in any common spelling, as OGC
+// CRS84, or as WKT (a .prj file).
+func Parse(s string) (*CRS, error) {
+	s = strings.TrimSpace(s)
+	if m := crsCodeRe.FindStringSubmatch(s); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return EPSG(code)
+	}
+	if strings.HasSuffix(strings.ToUpper(s), "CRS84") {
+		return EPSG(4326)
+	}
+	if strings.Contains(s, "[") {
+		return ParseWKT(s)
+	}
+	return nil, fmt.Errorf("proj: unrecognised CRS %q", s)
+}
+
+// EPSG returns a built-in CRS by EPSG code: WGS 84 and its near-equivalents,
+// Web Mercator, UTM zones on WGS 84, ETRS89, NAD83, NAD27 and ED50, and a
+// set of national grids.
+func EPSG(code int) (*CRS, error) {
+	geog := func(name string, d Datum) (*CRS, error) {
+		return &CRS{Name: name, EPSG: code, Datum: d}, nil
+	}
+	tm := func(name string, d Datum, lat0, lon0, k0, fe, fn float64) (*CRS, error) {
+		return &CRS{Name: name, EPSG: code, Datum: d, Conversion: TransverseMercator{Lat0: rad(lat0), Lon0: rad(lon0), K0: k0, FE: fe, FN: fn}}, nil
+	}
+	utm := func(datum string, d Datum, zone int, south bool) (*CRS, error) {
+		fn, hemi := 0.0, "N"
+		if south {
+			fn, hemi = 10000000, "S"
+		}
+		return tm(fmt.Sprintf("%s / UTM zone %d%s", datum, zone, hemi), d, 0, float64(zone*6-183), 0.9996, 500000, fn)
+	}
+	switch {
+	case code == 4326:
+		return geog("WGS 84", DatumWGS84)
+	case code == 4258:
+		return geog("ETRS89", DatumETRS89)
+	case code == 4269:
+		return geog("NAD83", DatumNAD83)
+	case code == 4283:
+		return geog("GDA94", Datum{Name: "GDA94", Ellipsoid: GRS80})
+	case code == 4167:
+		return geog("NZGD2000", Datum{Name: "NZGD2000", Ellipsoid: GRS80})
+	case code == 4277:
+		return geog("OSGB 1936", DatumOSGB36)
+	case code == 4267:
+		return geog("NAD27", DatumNAD27)
+	case code == 4230:
+		return geog("ED50", DatumED50)
+	case code == 4314:
+		return geog("DHDN", DatumDHDN)
+	case code == 3857 || code == 900913 || code == 3785 || code == 102100 || code == 102113:
+		return &CRS{Name: "WGS 84 / Pseudo-Mercator", EPSG: code, Datum: DatumWGS84, Conversion: Mercator{Spherical: true, K0: 1}}, nil
+	case code == 3395:
+		return &CRS{Name: "WGS 84 / World Mercator", EPSG: code, Datum: DatumWGS84, Conversion: Mercator{K0: 1}}, nil
+	case code == 27700:
+		return tm("OSGB 1936 / British National Grid", DatumOSGB36, 49, -2, 0.9996012717, 400000, -100000)
+	case code == 29903:
+		return tm("TM75 / Irish Grid", DatumTM75, 53.5, -8, 1.000035, 200000, 250000)
+	case code == 2157:
+		return tm("IRENET95 / Irish Transverse Mercator", DatumETRS89, 53.5, -8, 0.99982, 600000, 750000)
+	case code == 3006:
+		return tm("SWEREF99 TM", DatumETRS89, 0, 15, 0.9996, 500000, 0)
+	case code == 3067:
+		return tm("ETRS89 / TM35FIN(E,N)", DatumETRS89, 0, 27, 0.9996, 500000, 0)
+	case code == 2193:
+		return tm("NZGD2000 / New Zealand Transverse Mercator 2000", Datum{Name: "NZGD2000", Ellipsoid: GRS80}, 0, 173, 0.9996, 1600000, 10000000)
+	case code >= 31466 && code <= 31469:
+		zone := code - 31464
+		return tm(fmt.Sprintf("DHDN / 3-degree Gauss-Kruger zone %d", zone), DatumDHDN, 0, float64(3*zone), 1, float64(zone)*1e6+500000, 0)
+	case code == 2154:
+		return &CRS{Name: "RGF93 / Lambert-93", EPSG: code, Datum: Datum{Name: "RGF93", Ellipsoid: GRS80},
+			Conversion: LambertConformalConic{Lat0: rad(46.5), Lon0: rad(3), Lat1: rad(49), Lat2: rad(44), K0: 1, FE: 700000, FN: 6600000}}, nil
+	case code >= 32601 && code <= 32660:
+		return utm("WGS 84", DatumWGS84, code-32600, false)
+	case code >= 32701 && code <= 32760:
+		return utm("WGS 84", DatumWGS84, code-32700, true)
+	case code >= 25828 && code <= 25838:
+		return utm("ETRS89", DatumETRS89, code-25800, false)
+	case code >= 26901 && code <= 26923:
+		return utm("NAD83", DatumNAD83, code-26900, false)
+	case code >= 26701 && code <= 26722:
+		return utm("NAD27", DatumNAD27, code-26700, false)
+	case code >= 23028 && code <= 23038:
+		return utm("ED50", DatumED50, code-23000, false)
+	}
+	return nil, fmt.Errorf("proj: EPSG:%d is not supported", code)
+}
+
+func rad(deg float64) float64 { return deg * math.Pi / 180 }
@@ -0,0 +1,132 @@
+package proj
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConversions(t *testing.T) {
+	// worked examples from Snyder, Map Projections: A Working Manual (1987)
+	tests := []struct {
+		name     string
+		conv     Conversion
+		lon, lat float64
+		x, y     float64
+	}{
+		{"transverse mercator", TransverseMercator{Lon0: rad(-75), K0: 0.9996}, -73.5, 40.5, 127106.5, 4484124.4},
+		{"lambert conformal conic", LambertConformalConic{Lat0: rad(23), Lon0: rad(-96), Lat1: rad(33), Lat2: rad(45), K0: 1}, -75, 35, 1894410.9, 1564649.5},
+	}
+	for _, tt := range tests {
+		x, y := tt.conv.forward(Clarke1866, rad(tt.lon), rad(tt.lat))
+		if math.Abs(x-tt.x) > 0.1 || math.Abs(y-tt.y) > 0.1 {
+			t.Errorf("%s: forward = %.1f, %.1f, want %.1f, %.1f", tt.name, x, y, tt.x, tt.y)
+		}
+		lon, lat := tt.conv.inverse(Clarke1866, tt.x, tt.y)
+		if math.Abs(lon-rad(tt.lon)) > 1e-8 || math.Abs(lat-rad(tt.lat)) > 1e-8 {
+			t.Errorf("%s: inverse = %.8f, %.8f", tt.name, lon*180/math.Pi, lat*180/math.Pi)
+		}
+	}
+}
+
+func TestEPSGKnownPoints(t *testing.T) {
+	tests := []struct {
+		code     int
+		lon, lat float64
+		x, y     float64
+		tol      float64 // metres
+	}{
+		{32633, 15, 0, 500000, 0, 0.001},
+		{3857, -0.1, 51.5, -11131.95, 6710219.08, 0.01},
+		// OS guide to coordinate systems, worked example; the seven-parameter
+		// transformation is good to a few metres, not to the survey point
+		{27700, 1.7160520, 52.6579786, 651409.90, 313177.27, 0.05},
+		{2154, 2.3522, 48.8566, 652469.0, 6862035.3, 1},
+	}
+	for _, tt := range tests {
+		c, err := EPSG(tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y := c.FromWGS84(tt.lon, tt.lat)
+		if math.Abs(x-tt.x) > tt.tol || math.Abs(y-tt.y) > tt.tol {
+			t.Errorf("EPSG:%d: FromWGS84(%g, %g) = %.3f, %.3f, want %.3f, %.3f", tt.code, tt.lon, tt.lat, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	points := map[int][][2]float64{
+		4326:  {{-0.1, 51.5}, {179, -89}},
+		4277:  {{-3.2, 55.95}, {1.3, 50.8}},
+		3857:  {{-0.1, 51.5}, {139.7, 35.7}, {-70, -55}},
+		3395:  {{-0.1, 51.5}, {139.7, 35.7}},
+		32633: {{15, 0}, {12.5, 41.9}, {18, 70}},
+		32733: {{15, -1}, {17, -33}},
+		27700: {{-0.1, 51.5}, {-6.3, 58.2}, {1.7, 52.6}},
+		29903: {{-6.26, 53.35}},
+		31468: {{11.58, 48.14}},
+		2154:  {{2.3522, 48.8566}, {-1.5, 43.5}},
+	}
+	for code, pts := range points {
+		c, err := EPSG(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range pts {
+			x, y := c.FromWGS84(p[0], p[1])
+			lon, lat := c.ToWGS84(x, y)
+			// the datum shift is inverted by negating its parameters, which
+			// is good to about a centimetre
+			if math.Abs(lon-p[0]) > 1e-6 || math.Abs(lat-p[1]) > 1e-6 {
+				t.Errorf("EPSG:%d: %v -> %.3f, %.3f -> %.9f, %.9f", code, p, x, y, lon, lat)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		epsg int
+		name string
+	}{
+		{"EPSG:27700", 27700, "OSGB 1936 / British National Grid"},
+		{" epsg:3857 ", 3857, "WGS 84 / Pseudo-Mercator"},
+		{"urn:ogc:def:crs:EPSG::32633", 32633, "WGS 84 / UTM zone 33N"},
+		{"urn:ogc:def:crs:EPSG:6.6:4326", 4326, "WGS 84"},
+		{"http://www.opengis.net/def/crs/EPSG/0/2154", 2154, "RGF93 / Lambert-93"},
+		{"urn:ogc:def:crs:OGC:1.3:CRS84", 4326, "WGS 84"},
+		{`PROJCS["British_National_Grid",GEOGCS["GCS_OSGB_1936",DATUM["D_OSGB_1936",SPHEROID["Airy_1830",6377563.396,299.3249646]],PRIMEM["Greenwich",0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",400000],PARAMETER["False_Northing",-100000],PARAMETER["Central_Meridian",-2],PARAMETER["Scale_Factor",0.9996012717],PARAMETER["Latitude_Of_Origin",49],UNIT["Meter",1]]`, 0, "British_National_Grid"},
+	}
+	for _, tt := range tests {
+		c, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if c.EPSG != tt.epsg || c.Name != tt.name {
+			t.Errorf("Parse(%q) = EPSG:%d %q, want EPSG:%d %q", tt.in, c.EPSG, c.Name, tt.epsg, tt.name)
+		}
+	}
+	for _, in := range []string{"EPSG:1", "OSGB", `FOO["x"]`} {
+		if _, err := Parse(in); err == nil || !strings.HasPrefix(err.Error(), "proj:") {
+			t.Errorf("Parse(%q) error = %v", in, err)
+		}
+	}
+}
+
+func TestParseWKTMatchesEPSG(t *testing.T) {
+	// an ESRI .prj without identifiers gives the same coordinates as EPSG:27700
+	wkt := `PROJCS["British_National_Grid",GEOGCS["GCS_OSGB_1936",DATUM["D_OSGB_1936",SPHEROID["Airy_1830",6377563.396,299.3249646]],PRIMEM["Greenwich",0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",400000],PARAMETER["False_Northing",-100000],PARAMETER["Central_Meridian",-2],PARAMETER["Scale_Factor",0.9996012717],PARAMETER["Latitude_Of_Origin",49],UNIT["Meter",1]]`
+	c, err := ParseWKT(wkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, _ := EPSG(27700)
+	x, y := c.ToWGS84(651409.903, 313177.270)
+	rx, ry := ref.ToWGS84(651409.903, 313177.270)
+	if math.Abs(x-rx) > 1e-9 || math.Abs(y-ry) > 1e-9 {
+		t.Errorf("ToWGS84 = %.9f, %.9f, want %.9f, %.9f", x, y, rx, ry)
+	}
+}
@@ -0,0 +1,73 @@
+// Package proj maps lon/lat onto the plane the map is drawn on. Projected
+// coordinates are kept in degree-sized units so that extents, zoom and pan
+// behave alike in every projection. The package also reads the coordinate
+// reference systems that source files declare (see CRS), so that data can be
+// converted to WGS 84 lon/lat for display.
+package proj
+
+import "math"
+
+// Projection converts between lon/lat and projected x/y. Forward and Inverse
+// are monotonic in each axis, so a lon/lat box projects to the box spanned by
+// its projected corners.
+type Projection interface {
+	Name() string
+	Forward(lon, lat float64) (x, y float64)
+	Inverse(x, y float64) (lon, lat float64)
+}
+
+// PlateCarree draws lon/lat directly as x/y.
+type PlateCarree struct{}
+
+func (PlateCarree) Name() string { return "plate carrée" }
+
+func (PlateCarree) Forward(lon, lat float64) (float64, float64) { return lon, lat }
+
+func (PlateCarree) Inverse(x, y float64) (float64, float64) { return x, y }
+
+// MaxMercatorLat is where Web Mercator is conventionally cut off, making the
+// world square.
+const MaxMercatorLat = 85.05112878
+
+// WebMercator is the spherical Mercator of web maps (EPSG:3857), scaled so
+// that y, like x, is in degrees at the equator. Latitudes are clamped to
+// ±MaxMercatorLat.
+type WebMercator struct{}
+
+func (WebMercator) Name() string { return "web mercator" }
+
+func (WebMercator) Forward(lon, lat float64) (float64, float64) {
+	lat = math.Max(-MaxMercatorLat, math.Min(MaxMercatorLat, lat))
+	r := lat * math.Pi / 180
+	return lon, math.Log(math.Tan(math.Pi/4+r/2)) * 180 / math.Pi
+}
+
+func (WebMercator) Inverse(x, y float64) (float64, float64) {
+	return x, (2*math.Atan(math.Exp(y*math.Pi/180)) - math.Pi/2) * 180 / math.Pi
+}
+
+// Equirectangular scales longitude by cos(Lat0), so that near the standard
+// parallel Lat0 a degree of longitude and of latitude cover the same ground
+// distance on screen.
+type Equirectangular struct {
+	Lat0 float64
+}
+
+func (Equirectangular) Name() string { return "equirectangular" }
+
+func (e Equirectangular) Forward(lon, lat float64) (float64, float64) {
+	return lon * e.scale(), lat
+}
+
+func (e Equirectangular) Inverse(x, y float64) (float64, float64) {
+	return x / e.scale(), y
+}
+
+// scale is cos(Lat0), kept away from zero near the poles.
+func (e Equirectangular) scale() float64 {
+	return math.Max(0.01, math.Cos(e.Lat0*math.Pi/180))
+}
+
+// Modes are the projections the map can be switched between, in order. The
+// Equirectangular standard parallel is set from the data by the caller.
+var Modes = []Projection{PlateCarree{}, WebMercator{}, Equirectangular{}}
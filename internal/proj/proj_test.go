@@ -0,0 +1,43 @@
+package proj
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProjectionRoundTrip(t *testing.T) {
+	points := [][2]float64{{0, 0}, {-0.1, 51.5}, {139.7, 35.7}, {-70, -55}, {180, 85}, {-180, -85}}
+	for _, p := range []Projection{PlateCarree{}, WebMercator{}, Equirectangular{Lat0: 52}, Equirectangular{Lat0: 90}} {
+		for _, pt := range points {
+			x, y := p.Forward(pt[0], pt[1])
+			lon, lat := p.Inverse(x, y)
+			if math.Abs(lon-pt[0]) > 1e-9 || math.Abs(lat-pt[1]) > 1e-9 {
+				t.Errorf("%s: %v -> %g, %g -> %g, %g", p.Name(), pt, x, y, lon, lat)
+			}
+		}
+	}
+}
+
+func TestProjectionForward(t *testing.T) {
+	tests := []struct {
+		p        Projection
+		lon, lat float64
+		x, y     float64
+	}{
+		{PlateCarree{}, 13.4, 52.5, 13.4, 52.5},
+		// y is in degrees at the equator; the world is square at the clamp
+		{WebMercator{}, 10, 0, 10, 0},
+		{WebMercator{}, 0, MaxMercatorLat, 0, 180},
+		{WebMercator{}, 0, 90, 0, 180},
+		{WebMercator{}, 0, -90, 0, -180},
+		{Equirectangular{Lat0: 60}, 10, 60, 5, 60},
+		// the scale is kept from reaching zero at the pole
+		{Equirectangular{Lat0: 90}, 10, 0, 0.1, 0},
+	}
+	for _, tt := range tests {
+		x, y := tt.p.Forward(tt.lon, tt.lat)
+		if math.Abs(x-tt.x) > 1e-6 || math.Abs(y-tt.y) > 1e-6 {
+			t.Errorf("%s: Forward(%g, %g) = %g, %g, want %g, %g", tt.p.Name(), tt.lon, tt.lat, x, y, tt.x, tt.y)
+		}
+	}
+}
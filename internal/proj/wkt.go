@@ -0,0 +1,334 @@
+package proj
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// wktNode is one KEYWORD[...] of a WKT CRS: its quoted and numeric values in
+// order, and its nested nodes.
+type wktNode struct {
+	Key      string
+	Values   []string
+	Children []*wktNode
+}
+
+// child returns the first nested node named by any of keys, or nil.
+func (n *wktNode) child(keys ...string) *wktNode {
+	for _, c := range n.Children {
+		for _, k := range keys {
+			if c.Key == k {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// name is the node's first value, conventionally its name.
+func (n *wktNode) name() string {
+	if n == nil || len(n.Values) == 0 {
+		return ""
+	}
+	return n.Values[0]
+}
+
+// num returns the i-th value as a number, or 0.
+func (n *wktNode) num(i int) float64 {
+	if n == nil || i >= len(n.Values) {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(n.Values[i], 64)
+	return v
+}
+
+// epsg returns the EPSG code of the node's AUTHORITY (WKT1) or ID (WKT2), or 0.
+func (n *wktNode) epsg() int {
+	a := n.child("AUTHORITY", "ID")
+	if a == nil || len(a.Values) < 2 || !strings.EqualFold(a.Values[0], "EPSG") {
+		return 0
+	}
+	code, _ := strconv.Atoi(a.Values[1])
+	return code
+}
+
+// parseWKTNode parses a WKT CRS into a tree, accepting [] or () brackets.
+func parseWKTNode(s string) (*wktNode, error) {
+	p := wktParser{s: s}
+	n, err := p.node()
+	if err != nil {
+		return nil, fmt.Errorf("proj: wkt: %w", err)
+	}
+	return n, nil
+}
+
+type wktParser struct {
+	s string
+	i int
+}
+
+func (p *wktParser) skip() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *wktParser) node() (*wktNode, error) {
+	p.skip()
+	start := p.i
+	for p.i < len(p.s) && (p.s[p.i] == '_' || p.s[p.i] >= 'A' && p.s[p.i] <= 'Z' || p.s[p.i] >= 'a' && p.s[p.i] <= 'z' || p.s[p.i] >= '0' && p.s[p.i] <= '9') {
+		p.i++
+	}
+	n := &wktNode{Key: strings.ToUpper(p.s[start:p.i])}
+	p.skip()
+	if n.Key == "" || p.i >= len(p.s) || (p.s[p.i] != '[' && p.s[p.i] != '(') {
+		return nil, fmt.Errorf("expected keyword[ at offset %d", start)
+	}
+	p.i++
+	for {
+		p.skip()
+		if p.i >= len(p.s) {
+			return nil, errors.New("unterminated bracket")
+		}
+		switch c := p.s[p.i]; {
+		case c == ']' || c == ')':
+			p.i++
+			return n, nil
+		case c == ',':
+			p.i++
+		case c == '"':
+			// "" is an escaped quote
+			var b strings.Builder
+			for p.i++; p.i < len(p.s); p.i++ {
+				if p.s[p.i] == '"' {
+					if p.i+1 < len(p.s) && p.s[p.i+1] == '"' {
+						b.WriteByte('"')
+						p.i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(p.s[p.i])
+			}
+			p.i++
+			n.Values = append(n.Values, b.String())
+		case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+			start := p.i
+			for p.i < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.i]) >= 0 {
+				p.i++
+			}
+			n.Values = append(n.Values, p.s[start:p.i])
+		default:
+			// a nested node, or a bare enumeration such as AXIS["x",EAST]
+			save := p.i
+			child, err := p.node()
+			if err != nil {
+				p.i = save
+				for p.i < len(p.s) && strings.IndexByte(",])", p.s[p.i]) < 0 {
+					p.i++
+				}
+				n.Values = append(n.Values, strings.TrimSpace(p.s[save:p.i]))
+				continue
+			}
+			n.Children = append(n.Children, child)
+		}
+	}
+}
+
+// ParseWKT reads a CRS from WKT1 (OGC or ESRI .prj flavour) or WKT2. A
+// top-level EPSG identifier that EPSG knows is used as is; otherwise the CRS
+// is built from the ellipsoid, TOWGS84, projection method and parameters.
+// Datums without TOWGS84 are looked up by the geographic CRS's EPSG code or
+// matched by name against the built-in datums.
+func ParseWKT(s string) (*CRS, error) {
+	root, err := parseWKTNode(s)
+	if err != nil {
+		return nil, err
+	}
+	if root.Key == "COMPD_CS" || root.Key == "COMPOUNDCRS" {
+		if root = root.child("PROJCS", "PROJCRS", "PROJECTEDCRS", "GEOGCS", "GEOGCRS", "GEOGRAPHICCRS", "GEODCRS"); root == nil {
+			return nil, errors.New("proj: wkt: compound CRS has no horizontal part")
+		}
+	}
+	if code := root.epsg(); code != 0 {
+		if c, err := EPSG(code); err == nil {
+			return c, nil
+		}
+	}
+	c := &CRS{Name: root.name(), EPSG: root.epsg()}
+	geog := root
+	switch root.Key {
+	case "GEOGCS", "GEOGCRS", "GEOGRAPHICCRS", "GEODCRS", "GEODETICCRS":
+	case "PROJCS", "PROJCRS", "PROJECTEDCRS":
+		if geog = root.child("GEOGCS", "BASEGEOGCRS", "BASEGEODCRS"); geog == nil {
+			return nil, errors.New("proj: wkt: projected CRS has no geographic base")
+		}
+	default:
+		return nil, fmt.Errorf("proj: wkt: unsupported CRS type %s", root.Key)
+	}
+	if c.Datum, err = wktDatum(geog); err != nil {
+		return nil, err
+	}
+	if root == geog {
+		return c, nil
+	}
+	if c.Conversion, err = wktConversion(root, c.Datum.Ellipsoid); err != nil {
+		return nil, err
+	}
+	c.Unit = wktLengthUnit(root)
+	return c, nil
+}
+
+// knownDatums are matched by name when a WKT datum carries no TOWGS84.
+var knownDatums = []struct {
+	names []string
+	datum Datum
+}{
+	{[]string{"OSGB_1936", "OSGB36", "Ordnance_Survey_of_Great_Britain_1936"}, DatumOSGB36},
+	{[]string{"TM75", "Ireland_1965"}, DatumTM75},
+	{[]string{"North_American_Datum_1927", "NAD27"}, DatumNAD27},
+	{[]string{"European_Datum_1950", "ED50"}, DatumED50},
+	{[]string{"Deutsches_Hauptdreiecksnetz", "DHDN"}, DatumDHDN},
+}
+
+// wktDatum reads the datum of a geographic CRS node.
+func wktDatum(geog *wktNode) (Datum, error) {
+	dn := geog.child("DATUM", "GEODETICDATUM", "TRF")
+	if dn == nil {
+		if ens := geog.child("ENSEMBLE"); ens != nil {
+			dn = ens
+		} else {
+			return Datum{}, errors.New("proj: wkt: no datum")
+		}
+	}
+	d := Datum{Name: dn.name(), Ellipsoid: WGS84}
+	if sp := dn.child("SPHEROID", "ELLIPSOID"); sp != nil {
+		d.Ellipsoid = Ellipsoid{Name: sp.name(), A: sp.num(1), InvF: sp.num(2)}
+		if u := sp.child("LENGTHUNIT"); u != nil && u.num(1) > 0 {
+			d.Ellipsoid.A *= u.num(1)
+		}
+	}
+	if d.Ellipsoid.A == 0 {
+		return Datum{}, fmt.Errorf("proj: wkt: datum %q has no ellipsoid", d.Name)
+	}
+	if t := dn.child("TOWGS84"); t != nil {
+		for i := range d.ToWGS84 {
+			d.ToWGS84[i] = t.num(i)
+		}
+		return d, nil
+	}
+	if base, err := EPSG(geog.epsg()); err == nil && base.Conversion == nil {
+		return base.Datum, nil
+	}
+	norm := strings.TrimPrefix(strings.ReplaceAll(d.Name, " ", "_"), "D_")
+	for _, k := range knownDatums {
+		for _, name := range k.names {
+			if strings.EqualFold(norm, name) {
+				d.ToWGS84 = k.datum.ToWGS84
+				return d, nil
+			}
+		}
+	}
+	return d, nil
+}
+
+// wktConversion reads the projection method and parameters of a projected
+// CRS node. WKT1 puts PROJECTION and PARAMETER beside the base CRS; WKT2
+// nests METHOD and PARAMETER in CONVERSION.
+func wktConversion(root *wktNode, e Ellipsoid) (Conversion, error) {
+	holder := root
+	method := root.child("PROJECTION")
+	if conv := root.child("CONVERSION"); conv != nil {
+		holder, method = conv, conv.child("METHOD")
+	}
+	if method == nil {
+		return nil, errors.New("proj: wkt: projected CRS has no method")
+	}
+	params := map[string]float64{}
+	for _, c := range holder.Children {
+		if c.Key != "PARAMETER" {
+			continue
+		}
+		v := c.num(1)
+		// WKT2 gives each parameter its unit; WKT1 angles are in the
+		// geographic CRS's unit, almost always degrees
+		if u := c.child("ANGLEUNIT"); u != nil && u.num(1) > 0 {
+			v *= u.num(1) * 180 / math.Pi
+		} else if u := c.child("LENGTHUNIT"); u != nil && u.num(1) > 0 {
+			v *= u.num(1)
+		}
+		params[wktParamKey(c.name())] = v
+	}
+	lengthUnit := 1.0
+	if holder == root {
+		lengthUnit = wktLengthUnit(root)
+	}
+	get := func(key string, def float64) float64 {
+		if v, ok := params[key]; ok {
+			return v
+		}
+		return def
+	}
+	fe, fn := get("fe", 0)*lengthUnit, get("fn", 0)*lengthUnit
+	name := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(method.name()))
+	switch {
+	case strings.Contains(name, "transverse mercator") || strings.Contains(name, "gauss kruger"):
+		return TransverseMercator{Lat0: rad(get("lat0", 0)), Lon0: rad(get("lon0", 0)), K0: get("k0", 1), FE: fe, FN: fn}, nil
+	case strings.Contains(name, "lambert conformal conic") || strings.Contains(name, "lambert conic conformal"):
+		lat0 := get("lat0", 0)
+		lat1 := get("lat1", lat0)
+		return LambertConformalConic{Lat0: rad(lat0), Lon0: rad(get("lon0", 0)), Lat1: rad(lat1), Lat2: rad(get("lat2", lat1)), K0: get("k0", 1), FE: fe, FN: fn}, nil
+	case strings.Contains(name, "pseudo mercator") || strings.Contains(name, "mercator auxiliary sphere"):
+		return Mercator{Spherical: true, K0: 1, FE: fe, FN: fn}, nil
+	case strings.Contains(name, "mercator"):
+		k0 := get("k0", 1)
+		if lat1, ok := params["lat1"]; ok {
+			// variant B: scale set by a standard parallel
+			k0 = lccM(e, rad(lat1))
+		}
+		return Mercator{Lon0: rad(get("lon0", 0)), K0: k0, FE: fe, FN: fn}, nil
+	}
+	return nil, fmt.Errorf("proj: wkt: projection %q is not supported", method.name())
+}
+
+// wktLengthUnit returns the metres per unit of a projected CRS's
+// coordinates, given by UNIT in WKT1 and by LENGTHUNIT on the CRS or its
+// first axis in WKT2.
+func wktLengthUnit(root *wktNode) float64 {
+	u := root.child("UNIT", "LENGTHUNIT")
+	if u == nil {
+		if axis := root.child("AXIS"); axis != nil {
+			u = axis.child("LENGTHUNIT", "UNIT")
+		}
+	}
+	if u != nil && u.num(1) > 0 {
+		return u.num(1)
+	}
+	return 1
+}
+
+// wktParamKey maps the WKT1, ESRI and WKT2 spellings of a projection
+// parameter to a short key.
+func wktParamKey(name string) string {
+	n := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(name))
+	switch n {
+	case "false_easting", "easting_at_false_origin":
+		return "fe"
+	case "false_northing", "northing_at_false_origin":
+		return "fn"
+	case "central_meridian", "longitude_of_center", "longitude_of_origin", "longitude_of_natural_origin", "longitude_of_false_origin":
+		return "lon0"
+	case "latitude_of_origin", "latitude_of_center", "latitude_of_natural_origin", "latitude_of_false_origin":
+		return "lat0"
+	case "scale_factor", "scale_factor_at_natural_origin":
+		return "k0"
+	case "standard_parallel_1", "latitude_of_1st_standard_parallel":
+		return "lat1"
+	case "standard_parallel_2", "latitude_of_2nd_standard_parallel":
+		return "lat2"
+	}
+	return n
+}
@@ -0,0 +1,542 @@
+// Package sqlite is a small read-only reader for the SQLite 3 file format.
+// It walks table b-trees directly and decodes records, which is all that
+// GeoPackage and MBTiles need, without cgo or a SQL engine. WITHOUT ROWID
+// tables and uncommitted WAL content are not supported.
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const headerMagic = "SQLite format 3\x00"
+
+// DB is an open database file.
+type DB struct {
+	f        *os.File
+	pageSize int
+	usable   int
+	encoding int // 1 UTF-8, 2 UTF-16le, 3 UTF-16be
+}
+
+// Table describes a rowid table from sqlite_schema.
+type Table struct {
+	Name     string
+	RootPage int
+	SQL      string
+	Columns  []string
+	// RowIDCol is the index of the INTEGER PRIMARY KEY column aliasing the
+	// rowid, or -1. Such columns are stored as NULL and filled from the rowid.
+	RowIDCol int
+}
+
+// Open opens the database at path for reading.
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var hdr [100]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("sqlite: header: %w", err)
+	}
+	if string(hdr[:16]) != headerMagic {
+		f.Close()
+		return nil, errors.New("sqlite: not a database file")
+	}
+	ps := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if ps == 1 {
+		ps = 65536
+	}
+	if ps < 512 || ps&(ps-1) != 0 {
+		f.Close()
+		return nil, fmt.Errorf("sqlite: invalid page size %d", ps)
+	}
+	enc := int(binary.BigEndian.Uint32(hdr[56:60]))
+	if enc == 0 {
+		enc = 1
+	}
+	return &DB{f: f, pageSize: ps, usable: ps - int(hdr[20]), encoding: enc}, nil
+}
+
+// Close closes the underlying file.
+func (db *DB) Close() error { return db.f.Close() }
+
+func (db *DB) page(n int) ([]byte, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("sqlite: invalid page number %d", n)
+	}
+	buf := make([]byte, db.pageSize)
+	if _, err := db.f.ReadAt(buf, int64(n-1)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("sqlite: page %d: %w", n, err)
+	}
+	return buf, nil
+}
+
+// Tables lists the rowid tables defined in sqlite_schema.
+func (db *DB) Tables() ([]Table, error) {
+	var out []Table
+	schema := Table{Name: "sqlite_schema", RootPage: 1, RowIDCol: -1}
+	err := db.Scan(schema, func(_ int64, row []any) error {
+		if len(row) < 5 {
+			return nil
+		}
+		typ, _ := row[0].(string)
+		name, _ := row[1].(string)
+		root, _ := row[3].(int64)
+		sql, _ := row[4].(string)
+		if typ != "table" || root == 0 || strings.Contains(strings.ToUpper(sql), "WITHOUT ROWID") {
+			return nil
+		}
+		cols, rowid := parseColumns(sql)
+		out = append(out, Table{Name: name, RootPage: int(root), SQL: sql, Columns: cols, RowIDCol: rowid})
+		return nil
+	})
+	return out, err
+}
+
+// Table looks up a table by name, case-insensitively.
+func (db *DB) Table(name string) (Table, error) {
+	tables, err := db.Tables()
+	if err != nil {
+		return Table{}, err
+	}
+	for _, t := range tables {
+		if strings.EqualFold(t.Name, name) {
+			return t, nil
+		}
+	}
+	return Table{}, fmt.Errorf("sqlite: no such table: %s", name)
+}
+
+// Scan calls fn for every row of t in rowid order. Row values are nil, int64,
+// float64, string or []byte, one per column of t; rows written before columns
+// were added are padded with nil. Returning an error from fn stops the scan.
+func (db *DB) Scan(t Table, fn func(rowid int64, row []any) error) error {
+	return db.ScanColumns(t, 0, fn)
+}
+
+// ScanColumns is like Scan but decodes only the first n columns (all when n
+// is 0). Overflow pages are not read when those columns are stored locally,
+// which makes skipping a trailing blob column cheap.
+func (db *DB) ScanColumns(t Table, n int, fn func(rowid int64, row []any) error) error {
+	return db.walk(t.RootPage, 0, func(rowid int64, c cell) error {
+		vals, err := db.cellRecord(c, n)
+		if err != nil {
+			return err
+		}
+		return fn(rowid, t.fill(rowid, vals))
+	})
+}
+
+// Row returns the row of t with the given rowid, or nil when there is none.
+func (db *DB) Row(t Table, rowid int64) ([]any, error) {
+	n := t.RootPage
+	for depth := 0; depth <= 64; depth++ {
+		pg, err := db.page(n)
+		if err != nil {
+			return nil, err
+		}
+		off := 0
+		if n == 1 {
+			off = 100
+		}
+		ncells := int(binary.BigEndian.Uint16(pg[off+3:]))
+		switch pg[off] {
+		case 0x05:
+			// descend into the first child whose key is >= rowid
+			next := int(binary.BigEndian.Uint32(pg[off+8:]))
+			if off+12+2*ncells > len(pg) {
+				return nil, fmt.Errorf("sqlite: page %d: bad cell offset", n)
+			}
+			for i := 0; i < ncells; i++ {
+				cp := int(binary.BigEndian.Uint16(pg[off+12+2*i:]))
+				if cp+4 > len(pg) {
+					return nil, fmt.Errorf("sqlite: page %d: bad cell offset", n)
+				}
+				key, _ := varint(pg[cp+4:])
+				if int64(key) >= rowid {
+					next = int(binary.BigEndian.Uint32(pg[cp:]))
+					break
+				}
+			}
+			n = next
+		case 0x0D:
+			if off+8+2*ncells > len(pg) {
+				return nil, fmt.Errorf("sqlite: page %d: bad cell offset", n)
+			}
+			for i := 0; i < ncells; i++ {
+				cp := int(binary.BigEndian.Uint16(pg[off+8+2*i:]))
+				if cp >= len(pg) {
+					return nil, fmt.Errorf("sqlite: page %d: bad cell offset", n)
+				}
+				size, k := varint(pg[cp:])
+				id, k2 := varint(pg[cp+k:])
+				if k == 0 || k2 == 0 {
+					return nil, fmt.Errorf("sqlite: page %d: bad cell offset", n)
+				}
+				if int64(id) != rowid {
+					continue
+				}
+				vals, err := db.cellRecord(cell{pg: pg, off: cp + k + k2, size: int(size)}, 0)
+				if err != nil {
+					return nil, err
+				}
+				return t.fill(rowid, vals), nil
+			}
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("sqlite: page %d: unexpected page type %#x", n, pg[off])
+		}
+	}
+	return nil, errors.New("sqlite: b-tree too deep (corrupt file?)")
+}
+
+// fill pads vals to the table's columns and restores the rowid alias column.
+func (t Table) fill(rowid int64, vals []any) []any {
+	for len(vals) < len(t.Columns) {
+		vals = append(vals, nil)
+	}
+	if t.RowIDCol >= 0 && t.RowIDCol < len(vals) && vals[t.RowIDCol] == nil {
+		vals[t.RowIDCol] = rowid
+	}
+	return vals
+}
+
+// cell is a leaf cell whose payload starts at pg[off] and may continue on
+// overflow pages.
+type cell struct {
+	pg        []byte
+	off, size int
+}
+
+// cellRecord decodes up to n columns of a cell's record, reading overflow
+// pages only when the local part of the payload is not enough.
+func (db *DB) cellRecord(c cell, n int) ([]any, error) {
+	if n > 0 {
+		if local, err := db.localPayload(c); err == nil {
+			if vals, err := db.decodeRecord(local, n); err != errTruncated {
+				return vals, err
+			}
+		}
+	}
+	payload, err := db.payload(c.pg, c.off, c.size)
+	if err != nil {
+		return nil, err
+	}
+	return db.decodeRecord(payload, n)
+}
+
+// walk visits the leaf cells of the table b-tree rooted at page n.
+func (db *DB) walk(n, depth int, fn func(rowid int64, c cell) error) error {
+	if depth > 64 {
+		return errors.New("sqlite: b-tree too deep (corrupt file?)")
+	}
+	pg, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	off := 0
+	if n == 1 {
+		off = 100
+	}
+	typ := pg[off]
+	ncells := int(binary.BigEndian.Uint16(pg[off+3:]))
+	switch typ {
+	case 0x05: // interior table page
+		ptrs := off + 12
+		if ptrs+2*ncells > len(pg) {
+			return fmt.Errorf("sqlite: page %d: bad cell offset", n)
+		}
+		for i := 0; i < ncells; i++ {
+			cp := int(binary.BigEndian.Uint16(pg[ptrs+2*i:]))
+			if cp+4 > len(pg) {
+				return fmt.Errorf("sqlite: page %d: bad cell offset", n)
+			}
+			child := int(binary.BigEndian.Uint32(pg[cp:]))
+			if err := db.walk(child, depth+1, fn); err != nil {
+				return err
+			}
+		}
+		right := int(binary.BigEndian.Uint32(pg[off+8:]))
+		return db.walk(right, depth+1, fn)
+	case 0x0D: // leaf table page
+		ptrs := off + 8
+		if ptrs+2*ncells > len(pg) {
+			return fmt.Errorf("sqlite: page %d: bad cell offset", n)
+		}
+		for i := 0; i < ncells; i++ {
+			cp := int(binary.BigEndian.Uint16(pg[ptrs+2*i:]))
+			if cp >= len(pg) {
+				return fmt.Errorf("sqlite: page %d: bad cell offset", n)
+			}
+			size, k := varint(pg[cp:])
+			rowid, k2 := varint(pg[cp+k:])
+			if k == 0 || k2 == 0 {
+				return fmt.Errorf("sqlite: page %d: bad cell offset", n)
+			}
+			if err := fn(int64(rowid), cell{pg: pg, off: cp + k + k2, size: int(size)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("sqlite: page %d: unexpected page type %#x", n, typ)
+	}
+}
+
+// localSize is how many bytes of a payload of the given size are stored in
+// the cell itself; the rest lives on overflow pages.
+func (db *DB) localSize(size int) int {
+	u := db.usable
+	x := u - 35
+	if size <= x {
+		return size
+	}
+	m := ((u-12)*32)/255 - 23
+	if k := m + (size-m)%(u-4); k <= x {
+		return k
+	}
+	return m
+}
+
+// localPayload returns the part of a cell's payload stored on its page.
+func (db *DB) localPayload(c cell) ([]byte, error) {
+	local := db.localSize(c.size)
+	if c.off+local > len(c.pg) {
+		return nil, errors.New("sqlite: cell payload out of bounds")
+	}
+	return c.pg[c.off : c.off+local], nil
+}
+
+// payload assembles a cell's payload of the given size starting at pg[off],
+// following overflow pages when it does not fit locally.
+func (db *DB) payload(pg []byte, off, size int) ([]byte, error) {
+	u := db.usable
+	local := db.localSize(size)
+	if off+local > len(pg) {
+		return nil, errors.New("sqlite: cell payload out of bounds")
+	}
+	out := make([]byte, 0, size)
+	out = append(out, pg[off:off+local]...)
+	if local == size {
+		return out, nil
+	}
+	if off+local+4 > len(pg) {
+		return nil, errors.New("sqlite: overflow pointer out of bounds")
+	}
+	next := int(binary.BigEndian.Uint32(pg[off+local:]))
+	for len(out) < size && next != 0 {
+		ov, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(ov))
+		chunk := ov[4:u]
+		if rem := size - len(out); len(chunk) > rem {
+			chunk = chunk[:rem]
+		}
+		out = append(out, chunk...)
+	}
+	if len(out) < size {
+		return nil, errors.New("sqlite: truncated overflow chain")
+	}
+	return out, nil
+}
+
+// errTruncated reports a record cut short, e.g. decoded from a local payload.
+var errTruncated = errors.New("sqlite: record truncated")
+
+// decodeRecord decodes a record: a header of serial types followed by values.
+// At most max values are decoded (all when max is 0).
+func (db *DB) decodeRecord(b []byte, max int) ([]any, error) {
+	hdrLen, n := varint(b)
+	if n == 0 {
+		return nil, errors.New("sqlite: bad record header")
+	}
+	if int(hdrLen) > len(b) {
+		return nil, errTruncated
+	}
+	var types []uint64
+	for p := n; p < int(hdrLen); {
+		t, k := varint(b[p:])
+		if k == 0 {
+			return nil, errors.New("sqlite: bad serial type")
+		}
+		types = append(types, t)
+		p += k
+	}
+	vals := make([]any, 0, len(types))
+	p := int(hdrLen)
+	if max > 0 && len(types) > max {
+		types = types[:max]
+	}
+	for _, t := range types {
+		var size int
+		switch {
+		case t == 0 || t == 8 || t == 9:
+			size = 0
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		default:
+			return nil, fmt.Errorf("sqlite: reserved serial type %d", t)
+		}
+		if p+size > len(b) {
+			return nil, errTruncated
+		}
+		v := b[p : p+size]
+		p += size
+		switch {
+		case t == 0:
+			vals = append(vals, nil)
+		case t == 8:
+			vals = append(vals, int64(0))
+		case t == 9:
+			vals = append(vals, int64(1))
+		case t <= 6:
+			vals = append(vals, bigInt(v))
+		case t == 7:
+			vals = append(vals, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t%2 == 0:
+			vals = append(vals, append([]byte(nil), v...))
+		default:
+			vals = append(vals, db.text(v))
+		}
+	}
+	return vals, nil
+}
+
+func (db *DB) text(b []byte) string {
+	if db.encoding == 1 {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if db.encoding == 2 {
+			u[i] = binary.LittleEndian.Uint16(b[2*i:])
+		} else {
+			u[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// bigInt decodes a big-endian two's complement integer of 1 to 8 bytes.
+func bigInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// varint decodes a SQLite variable-length integer, returning it and its
+// length in bytes (0 if b is too short).
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// parseColumns extracts column names from a CREATE TABLE statement and the
+// index of an INTEGER PRIMARY KEY column (-1 if none).
+func parseColumns(sql string) ([]string, int) {
+	open := strings.IndexByte(sql, '(')
+	if open < 0 {
+		return nil, -1
+	}
+	var defs []string
+	depth, start := 0, open+1
+	var quote byte
+	for i := open + 1; i < len(sql); i++ {
+		c := sql[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '[':
+			quote = ']'
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				defs = append(defs, sql[start:i])
+				i = len(sql)
+				continue
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, sql[start:i])
+				start = i + 1
+			}
+		}
+	}
+	var cols []string
+	rowid := -1
+	for _, d := range defs {
+		d = strings.TrimSpace(d)
+		up := strings.ToUpper(d)
+		if d == "" || strings.HasPrefix(up, "CONSTRAINT") || strings.HasPrefix(up, "PRIMARY KEY") ||
+			strings.HasPrefix(up, "UNIQUE") || strings.HasPrefix(up, "CHECK") || strings.HasPrefix(up, "FOREIGN KEY") {
+			continue
+		}
+		name, rest := splitIdent(d)
+		fields := strings.Fields(strings.ToUpper(rest))
+		if len(fields) > 0 && fields[0] == "INTEGER" && strings.Contains(strings.Join(fields, " "), "PRIMARY KEY") &&
+			!strings.Contains(strings.Join(fields, " "), "PRIMARY KEY DESC") {
+			rowid = len(cols)
+		}
+		cols = append(cols, name)
+	}
+	return cols, rowid
+}
+
+// splitIdent splits a column definition into its (unquoted) name and the rest.
+func splitIdent(d string) (string, string) {
+	if d == "" {
+		return "", ""
+	}
+	closer := map[byte]byte{'"': '"', '`': '`', '[': ']', '\'': '\''}[d[0]]
+	if closer != 0 {
+		if end := strings.IndexByte(d[1:], closer); end >= 0 {
+			return d[1 : end+1], d[end+2:]
+		}
+	}
+	if i := strings.IndexAny(d, " \t\r\n"); i >= 0 {
+		return d[:i], d[i:]
+	}
+	return d, ""
+}
@@ -0,0 +1,359 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixture.sqlite is written by testdata/mkfixtures.py.
+const fixture = "testdata/fixture.sqlite"
+
+func openFixture(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func table(t *testing.T, db *DB, name string) Table {
+	t.Helper()
+	tb, err := db.Table(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func blobOf(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestTables(t *testing.T) {
+	db := openFixture(t)
+	tests := []struct {
+		name     string
+		columns  []string
+		rowIDCol int
+	}{
+		{"people", []string{"id", "name", "age"}, 0},
+		{"MIXED VALUES", []string{"label", "fid", "n", "f", "b"}, 1},
+		{"blobs", []string{"k", "data"}, -1},
+	}
+	for _, tt := range tests {
+		tb := table(t, db, tt.name)
+		if !reflect.DeepEqual(tb.Columns, tt.columns) || tb.RowIDCol != tt.rowIDCol {
+			t.Errorf("%s: columns %q rowid col %d, want %q %d", tt.name, tb.Columns, tb.RowIDCol, tt.columns, tt.rowIDCol)
+		}
+	}
+	if _, err := db.Table("missing"); err == nil {
+		t.Error("Table(missing): no error")
+	}
+}
+
+// TestFixtureLayout checks that the fixture exercises what the other tests
+// rely on, should it be regenerated by a different SQLite.
+func TestFixtureLayout(t *testing.T) {
+	db := openFixture(t)
+	pg, err := db.page(table(t, db, "people").RootPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pg[0] != 0x05 {
+		t.Errorf("people root page type %#x, want an interior page", pg[0])
+	}
+	short := 0
+	err = db.walk(table(t, db, "people").RootPage, 0, func(rowid int64, c cell) error {
+		vals, err := db.cellRecord(c, 0)
+		if len(vals) == 2 {
+			short++
+		}
+		return err
+	})
+	if err != nil || short != 2000 {
+		t.Errorf("%d records written before ADD COLUMN (err %v), want 2000", short, err)
+	}
+	err = db.walk(table(t, db, "blobs").RootPage, 0, func(rowid int64, c cell) error {
+		if rowid > 1 && db.localSize(c.size) == c.size {
+			return fmt.Errorf("blob row %d is not on overflow pages", rowid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := openFixture(t)
+	tests := []struct {
+		table string
+		rows  map[int64][]any // spot checks by rowid
+		count int
+	}{
+		{
+			table: "people",
+			rows: map[int64][]any{
+				1:    {int64(1), "name-1", nil},
+				1000: {int64(1000), "name-1000", nil},
+				2000: {int64(2000), "name-2000", nil},
+				2001: {int64(2001), "name-2001", int64(21)},
+				2100: {int64(2100), "name-2100", int64(30)},
+			},
+			count: 2100,
+		},
+		{
+			table: "mixed values",
+			rows: map[int64][]any{
+				// SQLite writes integral REALs as integers, and they
+				// are returned as stored
+				10: {"zero", int64(10), int64(0), int64(0), nil},
+				11: {"one", int64(11), int64(1), 1.5, []byte{1}},
+				12: {"negative", int64(12), int64(-300000), -2.25, []byte{}},
+				13: {"big", int64(13), int64(1 << 40), 1e300, nil},
+				14: {"héllo wörld", int64(14), nil, nil, nil},
+			},
+			count: 5,
+		},
+		{
+			table: "blobs",
+			rows: map[int64][]any{
+				1: {"blob-100", blobOf(100)},
+				2: {"blob-2000", blobOf(2000)},
+				3: {"blob-10000", blobOf(10000)},
+			},
+			count: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			tb := table(t, db, tt.table)
+			var last int64
+			count := 0
+			err := db.Scan(tb, func(rowid int64, row []any) error {
+				if rowid <= last {
+					return fmt.Errorf("rowid %d after %d", rowid, last)
+				}
+				last = rowid
+				count++
+				if want, ok := tt.rows[rowid]; ok && !rowEqual(row, want) {
+					t.Errorf("row %d = %v, want %v", rowid, row, want)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("scanned %d rows, want %d", count, tt.count)
+			}
+		})
+	}
+}
+
+func TestScanColumns(t *testing.T) {
+	db := openFixture(t)
+	tb := table(t, db, "blobs")
+	err := db.ScanColumns(tb, 1, func(rowid int64, row []any) error {
+		if len(row) != 2 || row[0] != fmt.Sprintf("blob-%d", []int{100, 2000, 10000}[rowid-1]) || row[1] != nil {
+			t.Errorf("row %d = %v, want only the key", rowid, row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanStops(t *testing.T) {
+	db := openFixture(t)
+	stop := fmt.Errorf("stop")
+	n := 0
+	err := db.Scan(table(t, db, "people"), func(int64, []any) error {
+		if n++; n == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 10 {
+		t.Errorf("Scan returned %v after %d rows, want stop after 10", err, n)
+	}
+}
+
+func TestRow(t *testing.T) {
+	db := openFixture(t)
+	tests := []struct {
+		table string
+		rowid int64
+		want  []any
+	}{
+		{"people", 1, []any{int64(1), "name-1", nil}},
+		{"people", 777, []any{int64(777), "name-777", nil}},
+		{"people", 2050, []any{int64(2050), "name-2050", int64(70)}},
+		{"people", 2100, []any{int64(2100), "name-2100", int64(30)}},
+		{"people", 0, nil},
+		{"people", 2101, nil},
+		{"mixed values", 13, []any{"big", int64(13), int64(1 << 40), 1e300, nil}},
+		{"mixed values", 9, nil},
+		{"blobs", 3, []any{"blob-10000", blobOf(10000)}},
+	}
+	for _, tt := range tests {
+		row, err := db.Row(table(t, db, tt.table), tt.rowid)
+		if err != nil {
+			t.Errorf("Row(%s, %d): %v", tt.table, tt.rowid, err)
+			continue
+		}
+		if !rowEqual(row, tt.want) {
+			t.Errorf("Row(%s, %d) = %v, want %v", tt.table, tt.rowid, row, tt.want)
+		}
+	}
+}
+
+// TestCorruptPage checks that damaged b-tree pages give errors, not panics.
+func TestCorruptPage(t *testing.T) {
+	db := openFixture(t)
+	people := table(t, db, "people")
+	// follow first children down to the leaf holding rowid 1
+	leaf := people.RootPage
+	for {
+		pg, err := db.page(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pg[0] != 0x05 {
+			break
+		}
+		leaf = int(binary.BigEndian.Uint32(pg[binary.BigEndian.Uint16(pg[12:]):]))
+	}
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(page, off int) int { return (page-1)*db.pageSize + off }
+	tests := []struct {
+		name  string
+		patch func(b []byte)
+	}{
+		{"interior cell count", func(b []byte) { binary.BigEndian.PutUint16(b[at(people.RootPage, 3):], 0xffff) }},
+		{"interior cell pointer", func(b []byte) { binary.BigEndian.PutUint16(b[at(people.RootPage, 12):], uint16(db.pageSize-2)) }},
+		{"leaf cell count", func(b []byte) { binary.BigEndian.PutUint16(b[at(leaf, 3):], 0xffff) }},
+		{"leaf cell pointer", func(b []byte) { binary.BigEndian.PutUint16(b[at(leaf, 8):], 0xffff) }},
+	}
+	for _, tt := range tests {
+		b := bytes.Clone(data)
+		tt.patch(b)
+		path := filepath.Join(t.TempDir(), "corrupt.sqlite")
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cdb, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cdb.Scan(people, func(int64, []any) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "bad cell offset") {
+			t.Errorf("%s: Scan error %v", tt.name, err)
+		}
+		if _, err := cdb.Row(people, 1); err == nil || !strings.Contains(err.Error(), "bad cell offset") {
+			t.Errorf("%s: Row error %v", tt.name, err)
+		}
+		cdb.Close()
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open("testdata/missing.sqlite"); err == nil {
+		t.Error("Open(missing): no error")
+	}
+	if _, err := Open("testdata/mkfixtures.py"); err == nil {
+		t.Error("Open(not a database): no error")
+	}
+}
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want uint64
+		n    int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 1<<64 - 1, 9},
+		{nil, 0, 0},
+	}
+	for _, tt := range tests {
+		got, n := varint(tt.in)
+		if got != tt.want || n != tt.n {
+			t.Errorf("varint(% x) = %d, %d, want %d, %d", tt.in, got, n, tt.want, tt.n)
+		}
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 127, -128, 1 << 40, -1 << 47} {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(v))
+		for _, size := range []int{1, 2, 3, 4, 6, 8} {
+			if size < 8 && (v >= 1<<(8*size-1) || v < -1<<(8*size-1)) {
+				continue
+			}
+			if got := bigInt(b[8-size:]); got != v {
+				t.Errorf("bigInt(% x) = %d, want %d", b[8-size:], got, v)
+			}
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		sql   string
+		cols  []string
+		rowid int
+	}{
+		{"CREATE TABLE t (a, b TEXT)", []string{"a", "b"}, -1},
+		{"CREATE TABLE t (fid INTEGER PRIMARY KEY AUTOINCREMENT, geom BLOB)", []string{"fid", "geom"}, 0},
+		{`CREATE TABLE "t" ("my col" TEXT, [x] REAL, id integer primary key)`, []string{"my col", "x", "id"}, 2},
+		{"CREATE TABLE t (a INT PRIMARY KEY, b)", []string{"a", "b"}, -1},
+		{"CREATE TABLE t (a, b, PRIMARY KEY (a), CHECK (b > 0))", []string{"a", "b"}, -1},
+		{"CREATE TABLE t (a NUMERIC(10, 2), b TEXT DEFAULT 'x,y')", []string{"a", "b"}, -1},
+	}
+	for _, tt := range tests {
+		cols, rowid := parseColumns(tt.sql)
+		if !reflect.DeepEqual(cols, tt.cols) || rowid != tt.rowid {
+			t.Errorf("parseColumns(%q) = %q, %d, want %q, %d", tt.sql, cols, rowid, tt.cols, tt.rowid)
+		}
+	}
+}
+
+func rowEqual(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		ab, aok := a[i].([]byte)
+		bb, bok := b[i].([]byte)
+		if aok || bok {
+			if aok != bok || !bytes.Equal(ab, bb) {
+				return false
+			}
+			continue
+		}
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+#!/usr/bin/env python3
+# Regenerates the fixtures used by sqlite_test.go:
+#
+#   python3 testdata/mkfixtures.py
+#
+# The small page size makes a few thousand rows span interior pages and a few
+# kilobytes of blob spill onto overflow pages.
+import os
+import sqlite3
+
+here = os.path.dirname(os.path.abspath(__file__))
+path = os.path.join(here, "fixture.sqlite")
+if os.path.exists(path):
+    os.remove(path)
+
+db = sqlite3.connect(path)
+db.execute("PRAGMA page_size = 512")
+db.execute("PRAGMA journal_mode = DELETE")
+
+# many rows: a table b-tree with interior pages, INTEGER PRIMARY KEY as the
+# rowid alias, and rows written before and after ALTER TABLE ADD COLUMN
+db.execute("CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)")
+db.executemany("INSERT INTO people (id, name) VALUES (?, ?)",
+               [(i, "name-%d" % i) for i in range(1, 2001)])
+db.execute("ALTER TABLE people ADD COLUMN age INTEGER")
+db.executemany("INSERT INTO people (id, name, age) VALUES (?, ?, ?)",
+               [(i, "name-%d" % i, i % 90) for i in range(2001, 2101)])
+
+# values of every storage class, with the rowid alias not the first column
+db.execute('CREATE TABLE "mixed values" (label TEXT, fid INTEGER PRIMARY KEY, '
+           'n INTEGER, f REAL, b BLOB)')
+db.executemany('INSERT INTO "mixed values" VALUES (?, ?, ?, ?, ?)', [
+    ("zero", 10, 0, 0.0, None),
+    ("one", 11, 1, 1.5, b"\x01"),
+    ("negative", 12, -300000, -2.25, b""),
+    ("big", 13, 1 << 40, 1e300, None),
+    ("héllo wörld", 14, None, None, None),
+])
+
+# blobs larger than a page: payloads continued on overflow pages
+db.execute("CREATE TABLE blobs (k TEXT, data BLOB)")
+for size in (100, 2000, 10000):
+    db.execute("INSERT INTO blobs VALUES (?, ?)",
+               ("blob-%d" % size, bytes(i % 251 for i in range(size))))
+
+db.commit()
+db.close()
@@ -1,12 +1,9 @@
 package tui
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
 
 	table "github.com/charmbracelet/bubbles/table"
 )
@@ -59,118 +56,53 @@ func (m *Model) refreshAttrsFromCurrent() {
     m.tbl.SetRows(trows)
 }
 
-// buildAttributes inspects the current dataset and returns (columns, rows)
+// buildAttributes returns (columns, rows) for the loaded features, one row per
+// feature in the same order as m.fc.Features.
 func (m *Model) buildAttributes() ([]string, [][]string) {
-	p := m.selPath
-	if p == "" {
-		// pasted WKT or ephemeral data: no attributes available
+	if len(m.fc.Features) == 0 {
 		return []string{}, [][]string{}
 	}
-	ext := strings.ToLower(filepath.Ext(p))
-	switch ext {
-	case ".geojson", ".json":
-		return buildAttrsGeoJSON(p)
-	case ".csv":
-		return buildAttrsCSV(p)
-	default:
+	if len(m.fc.Keys) == 0 {
+		p := m.selPath
+		if p == "" {
+			// pasted WKT or ephemeral data: no attributes available
+			return []string{}, [][]string{}
+		}
 		// fallback: just bbox/summary as a single-row table
+		pts, ls, polys := m.fc.Counts()
 		cols := []string{"name", "path", "bbox", "points", "lines", "polygons"}
-		vals := []string{filepath.Base(p), p, fmt.Sprintf("[%.5f,%.5f,%.5f,%.5f]", m.bbox.MinX, m.bbox.MinY, m.bbox.MaxX, m.bbox.MaxY), fmt.Sprintf("%d", len(m.points)), fmt.Sprintf("%d", len(m.lines)), fmt.Sprintf("%d", len(m.polygons))}
+		vals := []string{filepath.Base(p), p, fmt.Sprintf("[%.5f,%.5f,%.5f,%.5f]", m.bbox.MinX, m.bbox.MinY, m.bbox.MaxX, m.bbox.MaxY), fmt.Sprintf("%d", pts), fmt.Sprintf("%d", ls), fmt.Sprintf("%d", polys)}
 		return cols, [][]string{vals}
 	}
-}
-
-// buildAttrsGeoJSON collects properties across all features and unions the keys
-func buildAttrsGeoJSON(path string) ([]string, [][]string) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return []string{}, [][]string{}
-	}
-	var raw map[string]any
-	if err := json.Unmarshal(b, &raw); err != nil {
-		return []string{}, [][]string{}
-	}
-	// collect features array
-	var features []any
-	if t, _ := raw["type"].(string); t == "FeatureCollection" {
-		if fs, ok := raw["features"].([]any); ok {
-			features = fs
-		}
-	} else if t == "Feature" {
-		features = []any{raw}
-	} else {
-		// geometry only; no attributes
-		return []string{"lon", "lat"}, [][]string{}
-	}
-	// union property keys
-	order := []string{}
-	seen := map[string]bool{}
-	propsList := make([]map[string]any, 0, len(features))
-	for _, f := range features {
-		fm, ok := f.(map[string]any)
-		if !ok {
-			continue
-		}
-		pm, _ := fm["properties"].(map[string]any)
-		if pm == nil {
-			pm = map[string]any{}
-		}
-		propsList = append(propsList, pm)
-		for k := range pm {
-			if !seen[k] {
-				seen[k] = true
-				order = append(order, k)
-			}
-		}
-	}
-	// rows
-	rows := make([][]string, 0, len(propsList))
-	for _, pm := range propsList {
-		vals := make([]string, 0, len(order))
-		for _, k := range order {
-			v := pm[k]
-			switch t := v.(type) {
-			case nil:
-				vals = append(vals, "")
-			case string:
-				vals = append(vals, t)
-			case float64:
-				vals = append(vals, fmt.Sprintf("%g", t))
-			case bool:
-				if t {
-					vals = append(vals, "true")
-				} else {
-					vals = append(vals, "false")
-				}
-			default:
-				bs, _ := json.Marshal(t)
-				vals = append(vals, string(bs))
-			}
+	rows := make([][]string, 0, len(m.fc.Features))
+	for _, f := range m.fc.Features {
+		vals := make([]string, 0, len(m.fc.Keys))
+		for _, k := range m.fc.Keys {
+			vals = append(vals, formatValue(f.Properties[k]))
 		}
 		rows = append(rows, vals)
 	}
-	return order, rows
+	return m.fc.Keys, rows
 }
 
-// buildAttrsCSV returns header as columns and each row as values
-func buildAttrsCSV(path string) ([]string, [][]string) {
-	f, err := os.Open(path)
-	if err != nil {
-		return []string{}, [][]string{}
-	}
-	defer f.Close()
-	r := csv.NewReader(f)
-	r.TrimLeadingSpace = true
-	recs, err := r.ReadAll()
-	if err != nil || len(recs) == 0 {
-		return []string{}, [][]string{}
-	}
-	header := recs[0]
-	rows := make([][]string, 0, len(recs)-1)
-	for _, row := range recs[1:] {
-		vals := make([]string, len(header))
-		copy(vals, row)
-		rows = append(rows, vals)
+// formatValue renders a property value for display in the table.
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return fmt.Sprintf("%g", t)
+	case int:
+		return fmt.Sprintf("%d", t)
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	default:
+		bs, _ := json.Marshal(t)
+		return string(bs)
 	}
-	return header, rows
 }
@@ -1,5 +1,7 @@
 package tui
 
+import "math"
+
 type brailleBuf struct {
 	w, h int       // in cells
 	m    [][]uint8 // per-cell 8-bit mask
@@ -52,6 +54,12 @@ func (b *brailleBuf) setPixel(mx, my int) {
 
 // drawLineMicro draws a line on the microgrid using Bresenham
 func (b *brailleBuf) drawLineMicro(x0, y0, x1, y1 int) {
+	// only the part on the grid is walked, so segments reaching far off
+	// screen when zoomed in stay cheap
+	var ok bool
+	if x0, y0, x1, y1, ok = clipSegment(x0, y0, x1, y1, b.w*2, b.h*4); !ok {
+		return
+	}
 	dx := abs(x1 - x0)
 	sx := -1
 	if x0 < x1 {
@@ -80,6 +88,36 @@ func (b *brailleBuf) drawLineMicro(x0, y0, x1, y1 int) {
 	}
 }
 
+// clipSegment clips a segment to the w x h grid, with a pixel of margin,
+// using Liang-Barsky. ok is false when the segment misses the grid.
+func clipSegment(x0, y0, x1, y1, w, h int) (int, int, int, int, bool) {
+	if x0 >= -1 && x0 <= w && y0 >= -1 && y0 <= h && x1 >= -1 && x1 <= w && y1 >= -1 && y1 <= h {
+		return x0, y0, x1, y1, true
+	}
+	fx, fy := float64(x0), float64(y0)
+	dx, dy := float64(x1-x0), float64(y1-y0)
+	t0, t1 := 0.0, 1.0
+	for _, e := range [4][2]float64{{-dx, fx + 1}, {dx, float64(w) - fx}, {-dy, fy + 1}, {dy, float64(h) - fy}} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			t0 = math.Max(t0, r)
+		} else {
+			t1 = math.Min(t1, r)
+		}
+		if t0 > t1 {
+			return 0, 0, 0, 0, false
+		}
+	}
+	return int(math.Round(fx + t0*dx)), int(math.Round(fy + t0*dy)), int(math.Round(fx + t1*dx)), int(math.Round(fy + t1*dy)), true
+}
+
 func (b *brailleBuf) toLines() []string {
 	out := make([]string, b.h)
 	for y := 0; y < b.h; y++ {
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+)
+
+// Zoom limits relative to the view that fits the data, and the step of one
+// key press or wheel notch.
+const (
+	minZoom  = 0.05
+	maxZoom  = 1 << 20
+	zoomStep = 1.2
+	// panStep is the fraction of the view one arrow key press pans by.
+	panStep = 0.125
+)
+
+// camera returns the projected coordinates at the centre of a w x h cell map
+// and its scale in projected units per micro-pixel column. Until the user
+// zooms or pans (camScale 0) the camera fits the data bbox, following its
+// aspect ratio and any change of terminal size.
+func (m Model) camera(w, h int) (cx, cy, scale float64, ok bool) {
+	if m.camScale > 0 {
+		cx, cy = m.projection.Forward(m.camLon, m.camLat)
+		return cx, cy, m.camScale, true
+	}
+	pb, ok := m.projBounds()
+	if !ok || w <= 0 || h <= 0 {
+		return 0, 0, 0, false
+	}
+	return (pb.MinX + pb.MaxX) / 2, (pb.MinY + pb.MaxY) / 2, fitScale(pb, w, h), true
+}
+
+// resetCamera goes back to fitting the data.
+func (m *Model) resetCamera() {
+	m.camLon, m.camLat, m.camScale = 0, 0, 0
+}
+
+// setCamera centres the map on projected x/y at the given scale.
+func (m *Model) setCamera(x, y, scale float64) {
+	m.camLon, m.camLat = m.projection.Inverse(x, y)
+	m.camScale = scale
+}
+
+// zoomFactor is the magnification relative to the view that fits the data.
+func (m Model) zoomFactor(w, h int) float64 {
+	pb, ok := m.projBounds()
+	_, _, scale, okc := m.camera(w, h)
+	if !ok || !okc {
+		return 1
+	}
+	return fitScale(pb, w, h) / scale
+}
+
+// zoomAt magnifies the map by factor, keeping the point under micro-pixel
+// (mx, my) in place, within the minZoom..maxZoom range.
+func (m *Model) zoomAt(factor, mx, my float64, w, h int) {
+	cx, cy, scale, ok := m.camera(w, h)
+	if !ok {
+		return
+	}
+	z := m.zoomFactor(w, h)
+	factor = math.Max(minZoom/z, math.Min(maxZoom/z, factor))
+	// projected offset of the anchor from the centre, which shrinks by factor
+	dx := (mx - float64(2*w-1)/2) * scale
+	dy := -(my - float64(4*h-1)/2) * scale * microAspect
+	m.setCamera(cx+dx-dx/factor, cy+dy-dy/factor, scale/factor)
+	m.status = fmt.Sprintf("zoom: %.2fx", m.zoomFactor(w, h))
+}
+
+// zoomAtPointer zooms around the hovered cell, or the map centre when the
+// pointer is outside the map.
+func (m *Model) zoomAtPointer(factor float64) {
+	w, h := m.mapSize()
+	mx, my := float64(2*w-1)/2, float64(4*h-1)/2
+	if m.hovering {
+		mx, my = float64(m.hoverCellX*2)+0.5, float64(m.hoverCellY*4)+1.5
+	}
+	m.zoomAt(factor, mx, my, w, h)
+}
+
+// pan moves the view by fractions of its width and height; positive fx
+// shows more to the east and positive fy more to the north.
+func (m *Model) pan(fx, fy float64) {
+	w, h := m.mapSize()
+	cx, cy, scale, ok := m.camera(w, h)
+	if !ok {
+		return
+	}
+	m.setCamera(cx+fx*float64(2*w-1)*scale, cy+fy*float64(4*h-1)*scale*microAspect, scale)
+}
+
+// panMicro drags the map by dx, dy micro-pixels, so that the point under a
+// dragging pointer stays under it.
+func (m *Model) panMicro(dx, dy float64, w, h int) {
+	cx, cy, scale, ok := m.camera(w, h)
+	if !ok {
+		return
+	}
+	m.setCamera(cx-dx*scale, cy+dy*scale*microAspect, scale)
+}
@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+
+	"goemap/internal/geom"
+	"goemap/internal/proj"
+)
+
+// detectCRS finds the coordinate system a dataset declares, from its EPSG
+// code, its WKT definition or its CRS name, in that order. It returns nil
+// when the dataset declares none.
+func detectCRS(fc geom.FeatureCollection) (*proj.CRS, error) {
+	var err error
+	if fc.SRID != 0 {
+		var c *proj.CRS
+		if c, err = proj.EPSG(fc.SRID); err == nil {
+			return c, nil
+		}
+	}
+	if fc.CRSWKT != "" {
+		return proj.ParseWKT(fc.CRSWKT)
+	}
+	if fc.CRS != "" && fc.SRID == 0 {
+		return proj.Parse(fc.CRS)
+	}
+	return nil, err
+}
+
+// setSourceCRS records the coordinate system of a freshly loaded dataset and
+// reprojects fc to WGS 84 lon/lat when it is in another one.
+func (m *Model) setSourceCRS(fc *geom.FeatureCollection) {
+	m.srcCRS, m.crsErr = detectCRS(*fc)
+	if m.crsErr != nil {
+		m.srcCRS = nil
+	}
+	m.toDisplay(fc)
+}
+
+// toDisplay reprojects features read in the source coordinate system to
+// WGS 84.
+func (m *Model) toDisplay(fc *geom.FeatureCollection) {
+	if m.srcCRS != nil && !m.srcCRS.IsWGS84() {
+		fc.Transform(m.srcCRS.ToWGS84)
+	}
+}
+
+// crsSummary describes the source coordinate system for the status line,
+// e.g. "  crs=EPSG:27700 reprojected to WGS 84", or "" for WGS 84 data.
+func (m *Model) crsSummary() string {
+	switch {
+	case m.crsErr != nil:
+		return "  " + m.crsErr.Error() + ", drawn as lon/lat"
+	case m.srcCRS == nil || m.srcCRS.IsWGS84():
+		return ""
+	}
+	return "  crs=" + m.srcCRS.String() + " reprojected to WGS 84"
+}
+
+// crsInfo lists the source coordinate system for the inspect popup.
+func (m *Model) crsInfo() []string {
+	if m.srcCRS == nil {
+		crs := m.fc.CRS
+		if crs == "" {
+			crs = "unknown (lon/lat assumed)"
+		}
+		info := []string{"crs: " + crs}
+		if m.crsErr != nil {
+			info = append(info, "crs error: "+m.crsErr.Error())
+		}
+		return info
+	}
+	c := m.srcCRS
+	d := c.Datum
+	info := []string{
+		"crs: " + c.String(),
+		fmt.Sprintf("datum: %s (%s)", d.Name, d.Ellipsoid.Name),
+	}
+	if c.Conversion != nil {
+		info = append(info, "projection: "+c.Conversion.Method())
+	}
+	if !c.IsWGS84() {
+		info = append(info, "shown in: WGS 84 lon/lat")
+	}
+	return info
+}
+
+// sourceBBox converts a WGS 84 extent, such as the viewport, to the
+// bounding box of its image in the source coordinate system.
+func (m *Model) sourceBBox(bb geom.BBox) geom.BBox {
+	if m.srcCRS == nil || m.srcCRS.IsWGS84() {
+		return bb
+	}
+	bb.MinX, bb.MaxX = math.Max(bb.MinX, -180), math.Min(bb.MaxX, 180)
+	bb.MinY, bb.MaxY = math.Max(bb.MinY, -90), math.Min(bb.MaxY, 90)
+	return transformBBox(bb, m.srcCRS.FromWGS84)
+}
+
+// displayBBox converts an extent in the source coordinate system to WGS 84.
+func (m *Model) displayBBox(bb geom.BBox) geom.BBox {
+	if m.srcCRS == nil || m.srcCRS.IsWGS84() {
+		return bb
+	}
+	return transformBBox(bb, m.srcCRS.ToWGS84)
+}
+
+// transformBBox returns the bounding box of bb's corners and edge midpoints
+// under fn, which covers the curved edges of a projected box closely enough
+// for viewport queries.
+func transformBBox(bb geom.BBox, fn func(x, y float64) (float64, float64)) geom.BBox {
+	var out geom.BBox
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			x, y := fn(bb.MinX+(bb.MaxX-bb.MinX)*float64(i)/2, bb.MinY+(bb.MaxY-bb.MinY)*float64(j)/2)
+			if i == 0 && j == 0 {
+				out = geom.BBox{MinX: x, MinY: y, MaxX: x, MaxY: y}
+				continue
+			}
+			out.MinX, out.MaxX = math.Min(out.MinX, x), math.Max(out.MaxX, x)
+			out.MinY, out.MaxY = math.Min(out.MinY, y), math.Max(out.MaxY, y)
+		}
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"goemap/internal/geom"
+)
+
+// fgbLimit caps the features decoded for one viewport so that zoomed-out
+// views of very large FlatGeobuf files stay responsive.
+const fgbLimit = 50000
+
+// loadFlatGeobuf opens a FlatGeobuf file and shows the features inside the
+// viewport. The map extent comes from the file header; features are fetched
+// in the background, first for the whole extent and then through the file's
+// R-tree whenever the viewport changes.
+func (m *Model) loadFlatGeobuf(p string) tea.Cmd {
+	src, err := geom.OpenFlatGeobuf(p)
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
+	}
+	m.finishLoad(p, geom.FeatureCollection{CRS: src.CRS, SRID: src.SRID, CRSWKT: src.CRSWKT})
+	m.fgb = src
+	m.bbox = m.displayBBox(src.Envelope)
+	m.updateProjection()
+	view, _ := m.viewBBox()
+	m.fgbView, m.viewQuery = view, true
+	m.status = "loading: " + filepath.Base(p)
+	return func() tea.Msg {
+		fc, more, err := src.Query(src.Envelope, fgbLimit)
+		return fgbQueryMsg{src: src, view: view, fc: fc, more: more, err: err, first: true}
+	}
+}
+
+// fgbQueryMsg carries the result of a viewport query of src back from the
+// command that ran it.
+type fgbQueryMsg struct {
+	src  *geom.FlatGeobuf
+	view geom.BBox
+	fc   geom.FeatureCollection
+	more bool
+	err  error
+	// first marks the query of the whole file made when it is opened
+	first bool
+}
+
+// refreshViewport starts a query of the open FlatGeobuf file, or MBTiles
+// tileset, when the visible extent has changed since the last one, and
+// returns nil for other sources. Queries run in the background one at a time,
+// so dragging the map does not start one per mouse motion: when a query
+// finishes, the view reached by then is queried next.
+func (m *Model) refreshViewport() tea.Cmd {
+	if m.viewQuery {
+		return nil
+	}
+	if m.mbt != nil {
+		return m.refreshTiles()
+	}
+	if m.fgb == nil {
+		return nil
+	}
+	view, ok := m.viewBBox()
+	if !ok || view == m.fgbView {
+		return nil
+	}
+	m.fgbView, m.viewQuery = view, true
+	src, bb := m.fgb, m.sourceBBox(view)
+	return func() tea.Msg {
+		fc, more, err := src.Query(bb, fgbLimit)
+		return fgbQueryMsg{src: src, view: view, fc: fc, more: more, err: err}
+	}
+}
+
+// onFgbQuery shows the features of a finished viewport query. Results for a
+// file that has since been closed, or a view the map has since left, are
+// dropped.
+func (m *Model) onFgbQuery(msg fgbQueryMsg) tea.Cmd {
+	if msg.src != m.fgb {
+		return nil
+	}
+	m.viewQuery = false
+	view, ok := m.viewBBox()
+	if (!ok || view != msg.view) && !msg.first {
+		return m.refreshViewport()
+	}
+	if msg.err != nil {
+		m.status = "fgb error: " + msg.err.Error()
+		return nil
+	}
+	fc := msg.fc
+	m.toDisplay(&fc)
+	m.reselect(fc.Features)
+	m.fc = fc
+	m.hoverFeat = -1
+	m.collectLayers()
+	if m.showAttrs {
+		m.refreshAttrsFromCurrent()
+	}
+	m.status = filepath.Base(m.selPath) + fgbSummary(len(fc.Features), m.fgb.Count, msg.more)
+	if msg.first {
+		// the whole file was queried; the view may have been sized since
+		m.pickVisibility(fc)
+		m.status = "loaded: " + m.status + m.crsSummary()
+		return m.refreshViewport()
+	}
+	return nil
+}
+
+// fgbSummary reports how much of a FlatGeobuf file is in view.
+func fgbSummary(n int, total uint64, more bool) string {
+	s := fmt.Sprintf("  in view: %d of %d features", n, total)
+	if more {
+		s += " (limit reached, zoom in for more)"
+	}
+	return s
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	list "github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
 
 	"goemap/internal/geom"
 )
@@ -15,6 +16,7 @@ import (
 type fileItem struct {
 	title, desc string
 	path        string
+	layer       string // table within a multi-layer file such as a GeoPackage
 	isDir       bool
 }
 
@@ -22,6 +24,23 @@ func (f fileItem) Title() string       { return f.title }
 func (f fileItem) Description() string { return f.desc }
 func (f fileItem) FilterValue() string { return f.title }
 
+// supportedExts lists the file extensions shown in the explorer; each has a
+// case in loadPath. Only .xml files that hold GML are listed.
+var supportedExts = map[string]bool{
+	".geojson": true, ".json": true, ".topojson": true,
+	".geojsonl": true, ".geojsons": true, ".ndjson": true, ".jsonl": true,
+	".csv": true,
+	".kml": true, ".kmz": true,
+	".gml": true, ".xml": true,
+	".gpx": true,
+	".wkt": true, ".wkb": true,
+	".shp":  true,
+	".gpkg": true,
+	".fgb":  true,
+	".osm":  true, ".pbf": true, ".mvt": true,
+	".mbtiles": true,
+}
+
 func (m *Model) refreshDir() {
 	entries, err := os.ReadDir(m.cwd)
 	if err != nil {
@@ -36,9 +55,19 @@ func (m *Model) refreshDir() {
 			continue
 		}
 		ext := strings.ToLower(filepath.Ext(name))
-		if ext == ".geojson" || ext == ".json" || ext == ".csv" || ext == ".kml" || ext == ".wkt" || ext == ".shp" {
-			items = append(items, fileItem{title: name, desc: ext, path: p})
+		if !supportedExts[ext] || ext == ".xml" && !geom.IsGML(p) {
+			continue
+		}
+		// GeoPackages with several feature tables get one entry per table
+		if ext == ".gpkg" {
+			if layers, err := geom.GeoPackageLayers(p); err == nil && len(layers) > 1 {
+				for _, l := range layers {
+					items = append(items, fileItem{title: name + ":" + l, desc: ext + " layer", path: p, layer: l})
+				}
+				continue
+			}
 		}
+		items = append(items, fileItem{title: name, desc: ext, path: p})
 	}
 	sort.SliceStable(items, func(i, j int) bool { return items[i].(fileItem).Title() < items[j].(fileItem).Title() })
 	m.items = items
@@ -48,66 +77,149 @@ func (m *Model) refreshDir() {
 	}
 }
 
-// loadPath loads supported formats into the model.
-func (m *Model) loadPath(p string) {
-	m.selPath = p
+// loadPath loads supported formats into the model. GeoJSON is decoded in the
+// background; the returned command drives that load and is nil otherwise.
+func (m *Model) loadPath(p string) tea.Cmd {
 	ext := strings.ToLower(filepath.Ext(p))
+	var fc geom.FeatureCollection
+	var err error
 	switch ext {
-	case ".geojson", ".json":
-		d, err := geom.LoadGeo(p)
-		if err != nil {
-			m.status = "load error: " + err.Error()
-			return
-		}
-		m.points, m.lines, m.polygons, m.bbox = d.Points, d.Lines, d.Polygons, d.BBox
-		// prefer polys > lines > points for visibility
-		m.showPolys = len(m.polygons) > 0
-		m.showLines = len(m.lines) > 0 && !m.showPolys
-		m.showPoints = len(m.points) > 0 && !m.showPolys
-		m.status = "loaded: " + filepath.Base(p) +
-			fmt.Sprintf("  counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons))
+	case ".geojson", ".json", ".topojson":
+		return m.startGeoJSONLoad(p)
+	case ".geojsonl", ".geojsons", ".ndjson", ".jsonl":
+		fc, err = geom.LoadGeoJSONSeq(p)
 	case ".csv":
-		pts, bb, err := geom.LoadCSV(p)
-		if err != nil {
-			m.status = "load error: " + err.Error()
-			return
-		}
-		m.points, m.lines, m.polygons, m.bbox = pts, nil, nil, bb
-		m.showPolys = false
-		m.showLines = false
-		m.showPoints = len(m.points) > 0
-		m.status = "loaded: " + filepath.Base(p) +
-			fmt.Sprintf("  counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons))
+		fc, err = geom.LoadCSV(p)
 	case ".kml":
-		pts, bb, err := geom.LoadKML(p)
-		if err != nil {
-			m.status = "load error: " + err.Error()
-			return
+		fc, err = geom.LoadKML(p)
+	case ".kmz":
+		fc, err = geom.LoadKMZ(p)
+	case ".gml", ".xml":
+		fc, err = geom.LoadGML(p)
+	case ".wkb":
+		fc, err = geom.LoadWKB(p)
+	case ".gpx":
+		fc, err = geom.LoadGPX(p)
+	case ".shp":
+		fc, err = geom.LoadShapefile(p)
+	case ".gpkg":
+		return m.loadGeoPackage(p, "")
+	case ".fgb":
+		return m.loadFlatGeobuf(p)
+	case ".osm":
+		fc, err = geom.LoadOSM(p, m.osmFilter)
+	case ".pbf":
+		if !geom.IsOSMPBF(p) {
+			return m.loadVectorTile(p)
 		}
-		m.points, m.lines, m.polygons, m.bbox = pts, nil, nil, bb
-		m.status = "loaded: " + filepath.Base(p) +
-			fmt.Sprintf("  counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons))
+		fc, err = geom.LoadOSM(p, m.osmFilter)
+	case ".mvt":
+		return m.loadVectorTile(p)
+	case ".mbtiles":
+		return m.loadMBTiles(p)
 	case ".wkt":
-		data, err := os.ReadFile(p)
+		var data []byte
+		data, err = os.ReadFile(p)
 		if err != nil {
-			m.status = "load error: " + err.Error()
-			return
+			break
 		}
-		d, err := geom.ParseWKTData(string(data))
+		fc, err = geom.ParseWKTData(string(data))
 		if err != nil {
 			m.status = "wkt error: " + err.Error()
-			return
+			return nil
 		}
-		m.points, m.lines, m.polygons, m.bbox = d.Points, d.Lines, d.Polygons, d.BBox
-		// prefer polys > lines > points for visibility
-		m.showPolys = len(m.polygons) > 0
-		m.showLines = len(m.lines) > 0 && !m.showPolys
-		m.showPoints = len(m.points) > 0 && !m.showPolys
-		m.status = "loaded: " + filepath.Base(p) +
-			fmt.Sprintf("  counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons))
 	default:
 		m.status = "unsupported file: " + ext
+		return nil
+	}
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
 	}
+	m.finishLoad(p, fc)
+	if (ext == ".osm" || ext == ".pbf") && len(m.osmFilter) > 0 {
+		m.status += "  filter=" + m.osmFilter.String()
+	}
+	return nil
+}
+
+// loadVectorTile loads a Mapbox Vector Tile placed by the -tile option or the
+// z/x/y in its path; without either it is shown in tile-local coordinates.
+func (m *Model) loadVectorTile(p string) tea.Cmd {
+	tile := m.tile
+	if tile == nil {
+		if t, ok := geom.TileFromPath(p); ok {
+			tile = &t
+		}
+	}
+	fc, err := geom.LoadMVT(p, tile)
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
+	}
+	m.finishLoad(p, fc)
+	if tile != nil {
+		m.status += "  tile=" + tile.String()
+	} else {
+		m.status += "  no z/x/y: tile-local coordinates"
+	}
+	m.status += fmt.Sprintf("  %d layers (L select, v toggle)", len(m.layers))
+	return nil
+}
+
+// loadStdin shows data piped to the program, in the given or sniffed format.
+func (m *Model) loadStdin(data []byte, format string) {
+	fc, format, err := geom.Decode(data, format, m.osmFilter, m.tile)
+	if err != nil {
+		m.status = "stdin: " + err.Error()
+		return
+	}
+	m.finishLoad("<stdin>", fc)
+	m.status += "  format=" + format
+}
+
+// loadItem loads the file, or the GeoPackage table, behind a sidebar entry.
+func (m *Model) loadItem(it fileItem) tea.Cmd {
+	if it.layer != "" {
+		return m.loadGeoPackage(it.path, it.layer)
+	}
+	return m.loadPath(it.path)
+}
+
+// loadGeoPackage loads one feature table of a GeoPackage; layer "" picks the
+// first. The status names the table and how many others are available.
+func (m *Model) loadGeoPackage(p, layer string) tea.Cmd {
+	fc, err := geom.LoadGeoPackage(p, layer)
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
+	}
+	m.finishLoad(p, fc)
+	if layers, err := geom.GeoPackageLayers(p); err == nil && len(layers) > 1 {
+		m.status += fmt.Sprintf("  layer=%s (%d of %d, pick others in the sidebar)", fc.Features[0].Layer, indexFold(layers, fc.Features[0].Layer)+1, len(layers))
+	} else {
+		m.status += "  layer=" + fc.Features[0].Layer
+	}
+	return nil
+}
+
+// indexFold returns the index of s in list, ignoring case, or -1.
+func indexFold(list []string, s string) int {
+	for i, v := range list {
+		if strings.EqualFold(v, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// finishLoad installs a freshly loaded dataset from path p.
+func (m *Model) finishLoad(p string, fc geom.FeatureCollection) {
+	m.selPath = p
+	m.setData(fc)
+	pts, ls, polys := fc.Counts()
+	m.status = "loaded: " + filepath.Base(p) +
+		fmt.Sprintf("  counts: pts=%d ls=%d poly=%d", pts, ls, polys) + skippedSummary(fc.Skipped, fc.SkippedRows) + m.crsSummary()
 	// If attributes are currently shown, verify availability for the new dataset
 	if m.showAttrs {
 		cols, rows := m.buildAttributes()
@@ -119,3 +231,75 @@ func (m *Model) loadPath(p string) {
 		}
 	}
 }
+
+// setData replaces the current dataset and picks initial layer visibility.
+// A GeoJSON load still in flight is cancelled so that it cannot replace the
+// new data when it finishes.
+func (m *Model) setData(fc geom.FeatureCollection) {
+	m.cancelLoad()
+	if m.fgb != nil {
+		m.fgb.Close()
+		m.fgb = nil
+	}
+	if m.mbt != nil {
+		m.mbt.Close()
+		m.mbt = nil
+	}
+	m.viewQuery = false
+	m.setSourceCRS(&fc)
+	m.fc, m.bbox = fc, fc.BBox
+	m.updateProjection()
+	m.resetCamera()
+	m.hoverFeat, m.selected = -1, nil
+	m.hiddenLayers, m.layerSel = map[string]bool{}, 0
+	m.collectLayers()
+	m.pickVisibility(fc)
+}
+
+// pickVisibility shows one geometry type of fc, preferring polygons, then
+// lines, then points.
+func (m *Model) pickVisibility(fc geom.FeatureCollection) {
+	pts, ls, polys := fc.Counts()
+	m.showPolys = polys > 0
+	m.showLines = ls > 0 && !m.showPolys
+	m.showPoints = pts > 0 && !m.showPolys
+}
+
+// collectLayers lists the named data layers of the current dataset in order
+// of appearance, keeping the selection in range.
+func (m *Model) collectLayers() {
+	m.layers = m.layers[:0]
+	seen := map[string]bool{}
+	for _, f := range m.fc.Features {
+		if !seen[f.Layer] {
+			seen[f.Layer] = true
+			m.layers = append(m.layers, f.Layer)
+		}
+	}
+	if m.layerSel >= len(m.layers) {
+		m.layerSel = 0
+	}
+}
+
+// skippedSummary describes records a loader had to skip, e.g.
+// "  skipped 3 (lines 4, 9, 12)", or "" when nothing was skipped. With rows
+// set the numbers are table rowids rather than line numbers.
+func skippedSummary(lines []int, rows bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	const show = 5
+	nums := make([]string, 0, show)
+	for i, n := range lines {
+		if i == show {
+			nums = append(nums, "…")
+			break
+		}
+		nums = append(nums, fmt.Sprintf("%d", n))
+	}
+	unit := "lines"
+	if rows {
+		unit = "rows"
+	}
+	return fmt.Sprintf("  skipped %d (%s %s)", len(lines), unit, strings.Join(nums, ", "))
+}
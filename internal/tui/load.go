@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"goemap/internal/geom"
+)
+
+// loadJob is a GeoJSON file being decoded in the background. Messages from
+// the decoding goroutine arrive on ch; a job that has been replaced or
+// cancelled is recognised by pointer identity and its messages are dropped.
+type loadJob struct {
+	path   string
+	size   int64
+	ch     chan tea.Msg
+	cancel context.CancelFunc
+}
+
+type loadProgressMsg struct {
+	job      *loadJob
+	read     int64
+	features int
+}
+
+type loadDoneMsg struct {
+	job *loadJob
+	fc  geom.FeatureCollection
+	err error
+}
+
+// startGeoJSONLoad begins streaming path in a goroutine, cancelling any load
+// already in flight, and returns the command that waits for its first message.
+func (m *Model) startGeoJSONLoad(path string) tea.Cmd {
+	f, err := os.Open(path)
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
+	}
+	var size int64
+	if st, err := f.Stat(); err == nil {
+		size = st.Size()
+	}
+	m.cancelLoad()
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &loadJob{path: path, size: size, ch: make(chan tea.Msg, 1), cancel: cancel}
+	m.load = job
+	m.status = "loading: " + filepath.Base(path) + "  (Esc to cancel)"
+	go func() {
+		defer f.Close()
+		// closing ch releases waitForLoad once a cancelled job gives up
+		defer close(job.ch)
+		var last time.Time
+		fc, err := geom.DecodeGeoJSON(ctx, f, func(read int64, n int) {
+			if time.Since(last) < 100*time.Millisecond {
+				return
+			}
+			last = time.Now()
+			// progress is best effort: never stall decoding on a busy UI
+			select {
+			case job.ch <- loadProgressMsg{job: job, read: read, features: n}:
+			default:
+			}
+		})
+		select {
+		case job.ch <- loadDoneMsg{job: job, fc: fc, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+	return waitForLoad(job)
+}
+
+// waitForLoad returns the command that waits for job's next message; it
+// yields nil once the job has ended without one.
+func waitForLoad(job *loadJob) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-job.ch
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// cancelLoad aborts the background load, if any.
+func (m *Model) cancelLoad() {
+	if m.load == nil {
+		return
+	}
+	m.load.cancel()
+	m.status = "load cancelled: " + filepath.Base(m.load.path)
+	m.load = nil
+}
+
+func (m *Model) onLoadProgress(msg loadProgressMsg) tea.Cmd {
+	if msg.job != m.load {
+		return nil
+	}
+	pct := ""
+	if msg.job.size > 0 {
+		pct = fmt.Sprintf("  %d%%", min(100, int(msg.read*100/msg.job.size)))
+	}
+	m.status = fmt.Sprintf("loading: %s%s  %d features  (Esc to cancel)", filepath.Base(msg.job.path), pct, msg.features)
+	return waitForLoad(msg.job)
+}
+
+func (m *Model) onLoadDone(msg loadDoneMsg) {
+	if msg.job != m.load {
+		return
+	}
+	m.load = nil
+	msg.job.cancel()
+	if msg.err != nil {
+		if !errors.Is(msg.err, context.Canceled) {
+			m.status = "load error: " + msg.err.Error()
+		}
+		return
+	}
+	m.finishLoad(msg.job.path, msg.fc)
+}
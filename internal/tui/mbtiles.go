@@ -0,0 +1,123 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"goemap/internal/geom"
+)
+
+// mbtMaxTiles caps the tiles decoded for one view; the zoom is lowered
+// until the viewport needs no more than this.
+const mbtMaxTiles = 36
+
+// loadMBTiles opens a tileset and draws the vector tiles covering the
+// viewport at a zoom suited to the map width.
+func (m *Model) loadMBTiles(p string) tea.Cmd {
+	mbt, err := geom.OpenMBTiles(p)
+	if err != nil {
+		m.status = "load error: " + err.Error()
+		return nil
+	}
+	m.finishLoad(p, geom.FeatureCollection{})
+	m.mbt = mbt
+	m.bbox = mbt.Bounds
+	m.updateProjection()
+	m.mbtView = geom.BBox{}
+	// the first view is decoded as part of the load, so that the initial
+	// layer visibility can follow what it holds
+	if view, ok := m.viewBBox(); ok {
+		fc, z, err := mbt.Query(view, m.tileZoom(view), mbtMaxTiles)
+		m.onTilesQuery(tilesQueryMsg{src: mbt, view: view, fc: fc, zoom: z, err: err})
+	}
+	pts, ls, polys := m.fc.Counts()
+	m.showPolys = polys > 0
+	m.showLines = ls > 0
+	m.showPoints = pts > 0
+	return nil
+}
+
+// tilesQueryMsg carries the decoded tiles of a viewport query of src back
+// from the command that ran it.
+type tilesQueryMsg struct {
+	src  *geom.MBTiles
+	view geom.BBox
+	fc   geom.FeatureCollection
+	zoom int
+	err  error
+}
+
+// tileZoom is the zoom level suited to drawing view at the map width.
+func (m *Model) tileZoom(view geom.BBox) int {
+	w, _ := m.mapSize()
+	// about one tile per 64 braille pixels across the map
+	return m.mbt.ZoomFor(view, float64(2*w)/64)
+}
+
+// refreshTiles starts decoding the tiles covering the viewport in the
+// background when it has moved (see refreshViewport).
+func (m *Model) refreshTiles() tea.Cmd {
+	view, ok := m.viewBBox()
+	if !ok || view == m.mbtView {
+		return nil
+	}
+	m.mbtView, m.viewQuery = view, true
+	src, z := m.mbt, m.tileZoom(view)
+	return func() tea.Msg {
+		fc, z, err := src.Query(view, z, mbtMaxTiles)
+		return tilesQueryMsg{src: src, view: view, fc: fc, zoom: z, err: err}
+	}
+}
+
+// onTilesQuery shows the features of a finished tile query. Results for a
+// tileset that has since been closed, or a view the map has since left, are
+// dropped.
+func (m *Model) onTilesQuery(msg tilesQueryMsg) tea.Cmd {
+	if msg.src != m.mbt {
+		return nil
+	}
+	m.viewQuery = false
+	if view, ok := m.viewBBox(); !ok || view != msg.view {
+		return m.refreshViewport()
+	}
+	m.mbtView, m.mbtZoom = msg.view, msg.zoom
+	if msg.err != nil {
+		m.status = filepath.Base(m.selPath) + "  " + msg.err.Error() + "  " + m.zoomSummary()
+		return nil
+	}
+	m.reselect(msg.fc.Features)
+	m.fc = msg.fc
+	m.hoverFeat = -1
+	m.collectLayers()
+	if m.showAttrs {
+		m.refreshAttrsFromCurrent()
+	}
+	m.status = fmt.Sprintf("%s  zoom %d: %d features  %s", filepath.Base(m.selPath), msg.zoom, len(msg.fc.Features), m.zoomSummary())
+	return nil
+}
+
+// zoomSummary lists the tileset's zoom levels and tile counts, e.g.
+// "tiles z0:1 z1:4 z2:12".
+func (m Model) zoomSummary() string {
+	parts := []string{"tiles"}
+	for _, z := range m.mbt.Zooms() {
+		parts = append(parts, fmt.Sprintf("z%d:%d", z, m.mbt.Counts[z]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// mbtilesInfo renders the metadata table and zoom levels for the inspect popup.
+func (m Model) mbtilesInfo() []string {
+	lines := []string{fmt.Sprintf("mbtiles: %s (format %s, drawing zoom %d)", filepath.Base(m.selPath), m.mbt.Format, m.mbtZoom), m.zoomSummary()}
+	for _, kv := range m.mbt.Metadata {
+		v := kv[1]
+		if len(v) > 80 {
+			v = v[:77] + "..."
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", kv[0], v))
+	}
+	return lines
+}
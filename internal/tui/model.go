@@ -9,6 +9,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"goemap/internal/geom"
+	"goemap/internal/proj"
 )
 
 type Model struct {
@@ -18,9 +19,14 @@ type Model struct {
 	showSidebar bool
 	helpVisible bool
 
-	zoom    float64
-	offsetX int
-	offsetY int
+	// camera (see camera.go): the lon/lat at the centre of the map and the
+	// projected units per micro-pixel; camScale 0 fits the data
+	camLon, camLat float64
+	camScale       float64
+
+	// map projection; projMode indexes proj.Modes (see render.go)
+	projection proj.Projection
+	projMode   int
 
 	status string
 
@@ -31,10 +37,8 @@ type Model struct {
 	selPath string
 
 	// Data
-	points   [][2]float64
-	bbox     geom.BBox
-	lines    [][][2]float64
-	polygons [][][][2]float64
+	fc   geom.FeatureCollection
+	bbox geom.BBox
 
 	// last rendered map size (for inspect)
 	mapW int
@@ -49,6 +53,12 @@ type Model struct {
 	showLines  bool
 	showPolys  bool
 
+	// named data layers (Feature.Layer) in order of appearance; hidden ones
+	// are skipped when drawing and hovering. layerSel is the one L selects.
+	layers       []string
+	hiddenLayers map[string]bool
+	layerSel     int
+
 	// inspect popup
 	inspectPopup string
 
@@ -58,10 +68,49 @@ type Model struct {
 	hoverCellY  int
 	hoverMicX   int
 	hoverMicY   int
+	hoverFeat   int // index into fc.Features of the hovered vertex, -1 if none
 	hoverHasGeo bool
 	hoverLon    float64
 	hoverLat    float64
 
+	// mouse drag (see mouse.go): set from a left press on the map to its
+	// release. rubber makes it a shift-drag selection rectangle from dragX,
+	// dragY instead of a pan; dragLastX, dragLastY is the last cell seen and
+	// dragMoved tells a drag from a click
+	dragging, rubber     bool
+	dragX, dragY         int
+	dragLastX, dragLastY int
+	dragMoved            bool
+
+	// selected features, as indexes into fc.Features
+	selected map[int]bool
+
+	// FlatGeobuf source queried per viewport (see fgb.go), and the extent of
+	// the last query
+	fgb     *geom.FlatGeobuf
+	fgbView geom.BBox
+
+	// MBTiles tileset drawn from the tiles covering the viewport (see
+	// mbtiles.go), with the extent and zoom of the last query
+	mbt     *geom.MBTiles
+	mbtView geom.BBox
+	mbtZoom int
+	// viewQuery is set while a FlatGeobuf or MBTiles viewport query runs
+	viewQuery bool
+
+	// coordinate system the data was read in (see crs.go): nil when the
+	// source declares none, or one that could not be used, as told by crsErr
+	srcCRS *proj.CRS
+	crsErr error
+
+	// OSM tag filter and vector tile address from the command line
+	osmFilter geom.OSMFilter
+	tile      *geom.TileID
+
+	// background load (see load.go)
+	load    *loadJob
+	initCmd tea.Cmd
+
 	// attributes table
 	showAttrs bool
 	tbl       table.Model
@@ -73,11 +122,12 @@ func New() Model {
 	m := Model{
 		showSidebar: false,
 		helpVisible: true,
-		zoom:        1.0,
 		status:      "geomap ready",
 		showPoints:  true,
 		showLines:   true,
 		showPolys:   true,
+		hoverFeat:   -1,
+		projection:  proj.PlateCarree{},
 	}
 	m.cwd, _ = os.Getwd()
 	// list setup
@@ -90,7 +140,7 @@ func New() Model {
 	m.l.SetFilteringEnabled(true)
 	// textarea setup
 	m.ta = textarea.New()
-	m.ta.Placeholder = "Paste WKT here (POINT, MULTIPOINT, LINESTRING, POLYGON). Press Enter to render; Esc to cancel."
+	m.ta.Placeholder = "Paste WKT, hex WKB, GeoJSON, an encoded polyline, geohashes, a bbox or lat, lon pairs. Enter renders; Esc cancels."
 	m.ta.CharLimit = 0
 	m.ta.SetWidth(50)
 	m.ta.SetHeight(6)
@@ -101,11 +151,37 @@ func New() Model {
 	return m
 }
 
+// Options holds command-line settings that affect how files are loaded.
+type Options struct {
+	// OSMFilter keeps only OSM elements with matching tags.
+	OSMFilter geom.OSMFilter
+	// Tile places a vector tile; when nil it is parsed from the file path.
+	Tile *geom.TileID
+	// Stdin holds data read from standard input, shown instead of a file
+	// when the path is "-". Format names its format (see geom.Decode), or
+	// is empty to sniff it.
+	Stdin  []byte
+	Format string
+}
+
 // NewWithPath preloads a file's data at launch.
 func NewWithPath(path string) Model {
+	return NewWithOptions(path, Options{})
+}
+
+// NewWithOptions applies opts and, when path is not empty, preloads it.
+func NewWithOptions(path string, opts Options) Model {
 	m := New()
-	m.loadPath(path)
+	m.osmFilter = opts.OSMFilter
+	m.tile = opts.Tile
+	switch path {
+	case "":
+	case "-":
+		m.loadStdin(opts.Stdin, opts.Format)
+	default:
+		m.initCmd = m.loadPath(path)
+	}
 	return m
 }
 
-func (m Model) Init() tea.Cmd { return nil }
+func (m Model) Init() tea.Cmd { return m.initCmd }
@@ -0,0 +1,267 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"goemap/internal/geom"
+)
+
+// hitRadius is how close, in micro-pixels, a click must be to a point or
+// line to select it.
+const hitRadius = 3.0
+
+// mouseButtons handles the wheel and left button for a mouse event at cell
+// x, y of a w x h map; inside reports whether that cell is on the map. The
+// wheel zooms at the pointer, a left drag pans, a shift-drag (or ctrl-drag,
+// for terminals that keep shift-drag for their own text selection) selects
+// the features in a rectangle, and a click selects the feature under the
+// pointer.
+func (m *Model) mouseButtons(msg tea.MouseMsg, x, y int, inside bool, w, h int) {
+	mx, my := float64(x*2)+0.5, float64(y*4)+1.5
+	switch {
+	case msg.Action == tea.MouseActionPress && inside && msg.Button == tea.MouseButtonWheelUp:
+		m.zoomAt(zoomStep, mx, my, w, h)
+	case msg.Action == tea.MouseActionPress && inside && msg.Button == tea.MouseButtonWheelDown:
+		m.zoomAt(1/zoomStep, mx, my, w, h)
+	case msg.Action == tea.MouseActionPress && inside && msg.Button == tea.MouseButtonLeft:
+		m.dragging, m.rubber, m.dragMoved = true, msg.Shift || msg.Ctrl, false
+		m.dragX, m.dragY, m.dragLastX, m.dragLastY = x, y, x, y
+	case msg.Action == tea.MouseActionMotion && m.dragging:
+		if msg.Button != tea.MouseButtonLeft {
+			// the release happened outside the terminal
+			m.dragging, m.rubber = false, false
+			return
+		}
+		if x == m.dragLastX && y == m.dragLastY {
+			return
+		}
+		if !m.rubber {
+			m.panMicro(float64((x-m.dragLastX)*2), float64((y-m.dragLastY)*4), w, h)
+		}
+		m.dragLastX, m.dragLastY, m.dragMoved = x, y, true
+	case msg.Action == tea.MouseActionRelease && m.dragging:
+		switch {
+		case m.rubber && m.dragMoved:
+			m.selectRect(min(m.dragX, x), min(m.dragY, y), max(m.dragX, x), max(m.dragY, y), w, h)
+		case !m.dragMoved:
+			m.selectAt(mx, my, w, h)
+		}
+		m.dragging, m.rubber = false, false
+	}
+}
+
+// selectAt selects the feature under micro-pixel mx, my and shows its
+// attributes in the inspect popup; a click on empty map clears the selection.
+func (m *Model) selectAt(mx, my float64, w, h int) {
+	feat := m.featureAt(mx, my, w, h)
+	if feat < 0 {
+		m.clearSelection()
+		m.status = "nothing selected"
+		return
+	}
+	m.selected = map[int]bool{feat: true}
+	lon, lat, _ := m.microToLonLat(mx, my, w, h)
+	m.inspectPopup = m.featurePopup(feat, "clicked", lon, lat)
+	m.status = fmt.Sprintf("selected feature %s (Esc clears)", m.fc.Features[feat].ID)
+}
+
+// selectRect selects the features with a drawn vertex inside the cell
+// rectangle x0,y0 - x1,y1.
+func (m *Model) selectRect(x0, y0, x1, y1, w, h int) {
+	m.clearSelection()
+	for i, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
+			continue
+		}
+		inside := false
+		m.shownGeometry(f.Geometry).EachVertex(func(p [2]float64) {
+			if inside {
+				return
+			}
+			mx, my, ok := m.screenXYMicro(p[0], p[1], w, h)
+			inside = ok && mx >= x0*2 && mx <= x1*2+1 && my >= y0*4 && my <= y1*4+3
+		})
+		if inside {
+			m.selected[i] = true
+		}
+	}
+	m.status = fmt.Sprintf("selected %d features (Esc clears)", len(m.selected))
+}
+
+// clearSelection drops the selection and closes the inspect popup.
+func (m *Model) clearSelection() {
+	m.selected = map[int]bool{}
+	m.inspectPopup = ""
+}
+
+// reselect carries the selection over to features, a new query of the same
+// source such as the features in a moved viewport, matching by layer and ID
+// because indexes change from one query to the next.
+func (m *Model) reselect(features []geom.Feature) {
+	if len(m.selected) == 0 {
+		return
+	}
+	keep := map[[2]string]bool{}
+	for i := range m.selected {
+		if i < len(m.fc.Features) {
+			f := m.fc.Features[i]
+			keep[[2]string{f.Layer, f.ID}] = true
+		}
+	}
+	m.selected = map[int]bool{}
+	for i, f := range features {
+		if keep[[2]string{f.Layer, f.ID}] {
+			m.selected[i] = true
+		}
+	}
+}
+
+// firstSelected returns the lowest selected feature index, or the hovered
+// feature when nothing is selected.
+func (m Model) firstSelected() int {
+	first := -1
+	for i := range m.selected {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if first < 0 {
+		return m.hoverFeat
+	}
+	return first
+}
+
+// shownGeometry returns the parts of g whose geometry type is toggled on.
+func (m Model) shownGeometry(g geom.Geometry) geom.Geometry {
+	var out geom.Geometry
+	if m.showPoints {
+		out.Points = g.Points
+	}
+	if m.showLines {
+		out.Lines = g.Lines
+	}
+	if m.showPolys {
+		out.Polygons = g.Polygons
+	}
+	return out
+}
+
+// featureAt returns the index of the visible feature drawn at micro-pixel
+// mx, my: the nearest point, line or polygon edge within hitRadius, else the
+// last polygon containing it, or -1.
+func (m Model) featureAt(mx, my float64, w, h int) int {
+	best, bestD := -1, hitRadius*hitRadius
+	inside := -1
+	near := func(i int, d float64) {
+		if d <= bestD {
+			best, bestD = i, d
+		}
+	}
+	for i, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
+			continue
+		}
+		g := m.shownGeometry(f.Geometry)
+		for _, p := range g.Points {
+			if px, py, ok := m.microXY(p[0], p[1], w, h); ok {
+				near(i, (px-mx)*(px-mx)+(py-my)*(py-my))
+			}
+		}
+		for _, ls := range g.Lines {
+			near(i, m.lineDist2(ls, mx, my, w, h, false))
+		}
+		for _, poly := range g.Polygons {
+			crossings := 0
+			for _, ring := range poly {
+				near(i, m.lineDist2(ring, mx, my, w, h, true))
+				crossings += m.ringCrossings(ring, mx, my, w, h)
+			}
+			// even-odd over all rings leaves holes out
+			if crossings%2 == 1 {
+				inside = i
+			}
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+	return inside
+}
+
+// lineDist2 returns the squared micro-pixel distance from mx, my to a line
+// string, or to a ring when closed is set.
+func (m Model) lineDist2(ls [][2]float64, mx, my float64, w, h int, closed bool) float64 {
+	d := math.Inf(1)
+	n := len(ls)
+	if !closed {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		a, b := ls[i], ls[(i+1)%len(ls)]
+		ax, ay, ok1 := m.microXY(a[0], a[1], w, h)
+		bx, by, ok2 := m.microXY(b[0], b[1], w, h)
+		if ok1 && ok2 {
+			d = math.Min(d, segDist2(mx, my, ax, ay, bx, by))
+		}
+	}
+	return d
+}
+
+// ringCrossings counts the edges of ring crossed by a ray from mx, my
+// towards +x.
+func (m Model) ringCrossings(ring [][2]float64, mx, my float64, w, h int) int {
+	n := 0
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		ax, ay, ok1 := m.microXY(a[0], a[1], w, h)
+		bx, by, ok2 := m.microXY(b[0], b[1], w, h)
+		if ok1 && ok2 && (ay > my) != (by > my) && mx < ax+(my-ay)*(bx-ax)/(by-ay) {
+			n++
+		}
+	}
+	return n
+}
+
+// segDist2 is the squared distance from p to the segment a-b.
+func segDist2(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/l))
+	}
+	x, y := ax+t*dx-px, ay+t*dy-py
+	return x*x + y*y
+}
+
+// selectionBuf draws the selected features, and the rubber band of a
+// shift-drag in progress, for compositing in colour over the map.
+func (m Model) selectionBuf(w, h int) *brailleBuf {
+	sel := newBrailleBuf(w, h)
+	for i := range m.selected {
+		if i >= len(m.fc.Features) || m.hiddenLayers[m.fc.Features[i].Layer] {
+			continue
+		}
+		g := m.shownGeometry(m.fc.Features[i].Geometry)
+		for _, poly := range g.Polygons {
+			m.drawPolygon(sel, poly, w, h)
+		}
+		for _, ls := range g.Lines {
+			m.drawLine(sel, ls, w, h)
+		}
+		for _, p := range g.Points {
+			m.drawPoint(sel, p, w, h)
+		}
+	}
+	if m.dragging && m.rubber {
+		x0, y0 := min(m.dragX, m.dragLastX)*2, min(m.dragY, m.dragLastY)*4
+		x1, y1 := max(m.dragX, m.dragLastX)*2+1, max(m.dragY, m.dragLastY)*4+3
+		sel.drawLineMicro(x0, y0, x1, y0)
+		sel.drawLineMicro(x1, y0, x1, y1)
+		sel.drawLineMicro(x1, y1, x0, y1)
+		sel.drawLineMicro(x0, y1, x0, y0)
+	}
+	return sel
+}
@@ -1,250 +1,393 @@
 package tui
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+
+	"goemap/internal/geom"
+	"goemap/internal/proj"
+)
+
+// cellAspect is the height of a terminal cell relative to its width. Braille
+// splits a cell into 2x4 micro-pixels, so with the usual 1:2 cells each
+// micro-pixel is microAspect (1) times as tall as it is wide.
+const (
+	cellAspect  = 2.0
+	microAspect = cellAspect * 2 / 4
 )
 
-// cellToLonLat converts a map cell coordinate back to lon/lat using bbox, zoom, and pan.
+// cellToLonLat converts a map cell coordinate back to lon/lat through the camera.
 func (m Model) cellToLonLat(cx, cy, w, h int) (float64, float64, bool) {
-	if !(m.bbox.MaxX > m.bbox.MinX && m.bbox.MaxY > m.bbox.MinY) {
+	// the centre of the cell's 2x4 micro-pixels
+	return m.microToLonLat(float64(cx*2)+0.5, float64(cy*4)+1.5, w, h)
+}
+
+// pointSpan is the width and height in degrees of the view around data
+// that is a single point, about a kilometre.
+const pointSpan = 0.01
+
+// projBounds returns the data bbox in projected coordinates. One axis may
+// have no extent, as for a horizontal or vertical line; a single point is
+// given pointSpan around it.
+func (m Model) projBounds() (geom.BBox, bool) {
+	b := m.bbox
+	if !(b.MaxX >= b.MinX && b.MaxY >= b.MinY) {
+		return geom.BBox{}, false
+	}
+	if b.MinX == b.MaxX && b.MinY == b.MaxY {
+		b = geom.BBox{MinX: b.MinX - pointSpan/2, MinY: b.MinY - pointSpan/2, MaxX: b.MaxX + pointSpan/2, MaxY: b.MaxY + pointSpan/2}
+	}
+	x0, y0 := m.projection.Forward(b.MinX, b.MinY)
+	x1, y1 := m.projection.Forward(b.MaxX, b.MaxY)
+	return geom.BBox{MinX: x0, MinY: y0, MaxX: x1, MaxY: y1}, x1 >= x0 && y1 >= y0 && (x1 > x0 || y1 > y0)
+}
+
+// fitScale returns the projected units per micro-pixel column that fit pb
+// into a w x h cell map, with the same ground scale on both axes.
+// The axis with room to spare is letterboxed rather than stretched.
+func fitScale(pb geom.BBox, w, h int) float64 {
+	sx := (pb.MaxX - pb.MinX) / float64(max(1, 2*w-1))
+	sy := (pb.MaxY - pb.MinY) / (float64(max(1, 4*h-1)) * microAspect)
+	return math.Max(sx, sy)
+}
+
+// microXY projects lon/lat onto the micro-pixel grid of a w x h cell map,
+// with the camera centre in the middle of the map.
+func (m Model) microXY(lon, lat float64, w, h int) (float64, float64, bool) {
+	cx, cy, scale, ok := m.camera(w, h)
+	if !ok {
 		return 0, 0, false
 	}
-	if w <= 1 || h <= 1 {
+	x, y := m.projection.Forward(lon, lat)
+	mx := float64(2*w-1)/2 + (x-cx)/scale
+	my := float64(4*h-1)/2 - (y-cy)/(scale*microAspect)
+	return mx, my, true
+}
+
+// microToLonLat is the inverse of microXY.
+func (m Model) microToLonLat(mx, my float64, w, h int) (float64, float64, bool) {
+	cx, cy, scale, ok := m.camera(w, h)
+	if !ok {
 		return 0, 0, false
 	}
-	zx := float64(cx-m.offsetX) / float64(w-1)
-	zy := 1.0 - float64(cy-m.offsetY)/float64(h-1)
-	nx := 0.5 + (zx-0.5)/m.zoom
-	ny := 0.5 + (zy-0.5)/m.zoom
-	lon := m.bbox.MinX + nx*(m.bbox.MaxX-m.bbox.MinX)
-	lat := m.bbox.MinY + ny*(m.bbox.MaxY-m.bbox.MinY)
+	x := cx + (mx-float64(2*w-1)/2)*scale
+	y := cy - (my-float64(4*h-1)/2)*scale*microAspect
+	lon, lat := m.projection.Inverse(x, y)
 	return lon, lat, true
 }
 
-func (m Model) renderAsciiMap(w, h int) string {
-	// Plain background (no grid)
-	lines := make([]string, h)
-	for y := 0; y < h; y++ {
-		row := make([]rune, w)
-		for x := 0; x < w; x++ {
-			row[x] = ' '
-		}
-		lines[y] = string(row)
+// updateProjection rebuilds the projection for projMode and the current
+// bbox; the equirectangular mode takes its standard parallel from the
+// bbox center.
+func (m *Model) updateProjection() {
+	p := proj.Modes[m.projMode]
+	if e, ok := p.(proj.Equirectangular); ok {
+		e.Lat0 = (m.bbox.MinY + m.bbox.MaxY) / 2
+		p = e
 	}
+	m.projection = p
+}
+
+// mapSize returns the map area size in cells, matching the layout in View.
+func (m Model) mapSize() (int, int) {
+	w := max(10, m.width)
+	if m.showSidebar {
+		w -= 28
+	}
+	h := m.height - 1 - 2 // header and footer
+	return max(10, w-1), max(4, h)
+}
+
+// viewBBox returns the lon/lat extent currently visible in the map area,
+// including any letterbox margin.
+func (m Model) viewBBox() (geom.BBox, bool) {
+	w, h := m.mapSize()
+	x0, y0, ok0 := m.microToLonLat(0, float64(4*h-1), w, h)
+	x1, y1, ok1 := m.microToLonLat(float64(2*w-1), 0, w, h)
+	if !ok0 || !ok1 {
+		return geom.BBox{}, false
+	}
+	return geom.BBox{MinX: math.Min(x0, x1), MinY: math.Min(y0, y1), MaxX: math.Max(x0, x1), MaxY: math.Max(y0, y1)}, true
+}
+
+func (m Model) renderAsciiMap(w, h int) string {
 	// High-resolution braille buffer for crisp lines/edges
 	br := newBrailleBuf(w, h)
 
-	// No ASCII outline: use braille-only rendering for polygons
-
 	// Draw polygons (fill then edges)
-	if m.showPolys && len(m.polygons) > 0 {
-		for _, poly := range m.polygons {
-			// project rings to screen (cell coords for fill, micro for edges)
-			var rings [][][2]int
-			var ringsMic [][][2]int
-			for _, ring := range poly {
-				var sp [][2]int
-				var sm [][2]int
-				for _, p := range ring {
-					sx, sy, ok := m.screenXY(p[0], p[1], w, h)
-					if !ok {
-						continue
-					}
-					mx, my, okm := m.screenXYMicro(p[0], p[1], w, h)
-					if !okm {
-						continue
-					}
-					sp = append(sp, [2]int{sx, sy})
-					sm = append(sm, [2]int{mx, my})
-				}
-				if len(sp) >= 3 {
-					rings = append(rings, sp)
-				}
-				if len(sm) >= 3 {
-					ringsMic = append(ringsMic, sm)
-				}
-			}
-			if len(rings) == 0 {
-				continue
-			}
-			// No ASCII outline collection
-			// fill using even-odd rule per scanline on outer ring (microgrid, holes ignored for now)
-			if len(ringsMic) > 0 {
-				outerMic := ringsMic[0]
-				hMic := h * 4
-				for yMic := 0; yMic < hMic; yMic++ {
-					var xs []int
-					for i := 0; i < len(outerMic); i++ {
-						a := outerMic[i]
-						b := outerMic[(i+1)%len(outerMic)]
-						if a[1] == b[1] { // horizontal edge: skip
-							continue
-						}
-						y0, y1 := a[1], b[1]
-						x0, x1 := a[0], b[0]
-						if (yMic >= y0 && yMic < y1) || (yMic >= y1 && yMic < y0) {
-							t := float64(yMic-y0) / float64(y1-y0)
-							x := int(float64(x0) + t*float64(x1-x0))
-							xs = append(xs, x)
-						}
-					}
-					if len(xs) >= 2 {
-						sort.Ints(xs)
-						for i := 0; i+1 < len(xs); i += 2 {
-							xstart := xs[i]
-							xend := xs[i+1]
-							if xstart > xend {
-								xstart, xend = xend, xstart
-							}
-							for xMic := max(0, xstart); xMic <= xend; xMic++ {
-								br.setPixel(xMic, yMic)
-							}
-						}
-					}
-				}
-			}
-			// draw edges (high-res)
-			for idx := range ringsMic {
-				r := ringsMic[idx]
-				for i := 0; i < len(r); i++ {
-					a := r[i]
-					b := r[(i+1)%len(r)]
-					br.drawLineMicro(a[0], a[1], b[0], b[1])
-				}
+	nPts, nLines, nPolys := m.fc.Counts()
+	if m.showPolys && nPolys > 0 {
+		for _, poly := range m.eachPolygon() {
+			m.drawPolygon(br, poly, w, h)
+		}
+	}
+
+	// Draw points
+	if m.showPoints && nPts > 0 {
+		for _, p := range m.eachPoint() {
+			m.drawPoint(br, p, w, h)
+		}
+	}
+
+	// Draw line strings (high-res)
+	if m.showLines && nLines > 0 {
+		for _, ls := range m.eachLine() {
+			m.drawLine(br, ls, w, h)
+		}
+	}
+
+	// Selected features and the rubber band are drawn again into their own
+	// buffer and composited in colour over the rest
+	sel := m.selectionBuf(w, h)
+	hoverX, hoverY := -1, -1
+	if m.hovering {
+		hoverX, hoverY = m.hoverMicX/2, m.hoverMicY/4
+	}
+	circle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")).Render("◯")
+	lines := make([]string, h)
+	for y := 0; y < h; y++ {
+		var b strings.Builder
+		for x := 0; x < w; x++ {
+			mask, selMask := br.m[y][x], sel.m[y][x]
+			switch {
+			case x == hoverX && y == hoverY:
+				// Hover highlight: an orange circle at the hovered vertex cell
+				b.WriteString(circle)
+			case selMask != 0:
+				b.WriteString(selectStyle.Render(string(rune(0x2800 + int(mask|selMask)))))
+			case mask != 0:
+				b.WriteRune(rune(0x2800 + int(mask)))
+			default:
+				b.WriteByte(' ')
 			}
 		}
+		lines[y] = b.String()
 	}
+	return strings.Join(lines, "\n")
+}
 
-	// Draw points only when dataset has no lines or polygons
-	if m.showPoints && len(m.lines) == 0 && len(m.polygons) == 0 && len(m.points) > 0 && m.bbox.MaxX > m.bbox.MinX && m.bbox.MaxY > m.bbox.MinY {
-		for _, p := range m.points {
-			mx, my, ok := m.screenXYMicro(p[0], p[1], w, h)
+// drawPolygon fills a polygon's outer ring and draws the edges of all its
+// rings.
+func (m Model) drawPolygon(br *brailleBuf, poly [][][2]float64, w, h int) {
+	// project rings to screen (cell coords for fill, micro for edges)
+	var rings [][][2]int
+	var ringsMic [][][2]int
+	for _, ring := range poly {
+		var sp [][2]int
+		var sm [][2]int
+		for _, p := range ring {
+			sx, sy, ok := m.screenXY(p[0], p[1], w, h)
 			if !ok {
 				continue
 			}
-			br.setPixel(mx, my)
+			mx, my, okm := m.screenXYMicro(p[0], p[1], w, h)
+			if !okm {
+				continue
+			}
+			sp = append(sp, [2]int{sx, sy})
+			sm = append(sm, [2]int{mx, my})
+		}
+		if len(sp) >= 3 {
+			rings = append(rings, sp)
+		}
+		if len(sm) >= 3 {
+			ringsMic = append(ringsMic, sm)
 		}
 	}
-
-	// Draw line strings (high-res)
-	if m.showLines && len(m.lines) > 0 {
-		for _, ls := range m.lines {
-			var prev *[2]int
-			for _, p := range ls {
-				mx, my, ok := m.screenXYMicro(p[0], p[1], w, h)
-				if !ok {
+	if len(rings) == 0 {
+		return
+	}
+	// fill using even-odd rule per scanline on outer ring (microgrid, holes ignored for now)
+	if len(ringsMic) > 0 {
+		outerMic := ringsMic[0]
+		hMic := h * 4
+		for yMic := 0; yMic < hMic; yMic++ {
+			var xs []int
+			for i := 0; i < len(outerMic); i++ {
+				a := outerMic[i]
+				b := outerMic[(i+1)%len(outerMic)]
+				if a[1] == b[1] { // horizontal edge: skip
 					continue
 				}
-				if prev != nil {
-					br.drawLineMicro(prev[0], prev[1], mx, my)
+				y0, y1 := a[1], b[1]
+				x0, x1 := a[0], b[0]
+				if (yMic >= y0 && yMic < y1) || (yMic >= y1 && yMic < y0) {
+					t := float64(yMic-y0) / float64(y1-y0)
+					x := int(float64(x0) + t*float64(x1-x0))
+					xs = append(xs, x)
+				}
+			}
+			if len(xs) >= 2 {
+				sort.Ints(xs)
+				for i := 0; i+1 < len(xs); i += 2 {
+					xstart := xs[i]
+					xend := xs[i+1]
+					if xstart > xend {
+						xstart, xend = xend, xstart
+					}
+					for xMic := max(0, xstart); xMic <= min(xend, w*2-1); xMic++ {
+						br.setPixel(xMic, yMic)
+					}
 				}
-				prev = &[2]int{mx, my}
 			}
 		}
 	}
-	// Composite braille overlay onto base lines
-	braLines := br.toLines()
-	for y := 0; y < h && y < len(braLines); y++ {
-		if len(braLines[y]) == 0 {
+	// draw edges (high-res)
+	for _, r := range ringsMic {
+		for i := 0; i < len(r); i++ {
+			a := r[i]
+			b := r[(i+1)%len(r)]
+			br.drawLineMicro(a[0], a[1], b[0], b[1])
+		}
+	}
+}
+
+// drawLine draws a line string.
+func (m Model) drawLine(br *brailleBuf, ls [][2]float64, w, h int) {
+	var prev *[2]int
+	for _, p := range ls {
+		mx, my, ok := m.screenXYMicro(p[0], p[1], w, h)
+		if !ok {
 			continue
 		}
-		base := []rune(lines[y])
-		over := []rune(braLines[y])
-		for x := 0; x < len(base) && x < len(over); x++ {
-			if over[x] != ' ' {
-				base[x] = over[x]
-			}
-			if over[x] != ' ' {
-				base[x] = over[x]
-			}
+		if prev != nil {
+			br.drawLineMicro(prev[0], prev[1], mx, my)
 		}
-		lines[y] = string(base)
+		prev = &[2]int{mx, my}
 	}
-	// No ASCII outline pass: boundaries are drawn via braille high-res edges
+}
 
-	// Hover highlight: draw an orange circle at the hovered vertex cell
-	if m.hovering {
-		cx := m.hoverMicX / 2
-		cy := m.hoverMicY / 4
-		if cy >= 0 && cy < len(lines) {
-			r := []rune(lines[cy])
-			if cx >= 0 && cx < len(r) {
-				circle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")).Render("◯")
-				// replace the cell with a colored circle
-				// rebuild line with ANSI sequence at position cx
-				pre := string(r[:cx])
-				post := string(r[cx+1:])
-				lines[cy] = pre + circle + post
-			}
-		}
+// drawPoint sets the micro-pixel of a point.
+func (m Model) drawPoint(br *brailleBuf, p [2]float64, w, h int) {
+	if mx, my, ok := m.screenXYMicro(p[0], p[1], w, h); ok {
+		br.setPixel(mx, my)
 	}
-	return strings.Join(lines, "\n")
 }
 
 // screenXYMicro maps lon/lat into a 2x4 microgrid per cell for braille rendering.
 func (m Model) screenXYMicro(lon, lat float64, w, h int) (int, int, bool) {
-	if !(m.bbox.MaxX > m.bbox.MinX && m.bbox.MaxY > m.bbox.MinY) {
+	mx, my, ok := m.microXY(lon, lat, w, h)
+	if !ok {
 		return 0, 0, false
 	}
-	nx := (lon - m.bbox.MinX) / (m.bbox.MaxX - m.bbox.MinX)
-	ny := (lat - m.bbox.MinY) / (m.bbox.MaxY - m.bbox.MinY)
-	zx := 0.5 + (nx-0.5)*m.zoom
-	zy := 0.5 + (ny-0.5)*m.zoom
-	wMic := w * 2
-	hMic := h * 4
-	sx := int(zx*float64(wMic-1)) + m.offsetX*2
-	sy := int((1.0-zy)*float64(hMic-1)) + m.offsetY*4
-	return sx, sy, true
+	return int(math.Round(mx)), int(math.Round(my)), true
 }
 
-// screenXY maps lon/lat to current screen integer coordinates considering zoom and pan.
+// screenXY maps lon/lat to current screen integer coordinates through the camera.
 func (m Model) screenXY(lon, lat float64, w, h int) (int, int, bool) {
-	if !(m.bbox.MaxX > m.bbox.MinX && m.bbox.MaxY > m.bbox.MinY) {
+	mx, my, ok := m.microXY(lon, lat, w, h)
+	if !ok {
 		return 0, 0, false
 	}
-	nx := (lon - m.bbox.MinX) / (m.bbox.MaxX - m.bbox.MinX)
-	ny := (lat - m.bbox.MinY) / (m.bbox.MaxY - m.bbox.MinY)
-	// Apply zoom around center (0.5, 0.5)
-	zx := 0.5 + (nx-0.5)*m.zoom
-	zy := 0.5 + (ny-0.5)*m.zoom
-	sx := int(zx*float64(w-1)) + m.offsetX
-	sy := int((1.0-zy)*float64(h-1)) + m.offsetY
-	return sx, sy, true
+	return int(math.Floor(math.Round(mx) / 2)), int(math.Floor(math.Round(my) / 4)), true
 }
 
-// inspectNearest finds the point closest to the viewport center and returns lon/lat.
-func (m Model) inspectNearest() (lon, lat float64, ok bool) {
-	if len(m.points) == 0 {
-		return 0, 0, false
+// eachPoint, eachLine and eachPolygon flatten the geometry parts of all
+// features for drawing.
+func (m Model) eachPoint() [][2]float64 {
+	var out [][2]float64
+	for _, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
+			continue
+		}
+		out = append(out, f.Geometry.Points...)
 	}
-	w, h := m.mapW, m.mapH
-	if w <= 0 {
-		w = 80
+	return out
+}
+
+func (m Model) eachLine() [][][2]float64 {
+	var out [][][2]float64
+	for _, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
+			continue
+		}
+		out = append(out, f.Geometry.Lines...)
 	}
-	if h <= 0 {
-		h = 24
+	return out
+}
+
+func (m Model) eachPolygon() [][][][2]float64 {
+	var out [][][][2]float64
+	for _, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
+			continue
+		}
+		out = append(out, f.Geometry.Polygons...)
 	}
-	cx, cy := w/2, h/2
-	bestD := 1<<31 - 1
-	var best [2]float64
-	for _, p := range m.points {
-		sx, sy, ok2 := m.screenXY(p[0], p[1], w, h)
-		if !ok2 {
+	return out
+}
+
+// nearestVertex finds the vertex (points, line and polygon vertices) closest to
+// micro coords (mx, my) and returns its feature index, micro position and lon/lat.
+func (m Model) nearestVertex(mx, my, w, h int) (feat, bx, by int, pt [2]float64, ok bool) {
+	best := 1<<31 - 1
+	feat, bx, by = -1, mx, my
+	for i, f := range m.fc.Features {
+		if m.hiddenLayers[f.Layer] {
 			continue
 		}
-		dx := sx - cx
-		dy := sy - cy
-		d := dx*dx + dy*dy
-		if d < bestD {
-			bestD = d
-			best = p
+		f.Geometry.EachVertex(func(p [2]float64) {
+			sx, sy, ok := m.screenXYMicro(p[0], p[1], w, h)
+			if !ok {
+				return
+			}
+			dx := sx - mx
+			dy := sy - my
+			d := dx*dx + dy*dy
+			if d < best {
+				best = d
+				feat, bx, by, pt = i, sx, sy, p
+			}
+		})
+	}
+	return feat, bx, by, pt, feat >= 0
+}
+
+// featurePopup describes feature feat for the inspect popup: the dataset,
+// the feature, its coordinate system and properties. where labels lon/lat,
+// e.g. "nearest" for the vertex closest to the viewport center.
+func (m Model) featurePopup(feat int, where string, lon, lat float64) string {
+	name := filepath.Base(m.selPath)
+	if name == "" {
+		name = "<unsaved>"
+	}
+	f := m.fc.Features[feat]
+	pts, ls, polys := m.fc.Counts()
+	meta := []string{
+		fmt.Sprintf("name: %s", name),
+		fmt.Sprintf("path: %s", m.selPath),
+		fmt.Sprintf("bbox: [%.5f, %.5f, %.5f, %.5f]", m.bbox.MinX, m.bbox.MinY, m.bbox.MaxX, m.bbox.MaxY),
+		fmt.Sprintf("counts: pts=%d ls=%d poly=%d", pts, ls, polys),
+		fmt.Sprintf("feature: %s (%s)", f.ID, f.Geometry.Type),
+		fmt.Sprintf("%s: lon=%.6f lat=%.6f", where, lon, lat),
+	}
+	meta = append(meta, m.crsInfo()...)
+	for _, k := range m.fc.Keys {
+		if v, ok := f.Properties[k]; ok {
+			meta = append(meta, fmt.Sprintf("%s: %s", k, formatValue(v)))
 		}
 	}
-	if bestD == 1<<31-1 {
-		return 0, 0, false
+	if m.mbt != nil {
+		meta = append(meta, m.mbtilesInfo()...)
+	}
+	return strings.Join(meta, "\n")
+}
+
+// inspectNearest finds the feature closest to the viewport center and returns
+// its index and the nearest vertex lon/lat.
+func (m Model) inspectNearest() (feat int, lon, lat float64, ok bool) {
+	w, h := m.mapW, m.mapH
+	if w <= 0 {
+		w = 80
+	}
+	if h <= 0 {
+		h = 24
 	}
-	return best[0], best[1], true
+	feat, _, _, pt, ok := m.nearestVertex(w, h*2, w, h)
+	return feat, pt[0], pt[1], ok
 }
@@ -15,4 +15,6 @@ var (
 	boxStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(borderCol).Padding(0, 1)
 	titleStyle = lipgloss.NewStyle().Foreground(accentFg).Bold(true)
 	dimStyle   = lipgloss.NewStyle().Foreground(baseDimFg)
+	// selected features and the rubber band on the map
+	selectStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFD700"))
 )
@@ -1,17 +1,28 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	list "github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
-	"path/filepath"
 	"strings"
 
 	"goemap/internal/geom"
+	"goemap/internal/proj"
 )
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var loadCmd tea.Cmd
 	switch msg := msg.(type) {
+	case loadProgressMsg:
+		return m, m.onLoadProgress(msg)
+	case loadDoneMsg:
+		m.onLoadDone(msg)
+		return m, nil
+	case fgbQueryMsg:
+		return m, m.onFgbQuery(msg)
+	case tilesQueryMsg:
+		return m, m.onTilesQuery(msg)
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -37,19 +48,24 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.status = "paste: empty"
 					return m, nil
 				}
-				d, err := geom.ParseWKTData(w)
+				fc, format, err := geom.ParseText(m.ta.Value())
 				if err != nil {
-					m.status = "wkt error: " + err.Error()
+					m.status = strings.ToLower(format) + " error: " + err.Error()
+					var werr *geom.WKTError
+					if errors.As(err, &werr) {
+						m.moveTextCursor(werr.Line, werr.Col)
+					}
 					return m, nil
 				}
-				m.points, m.lines, m.polygons, m.bbox = d.Points, d.Lines, d.Polygons, d.BBox
-				// reset viewport and focus layers for immediate visibility
-				m.zoom = 1.0
-				m.offsetX, m.offsetY = 0, 0
-				m.showPolys = len(m.polygons) > 0 || (strings.HasPrefix(strings.ToUpper(w), "POLYGON"))
-				m.showLines = len(m.lines) > 0 && !m.showPolys
-				m.showPoints = len(m.points) > 0 && !m.showPolys
-				m.status = fmt.Sprintf("rendered WKT  counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons))
+				m.selPath = ""
+				m.setData(fc)
+				pts, ls, polys := fc.Counts()
+				m.status = fmt.Sprintf("rendered %s  counts: pts=%d ls=%d poly=%d", format, pts, ls, polys)
+				if note := m.crsSummary(); note != "" {
+					m.status += note
+				} else if fc.SRID != 0 {
+					m.status += fmt.Sprintf("  srid=%d", fc.SRID)
+				}
 				m.pasteMode = false
 				m.ta.Blur()
 				return m, nil
@@ -58,9 +74,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.ta, cmd = m.ta.Update(msg)
 			return m, cmd
 		}
+		if m.load != nil && msg.String() == "esc" {
+			m.cancelLoad()
+			return m, nil
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "esc":
+			m.clearSelection()
+			m.status = "selection cleared"
 		case "1":
 			m.showPoints = !m.showPoints
 			m.status = fmt.Sprintf("points: %v", m.showPoints)
@@ -71,15 +94,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.showPolys = !m.showPolys
 			m.status = fmt.Sprintf("polys: %v", m.showPolys)
 		case "+", "=":
-			if m.zoom < 64 {
-				m.zoom *= 1.2
-				m.status = fmt.Sprintf("zoom: %.2fx", m.zoom)
-			}
+			m.zoomAtPointer(zoomStep)
 		case "-", "_":
-			if m.zoom > 0.05 {
-				m.zoom /= 1.2
-				m.status = fmt.Sprintf("zoom: %.2fx", m.zoom)
-			}
+			m.zoomAtPointer(1 / zoomStep)
+		case "0":
+			m.resetCamera()
+			m.status = "zoom: fit data"
 		case "tab":
 			m.showSidebar = !m.showSidebar
 			if m.showSidebar {
@@ -96,30 +116,29 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.status = "view mode"
 				m.ta.Blur()
 			}
+		case "m":
+			// cycle map projections
+			m.projMode = (m.projMode + 1) % len(proj.Modes)
+			m.updateProjection()
+			m.status = "projection: " + m.projection.Name()
 		case "h":
 			m.helpVisible = !m.helpVisible
 		case "a":
 			m.showAttrs = !m.showAttrs
 			if m.showAttrs {
 				m.refreshAttrsFromCurrent()
+				if feat := m.firstSelected(); m.showAttrs && feat >= 0 && len(m.fc.Keys) > 0 {
+					m.tbl.SetCursor(feat)
+				}
 			}
 		case "i":
-			lon, lat, ok := m.inspectNearest()
+			feat, lon, lat, ok := m.inspectNearest()
 			if ok {
-				// build popup content
-				name := filepath.Base(m.selPath)
-				if name == "" {
-					name = "<unsaved>"
-				}
-				meta := []string{
-					fmt.Sprintf("name: %s", name),
-					fmt.Sprintf("path: %s", m.selPath),
-					fmt.Sprintf("bbox: [%.5f, %.5f, %.5f, %.5f]", m.bbox.MinX, m.bbox.MinY, m.bbox.MaxX, m.bbox.MaxY),
-					fmt.Sprintf("counts: pts=%d ls=%d poly=%d", len(m.points), len(m.lines), len(m.polygons)),
-					fmt.Sprintf("nearest: lon=%.6f lat=%.6f", lon, lat),
-					"crs: unknown", "datum: unknown",
-				}
-				m.inspectPopup = strings.Join(meta, "\n")
+				m.inspectPopup = m.featurePopup(feat, "nearest", lon, lat)
+				m.status = "inspect popup"
+			} else if m.mbt != nil {
+				// a tileset has metadata worth showing even between features
+				m.inspectPopup = strings.Join(m.mbtilesInfo(), "\n")
 				m.status = "inspect popup"
 			} else {
 				m.inspectPopup = "no feature nearby"
@@ -132,20 +151,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.showLines = !all
 			m.showPolys = !all
 			m.status = fmt.Sprintf("layers: pts=%v ls=%v poly=%v", m.showPoints, m.showLines, m.showPolys)
+		case "L":
+			// select the next named data layer
+			if len(m.layers) > 1 {
+				m.layerSel = (m.layerSel + 1) % len(m.layers)
+			}
+			m.status = m.layerStatus()
+		case "v":
+			// toggle visibility of the selected data layer
+			if len(m.layers) > 0 {
+				name := m.layers[m.layerSel]
+				m.hiddenLayers[name] = !m.hiddenLayers[name]
+				m.hoverFeat = -1
+			}
+			m.status = m.layerStatus()
 		case "enter":
 			if m.showSidebar {
 				if it, ok := m.l.SelectedItem().(fileItem); ok {
-					m.loadPath(it.path)
+					loadCmd = m.loadItem(it)
 				}
 			}
 		case "up":
-			m.offsetY -= 1
+			m.pan(0, -panStep)
 		case "down":
-			m.offsetY += 1
+			m.pan(0, panStep)
 		case "left":
-			m.offsetX -= 2
+			m.pan(panStep, 0)
 		case "right":
-			m.offsetX += 2
+			m.pan(-panStep, 0)
 		}
 	case tea.MouseMsg:
 		// track hover over map area
@@ -180,11 +213,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}()
 		mapOriginY := headerHeight
 		// mouse cell within map?
-		cx, cy := msg.X, msg.Y
-		if cx >= mapOriginX && cx < mapOriginX+mapWidth && cy >= mapOriginY && cy < mapOriginY+mapHeight {
+		cx, cy := msg.X-mapOriginX, msg.Y-mapOriginY
+		inside := cx >= 0 && cx < mapWidth && cy >= 0 && cy < mapHeight
+		if !m.showAttrs && !m.pasteMode {
+			m.mouseButtons(msg, cx, cy, inside, mapWidth, mapHeight)
+		}
+		if inside {
 			m.hovering = true
-			m.hoverCellX = cx - mapOriginX
-			m.hoverCellY = cy - mapOriginY
+			m.hoverCellX = cx
+			m.hoverCellY = cy
 			// compute lon/lat for footer
 			if lon, lat, ok := m.cellToLonLat(m.hoverCellX, m.hoverCellY, mapWidth, mapHeight); ok {
 				m.hoverHasGeo = true
@@ -194,68 +231,49 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.hoverHasGeo = false
 			}
 			// find nearest vertex (points + line vertices + polygon vertices) using micro coords
-			hxMic := m.hoverCellX * 2
-			hyMic := m.hoverCellY * 4
-			best := 1<<31 - 1
-			bx, by := hxMic, hyMic
-			// points
-			for _, p := range m.points {
-				mx, my, ok := m.screenXYMicro(p[0], p[1], mapWidth, mapHeight)
-				if !ok {
-					continue
-				}
-				dx := mx - hxMic
-				dy := my - hyMic
-				d := dx*dx + dy*dy
-				if d < best {
-					best = d
-					bx, by = mx, my
-				}
-			}
-			// lines
-			for _, ls := range m.lines {
-				for _, p := range ls {
-					mx, my, ok := m.screenXYMicro(p[0], p[1], mapWidth, mapHeight)
-					if !ok {
-						continue
-					}
-					dx := mx - hxMic
-					dy := my - hyMic
-					d := dx*dx + dy*dy
-					if d < best {
-						best = d
-						bx, by = mx, my
-					}
-				}
-			}
-			// polygons
-			for _, poly := range m.polygons {
-				for _, ring := range poly {
-					for _, p := range ring {
-						mx, my, ok := m.screenXYMicro(p[0], p[1], mapWidth, mapHeight)
-						if !ok {
-							continue
-						}
-						dx := mx - hxMic
-						dy := my - hyMic
-						d := dx*dx + dy*dy
-						if d < best {
-							best = d
-							bx, by = mx, my
-						}
-					}
-				}
-			}
+			feat, bx, by, _, _ := m.nearestVertex(m.hoverCellX*2, m.hoverCellY*4, mapWidth, mapHeight)
+			m.hoverFeat = feat
 			m.hoverMicX, m.hoverMicY = bx, by
 		} else {
 			m.hovering = false
+			m.hoverFeat = -1
 		}
 	}
+	viewCmd := m.refreshViewport()
 	// Pass messages to list when visible
 	if m.showSidebar {
 		var cmd tea.Cmd
 		m.l, cmd = m.l.Update(msg)
-		return m, cmd
+		return m, tea.Batch(loadCmd, viewCmd, cmd)
+	}
+	return m, tea.Batch(loadCmd, viewCmd)
+}
+
+// moveTextCursor places the paste textarea cursor at a 1-based line/column,
+// e.g. where a parse error was found.
+func (m *Model) moveTextCursor(line, col int) {
+	// CursorUp/CursorDown move by wrapped row, not by line
+	for m.ta.Line() > max(line-1, 0) {
+		m.ta.CursorUp()
+	}
+	for m.ta.Line() < min(line-1, m.ta.LineCount()-1) {
+		m.ta.CursorDown()
+	}
+	m.ta.SetCursor(col - 1)
+}
+
+// layerStatus describes the selected data layer and whether it is shown.
+func (m Model) layerStatus() string {
+	if len(m.layers) == 0 {
+		return "no layers"
+	}
+	name := m.layers[m.layerSel]
+	state := "shown"
+	if m.hiddenLayers[name] {
+		state = "hidden"
+	}
+	if name == "" {
+		name = "(unnamed)"
 	}
-	return m, nil
+	return fmt.Sprintf("layer %d/%d: %s (%s)", m.layerSel+1, len(m.layers), name, state)
 }
@@ -124,13 +124,17 @@ func (m Model) renderHelp() string {
 	}
 	keys := []string{
 		"↑↓←→ pan",
-		"+/- zoom",
+		"+/-/wheel zoom",
+		"0 fit",
 		"Tab sidebar",
 		"Enter open",
 		"p paste",
 		"a attrs",
 		"i inspect",
+		"click/⇧drag select",
 		"l layers",
+		"L/v data layer",
+		"m projection",
 		"h help",
 		"q quit",
 	}